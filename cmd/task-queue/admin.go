@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/mnikita/task-queue/pkg/cli"
+	"github.com/mnikita/task-queue/pkg/consumer"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+//Output formats of admin commands
+const (
+	formatTable = "table"
+	formatJson  = "json"
+)
+
+//newAdminFlagSet creates flag set of admin command with output format flag
+func newAdminFlagSet(name string, config *cli.Configuration, format *string, stderr io.Writer) *flag.FlagSet {
+	fs := newFlagSet(name, config, stderr)
+	fs.StringVar(format, "format", formatTable, "output format, "+formatTable+" or "+formatJson)
+
+	return fs
+}
+
+//parseArgs parses flags requiring between min and max arguments
+func parseArgs(fs *flag.FlagSet, args []string, min int, max int) error {
+	if err := parseFlags(fs, args, max); err != nil {
+		return err
+	}
+
+	if fs.NArg() < min {
+		fs.Usage()
+		return errUsage
+	}
+
+	return nil
+}
+
+//writeOutput writes value as JSON or as table written by given function
+func writeOutput(w io.Writer, format string, v interface{}, table func(tw *tabwriter.Writer)) error {
+	switch format {
+	case formatJson:
+		data, err := json.MarshalIndent(v, "", " ")
+
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintln(w, string(data))
+
+		return err
+	case formatTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 1, ' ', 0)
+
+		table(tw)
+
+		return tw.Flush()
+	}
+
+	return fmt.Errorf("unknown output format %q", format)
+}
+
+func runTubes(args []string, _ io.Reader, stdout io.Writer, stderr io.Writer) error {
+	var format string
+
+	config := cli.NewConfiguration()
+	fs := newAdminFlagSet("tubes", config, &format, stderr)
+
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	return withCli(config, func(handler cli.Handler) error {
+		tubes, err := handler.ListTubes()
+
+		if err != nil {
+			return err
+		}
+
+		return writeOutput(stdout, format, tubes, func(tw *tabwriter.Writer) {
+			for _, tube := range tubes {
+				_, _ = fmt.Fprintln(tw, tube)
+			}
+		})
+	})
+}
+
+func runStats(args []string, _ io.Reader, stdout io.Writer, stderr io.Writer) error {
+	var format string
+
+	config := cli.NewConfiguration()
+	fs := newAdminFlagSet("stats", config, &format, stderr)
+
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	return withCli(config, func(handler cli.Handler) error {
+		if fs.NArg() == 1 {
+			stats, err := handler.StatsTube(fs.Arg(0))
+
+			if err != nil {
+				return err
+			}
+
+			return writeOutput(stdout, format, stats, func(tw *tabwriter.Writer) {
+				writeTubeStats(tw, stats)
+			})
+		}
+
+		stats, err := handler.Stats()
+
+		if err != nil {
+			return err
+		}
+
+		return writeOutput(stdout, format, stats, func(tw *tabwriter.Writer) {
+			writeServerStats(tw, stats)
+		})
+	})
+}
+
+func runPeek(args []string, _ io.Reader, stdout io.Writer, stderr io.Writer) error {
+	var format string
+
+	config := cli.NewConfiguration()
+	fs := newAdminFlagSet("peek", config, &format, stderr)
+
+	if err := parseArgs(fs, args, 2, 2); err != nil {
+		return err
+	}
+
+	return withCli(config, func(handler cli.Handler) error {
+		job, err := handler.Peek(fs.Arg(0), fs.Arg(1))
+
+		if err != nil {
+			return err
+		}
+
+		return writeOutput(stdout, format, job, func(tw *tabwriter.Writer) {
+			writeJob(tw, job)
+		})
+	})
+}
+
+func runJob(args []string, _ io.Reader, stdout io.Writer, stderr io.Writer) error {
+	var format string
+
+	config := cli.NewConfiguration()
+	fs := newAdminFlagSet("job", config, &format, stderr)
+
+	id, err := parseJobId(fs, args)
+
+	if err != nil {
+		return err
+	}
+
+	return withCli(config, func(handler cli.Handler) error {
+		job, err := handler.Job(id)
+
+		if err != nil {
+			return err
+		}
+
+		return writeOutput(stdout, format, job, func(tw *tabwriter.Writer) {
+			writeJob(tw, job)
+		})
+	})
+}
+
+func runKick(args []string, _ io.Reader, stdout io.Writer, stderr io.Writer) error {
+	var format string
+
+	config := cli.NewConfiguration()
+	fs := newAdminFlagSet("kick", config, &format, stderr)
+
+	if err := parseArgs(fs, args, 2, 2); err != nil {
+		return err
+	}
+
+	bound, err := strconv.Atoi(fs.Arg(1))
+
+	if err != nil {
+		return err
+	}
+
+	return withCli(config, func(handler cli.Handler) error {
+		n, err := handler.Kick(fs.Arg(0), bound)
+
+		if err != nil {
+			return err
+		}
+
+		return writeOutput(stdout, format, n, func(tw *tabwriter.Writer) {
+			_, _ = fmt.Fprintln(tw, n)
+		})
+	})
+}
+
+func runKickJob(args []string, _ io.Reader, _ io.Writer, stderr io.Writer) error {
+	config := cli.NewConfiguration()
+	fs := newFlagSet("kick-job", config, stderr)
+
+	id, err := parseJobId(fs, args)
+
+	if err != nil {
+		return err
+	}
+
+	return withCli(config, func(handler cli.Handler) error {
+		return handler.KickJob(id)
+	})
+}
+
+func runPause(args []string, _ io.Reader, _ io.Writer, stderr io.Writer) error {
+	config := cli.NewConfiguration()
+	fs := newFlagSet("pause", config, stderr)
+
+	if err := parseArgs(fs, args, 2, 2); err != nil {
+		return err
+	}
+
+	delay, err := time.ParseDuration(fs.Arg(1))
+
+	if err != nil {
+		return err
+	}
+
+	return withCli(config, func(handler cli.Handler) error {
+		return handler.PauseTube(fs.Arg(0), delay)
+	})
+}
+
+func writeServerStats(tw *tabwriter.Writer, s *consumer.ServerStats) {
+	_, _ = fmt.Fprintf(tw, "Urgent:\t%d\n", s.Urgent)
+	_, _ = fmt.Fprintf(tw, "Ready:\t%d\n", s.Ready)
+	_, _ = fmt.Fprintf(tw, "Reserved:\t%d\n", s.Reserved)
+	_, _ = fmt.Fprintf(tw, "Delayed:\t%d\n", s.Delayed)
+	_, _ = fmt.Fprintf(tw, "Buried:\t%d\n", s.Buried)
+	_, _ = fmt.Fprintf(tw, "Total jobs:\t%d\n", s.TotalJobs)
+	_, _ = fmt.Fprintf(tw, "Timeouts:\t%d\n", s.Timeouts)
+	_, _ = fmt.Fprintf(tw, "Tubes:\t%d\n", s.Tubes)
+	_, _ = fmt.Fprintf(tw, "Connections:\t%d\n", s.Connections)
+	_, _ = fmt.Fprintf(tw, "Producers:\t%d\n", s.Producers)
+	_, _ = fmt.Fprintf(tw, "Workers:\t%d\n", s.Workers)
+	_, _ = fmt.Fprintf(tw, "Waiting:\t%d\n", s.Waiting)
+	_, _ = fmt.Fprintf(tw, "Version:\t%s\n", s.Version)
+	_, _ = fmt.Fprintf(tw, "Uptime:\t%s\n", s.Uptime)
+	_, _ = fmt.Fprintf(tw, "Hostname:\t%s\n", s.Hostname)
+}
+
+func writeTubeStats(tw *tabwriter.Writer, s *consumer.TubeStats) {
+	_, _ = fmt.Fprintf(tw, "Name:\t%s\n", s.Name)
+	_, _ = fmt.Fprintf(tw, "Urgent:\t%d\n", s.Urgent)
+	_, _ = fmt.Fprintf(tw, "Ready:\t%d\n", s.Ready)
+	_, _ = fmt.Fprintf(tw, "Reserved:\t%d\n", s.Reserved)
+	_, _ = fmt.Fprintf(tw, "Delayed:\t%d\n", s.Delayed)
+	_, _ = fmt.Fprintf(tw, "Buried:\t%d\n", s.Buried)
+	_, _ = fmt.Fprintf(tw, "Total jobs:\t%d\n", s.TotalJobs)
+	_, _ = fmt.Fprintf(tw, "Using:\t%d\n", s.Using)
+	_, _ = fmt.Fprintf(tw, "Watching:\t%d\n", s.Watching)
+	_, _ = fmt.Fprintf(tw, "Waiting:\t%d\n", s.Waiting)
+	_, _ = fmt.Fprintf(tw, "Deletes:\t%d\n", s.Deletes)
+	_, _ = fmt.Fprintf(tw, "Pauses:\t%d\n", s.Pauses)
+	_, _ = fmt.Fprintf(tw, "Pause:\t%s\n", s.Pause)
+	_, _ = fmt.Fprintf(tw, "Pause left:\t%s\n", s.PauseTimeLeft)
+}
+
+func writeJob(tw *tabwriter.Writer, j *cli.Job) {
+	s := j.Stats
+
+	_, _ = fmt.Fprintf(tw, "Id:\t%d\n", j.Id)
+	_, _ = fmt.Fprintf(tw, "Tube:\t%s\n", s.Tube)
+	_, _ = fmt.Fprintf(tw, "State:\t%s\n", s.State)
+	_, _ = fmt.Fprintf(tw, "Priority:\t%d\n", s.Priority)
+	_, _ = fmt.Fprintf(tw, "Age:\t%s\n", s.Age)
+	_, _ = fmt.Fprintf(tw, "Delay:\t%s\n", s.Delay)
+	_, _ = fmt.Fprintf(tw, "Ttr:\t%s\n", s.Ttr)
+	_, _ = fmt.Fprintf(tw, "Time left:\t%s\n", s.TimeLeft)
+	_, _ = fmt.Fprintf(tw, "Reserves:\t%d\n", s.Reserves)
+	_, _ = fmt.Fprintf(tw, "Timeouts:\t%d\n", s.Timeouts)
+	_, _ = fmt.Fprintf(tw, "Releases:\t%d\n", s.Releases)
+	_, _ = fmt.Fprintf(tw, "Buries:\t%d\n", s.Buries)
+	_, _ = fmt.Fprintf(tw, "Kicks:\t%d\n", s.Kicks)
+	_, _ = fmt.Fprintf(tw, "Body:\t%s\n", j.Body)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mnikita/task-queue/pkg/cli"
+	"io"
+	"os"
+)
+
+func runExport(args []string, _ io.Reader, stdout io.Writer, stderr io.Writer) error {
+	var output string
+
+	config := cli.NewConfiguration()
+	fs := newFlagSet("export", config, stderr)
+	fs.BoolVar(&config.ExportCopy, "copy", config.ExportCopy,
+		"copy jobs leaving the tube unchanged instead of draining it, inspects every job of the server")
+	fs.StringVar(&output, "output", "", "archive file, archive is written to stdout if not set")
+
+	if err := parseArgs(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	return withCli(config, func(handler cli.Handler) (err error) {
+		if output == "" {
+			_, err = handler.Export(fs.Arg(0), stdout)
+
+			return err
+		}
+
+		file, err := os.Create(output)
+
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+
+		n, err := handler.Export(fs.Arg(0), file)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintln(stdout, n)
+
+		return err
+	})
+}
+
+func runImport(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	config := cli.NewConfiguration()
+	fs := newFlagSet("import", config, stderr)
+	fs.StringVar(&config.ImportTube, "tube", config.ImportTube,
+		"tube jobs are imported to, tube of archived job is used if not set")
+	fs.BoolVar(&config.ImportDryRun, "dry-run", config.ImportDryRun, "validate archive without putting jobs")
+	fs.Float64Var(&config.ImportRate, "rate", config.ImportRate, "maximum number of jobs imported per second")
+
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	archive := stdin
+
+	if fs.NArg() == 1 && fs.Arg(0) != "-" {
+		file, err := os.Open(fs.Arg(0))
+
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+
+		archive = file
+	}
+
+	return withCli(config, func(handler cli.Handler) error {
+		n, err := handler.Import(archive)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintln(stdout, n)
+
+		return err
+	})
+}
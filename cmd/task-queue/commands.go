@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/mnikita/task-queue/pkg/cli"
+	"github.com/mnikita/task-queue/pkg/log"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"text/tabwriter"
+)
+
+//newCli creates cli handler for given configuration. Replaced in tests
+var newCli = func(config *cli.Configuration) cli.Handler {
+	return cli.InitializeCli(config)
+}
+
+//withCli initializes cli handler, runs given function and closes handler afterwards
+func withCli(config *cli.Configuration, f func(handler cli.Handler) error) (err error) {
+	handler := newCli(config)
+
+	if err = handler.Init(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if closeErr := handler.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	return f(handler)
+}
+
+func parseFlags(fs *flag.FlagSet, args []string, nArgs int) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() > nArgs {
+		fs.Usage()
+		return errUsage
+	}
+
+	return nil
+}
+
+func runWorker(args []string, _ io.Reader, _ io.Writer, stderr io.Writer) error {
+	config := cli.NewConfiguration()
+	fs := newFlagSet("worker", config, stderr)
+	addResultFlags(fs, config)
+	addServerFlags(fs, config)
+
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	return withCli(config, func(handler cli.Handler) error {
+		return handler.Start(nil)
+	})
+}
+
+func runPut(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	config := cli.NewConfiguration()
+	fs := newFlagSet("put", config, stderr)
+	addPutFlags(fs, config)
+
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	//single task given as argument
+	if config.TaskDataFile == "" && fs.NArg() == 1 && fs.Arg(0) != "-" {
+		taskData := []byte(fs.Arg(0))
+
+		return withCli(config, func(handler cli.Handler) error {
+			id, err := handler.Put(taskData)
+
+			if err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprintln(stdout, id)
+
+			return err
+		})
+	}
+
+	var taskData []byte
+
+	if config.TaskDataFile == "" {
+		var err error
+
+		if taskData, err = ioutil.ReadAll(stdin); err != nil {
+			return err
+		}
+	}
+
+	return withCli(config, func(handler cli.Handler) (err error) {
+		var results []*cli.PutResult
+
+		if taskData == nil {
+			results, err = handler.PutFromFile()
+		} else {
+			results, err = handler.PutBulk(taskData)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return writePutResults(stdout, results)
+	})
+}
+
+//writePutResults writes job id or error of every bulk task entry. Error is returned if any entry failed
+func writePutResults(w io.Writer, results []*cli.PutResult) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(tw, "ITEM\tID\tTUBE\tERROR")
+
+	failed := 0
+
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+
+			_, _ = fmt.Fprintf(tw, "%d\t-\t%s\t%s\n", r.Item, r.Tube, r.Err)
+
+			continue
+		}
+
+		_, _ = fmt.Fprintf(tw, "%d\t%d\t%s\t\n", r.Item, r.Id, r.Tube)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return log.BulkPutFailedError(failed, len(results))
+	}
+
+	return nil
+}
+
+func runDelete(args []string, _ io.Reader, _ io.Writer, stderr io.Writer) error {
+	config := cli.NewConfiguration()
+	fs := newFlagSet("delete", config, stderr)
+
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	id, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+
+	if err != nil {
+		return err
+	}
+
+	return withCli(config, func(handler cli.Handler) error {
+		return handler.Delete(id)
+	})
+}
+
+func runResult(args []string, _ io.Reader, stdout io.Writer, stderr io.Writer) error {
+	config := cli.NewConfiguration()
+	fs := newFlagSet("result", config, stderr)
+	addResultFlags(fs, config)
+
+	id, err := parseJobId(fs, args)
+
+	if err != nil {
+		return err
+	}
+
+	return withCli(config, func(handler cli.Handler) error {
+		record, err := handler.Result(id)
+
+		if err != nil {
+			return err
+		}
+
+		data, err := json.MarshalIndent(record, "", " ")
+
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintln(stdout, string(data))
+
+		return err
+	})
+}
+
+func runConfig(args []string, _ io.Reader, stdout io.Writer, stderr io.Writer) error {
+	if len(args) == 0 || args[0] != "init" {
+		_, _ = fmt.Fprint(stderr, "Usage: task-queue config init [file]\n")
+		return errUsage
+	}
+
+	config := cli.NewConfiguration()
+	fs := flag.NewFlagSet("config init", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	if err := parseFlags(fs, args[1:], 1); err != nil {
+		return err
+	}
+
+	//configuration is written without initialization, so server URL is not required
+	handler := newCli(config)
+
+	if fs.NArg() == 1 {
+		_, err := handler.WriteDefaultConfigurationToFile(fs.Arg(0))
+
+		return err
+	}
+
+	_, err := handler.WriteDefaultConfiguration(stdout)
+
+	return err
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/mnikita/task-queue/pkg/cli"
+	"github.com/mnikita/task-queue/pkg/common"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const deadLetterUsage = `Usage: task-queue dead-letter <command> [flags] [arguments]
+
+Commands:
+  list                    list ready, delayed and buried dead letters
+  inspect <id>            show dead letter details and original job body
+  requeue <id>            put dead letter back to its origin tube
+  requeue-all             put all ready dead letters back to their origin tubes
+`
+
+func newDeadLetterFlagSet(name string, config *cli.Configuration, stderr io.Writer) *flag.FlagSet {
+	fs := newFlagSet("dead-letter "+name, config, stderr)
+	fs.StringVar(&config.DeadLetterTube, "dead-letter-tube", config.DeadLetterTube,
+		"dead-letter tube, overrides consumer configuration")
+
+	return fs
+}
+
+func parseJobId(fs *flag.FlagSet, args []string) (uint64, error) {
+	if err := parseFlags(fs, args, 1); err != nil {
+		return 0, err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 0, errUsage
+	}
+
+	return strconv.ParseUint(fs.Arg(0), 10, 64)
+}
+
+func runDeadLetter(args []string, _ io.Reader, stdout io.Writer, stderr io.Writer) error {
+	if len(args) == 0 {
+		_, _ = fmt.Fprint(stderr, deadLetterUsage)
+		return errUsage
+	}
+
+	config := cli.NewConfiguration()
+	fs := newDeadLetterFlagSet(args[0], config, stderr)
+
+	switch args[0] {
+	case "list":
+		if err := parseFlags(fs, args[1:], 0); err != nil {
+			return err
+		}
+
+		return withCli(config, func(handler cli.Handler) error {
+			letters, err := handler.DeadLetters()
+
+			if err != nil {
+				return err
+			}
+
+			return writeDeadLetters(stdout, letters)
+		})
+	case "inspect":
+		id, err := parseJobId(fs, args[1:])
+
+		if err != nil {
+			return err
+		}
+
+		return withCli(config, func(handler cli.Handler) error {
+			letter, err := handler.DeadLetter(id)
+
+			if err != nil {
+				return err
+			}
+
+			return writeDeadLetter(stdout, letter)
+		})
+	case "requeue":
+		addPutFlags(fs, config)
+
+		id, err := parseJobId(fs, args[1:])
+
+		if err != nil {
+			return err
+		}
+
+		return withCli(config, func(handler cli.Handler) error {
+			newId, err := handler.Requeue(id)
+
+			if err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprintln(stdout, newId)
+
+			return err
+		})
+	case "requeue-all":
+		addPutFlags(fs, config)
+
+		if err := parseFlags(fs, args[1:], 0); err != nil {
+			return err
+		}
+
+		return withCli(config, func(handler cli.Handler) error {
+			n, err := handler.RequeueAll()
+
+			if err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprintln(stdout, n)
+
+			return err
+		})
+	}
+
+	_, _ = fmt.Fprintf(stderr, "unknown dead-letter command %q\n\n%s", args[0], deadLetterUsage)
+
+	return errUsage
+}
+
+func writeDeadLetters(w io.Writer, letters []*common.DeadLetter) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(tw, "ID\tJOB\tTUBE\tATTEMPTS\tTIMESTAMP\tERROR")
+
+	for _, l := range letters {
+		_, _ = fmt.Fprintf(tw, "%d\t%d\t%s\t%d\t%s\t%s\n", l.Id, l.JobId, l.Tube, l.Attempts,
+			l.Timestamp.Format(time.RFC3339), l.Error)
+	}
+
+	return tw.Flush()
+}
+
+func writeDeadLetter(w io.Writer, l *common.DeadLetter) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 1, ' ', 0)
+
+	_, _ = fmt.Fprintf(tw, "Id:\t%d\n", l.Id)
+	_, _ = fmt.Fprintf(tw, "Job:\t%d\n", l.JobId)
+	_, _ = fmt.Fprintf(tw, "Tube:\t%s\n", l.Tube)
+	_, _ = fmt.Fprintf(tw, "Attempts:\t%d\n", l.Attempts)
+	_, _ = fmt.Fprintf(tw, "Timestamp:\t%s\n", l.Timestamp.Format(time.RFC3339))
+	_, _ = fmt.Fprintf(tw, "Error:\t%s\n", l.Error)
+	_, _ = fmt.Fprintf(tw, "Body:\t%s\n", l.Body)
+
+	return tw.Flush()
+}
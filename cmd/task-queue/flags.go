@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"github.com/mnikita/task-queue/pkg/cli"
+	"github.com/mnikita/task-queue/pkg/connection"
+	"github.com/mnikita/task-queue/pkg/metrics"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//tubesValue maps comma separated tube list onto configuration tubes
+type tubesValue struct {
+	tubes *[]string
+}
+
+//uint32Value maps unsigned flag onto configuration priority
+type uint32Value struct {
+	value *uint32
+}
+
+func (t *tubesValue) String() string {
+	if t.tubes == nil {
+		return ""
+	}
+
+	return strings.Join(*t.tubes, ",")
+}
+
+func (t *tubesValue) Set(s string) error {
+	var tubes []string
+
+	for _, tube := range strings.Split(s, ",") {
+		if tube = strings.TrimSpace(tube); tube != "" {
+			tubes = append(tubes, tube)
+		}
+	}
+
+	*t.tubes = tubes
+
+	return nil
+}
+
+func (u *uint32Value) String() string {
+	if u.value == nil {
+		return "0"
+	}
+
+	return strconv.FormatUint(uint64(*u.value), 10)
+}
+
+func (u *uint32Value) Set(s string) error {
+	v, err := strconv.ParseUint(s, 10, 32)
+
+	if err != nil {
+		return err
+	}
+
+	*u.value = uint32(v)
+
+	return nil
+}
+
+//newFlagSet creates command flag set with flags mapped onto cli.Configuration
+func newFlagSet(name string, config *cli.Configuration, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	fs.StringVar(&config.Url, "url", config.Url,
+		"beanstalkd server URL, e.g. tcp://127.0.0.1:11300 (env "+cli.EnvUrl+")")
+	fs.Var(&tubesValue{&config.Tubes}, "tubes",
+		"comma separated list of tubes (env "+cli.EnvTubes+")")
+	fs.StringVar(&config.ConfigFile, "config", config.ConfigFile, "JSON configuration file")
+
+	return fs
+}
+
+//addPutFlags adds flags used by commands putting tasks
+func addPutFlags(fs *flag.FlagSet, config *cli.Configuration) {
+	fs.StringVar(&config.TaskDataFile, "file", config.TaskDataFile, "file with task JSON data")
+	fs.Var(&uint32Value{&config.PutPriority}, "priority", "job priority")
+	fs.DurationVar(&config.PutDelay, "delay", config.PutDelay, "job delay")
+	fs.DurationVar(&config.PutTtr, "ttr", config.PutTtr, "job time to run")
+}
+
+//addResultFlags adds flags selecting result store
+func addResultFlags(fs *flag.FlagSet, config *cli.Configuration) {
+	fs.StringVar(&config.ResultDir, "result-dir", config.ResultDir,
+		"directory of file result store, used unless configuration file sets result store")
+}
+
+//addServerFlags adds flags of worker HTTP server
+func addServerFlags(fs *flag.FlagSet, config *cli.Configuration) {
+	fs.StringVar(&config.HttpAddr, "http-addr", config.HttpAddr,
+		"listen address of HTTP server exposing "+metrics.Path+", e.g. :9090")
+	fs.StringVar(&config.AdminAddr, "admin-addr", config.AdminAddr,
+		"listen address of unauthenticated admin HTTP server exposing "+connection.PathTubes+
+			", e.g. 127.0.0.1:9091. Disabled if not set")
+}
@@ -0,0 +1,108 @@
+//Command task-queue runs task queue workers and manages Beanstalkd jobs
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `Usage: task-queue <command> [flags] [arguments]
+
+Commands:
+  worker                  start worker consuming configured tubes
+  put [task JSON]         put task from argument, or tasks from -file or stdin
+  delete <id>             delete job by id
+  result <id>             show stored task result of job
+  config init [file]      write default configuration to file or stdout
+  dead-letter <command>   list, inspect and requeue dead letters
+  tubes                   list tubes
+  stats [tube]            show server or tube stats
+  peek <state> <tube>     show next ready, delayed or buried job of tube
+  job <id>                show job stats and body
+  kick <tube> <n>         kick up to n buried or delayed jobs of tube
+  kick-job <id>           kick buried or delayed job by id
+  pause <tube> <dur>      pause reserving jobs from tube for duration
+  export <tube>           drain or copy tube jobs to NDJSON archive
+  import [archive]        put jobs from archive file or stdin
+  watching                list tubes watched by running worker
+  watch <tube>            add tube to tubes watched by running worker
+  ignore <tube>           remove tube from tubes watched by running worker
+
+Admin commands print tables, or JSON with -format json.
+
+Run "task-queue <command> -h" for command flags.
+`
+
+//command describes one task-queue subcommand
+type command struct {
+	name string
+	run  func(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error
+}
+
+//errUsage signals that command usage has been printed
+var errUsage = errors.New("usage")
+
+var commands = []*command{
+	{name: "worker", run: runWorker},
+	{name: "put", run: runPut},
+	{name: "delete", run: runDelete},
+	{name: "result", run: runResult},
+	{name: "config", run: runConfig},
+	{name: "dead-letter", run: runDeadLetter},
+	{name: "tubes", run: runTubes},
+	{name: "stats", run: runStats},
+	{name: "peek", run: runPeek},
+	{name: "job", run: runJob},
+	{name: "kick", run: runKick},
+	{name: "kick-job", run: runKickJob},
+	{name: "pause", run: runPause},
+	{name: "export", run: runExport},
+	{name: "import", run: runImport},
+	{name: "watching", run: runWatching},
+	{name: "watch", run: runWatch},
+	{name: "ignore", run: runIgnore},
+}
+
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		_, _ = fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	c := findCommand(args[0])
+
+	if c == nil {
+		_, _ = fmt.Fprintf(stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+
+	err := c.run(args[1:], stdin, stdout, stderr)
+
+	if err == flag.ErrHelp || err == errUsage {
+		return 2
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "task-queue %s: %s\n", c.name, err)
+		return 1
+	}
+
+	return 0
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/mnikita/task-queue/pkg/cli"
+	"github.com/mnikita/task-queue/pkg/cli/mocks"
+	"github.com/mnikita/task-queue/pkg/common"
+	"github.com/mnikita/task-queue/pkg/connection"
+	cmocks "github.com/mnikita/task-queue/pkg/connection/mocks"
+	"github.com/mnikita/task-queue/pkg/consumer"
+	"github.com/mnikita/task-queue/pkg/result"
+	"github.com/mnikita/task-queue/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Mock struct {
+	t *testing.T
+
+	ctrl *gomock.Controller
+
+	handler *mocks.MockHandler
+	config  *cli.Configuration
+
+	stdout *bytes.Buffer
+	stderr *bytes.Buffer
+}
+
+func newMock(t *testing.T) *Mock {
+	m := &Mock{}
+	m.t = t
+	m.ctrl = gomock.NewController(t)
+
+	m.handler = mocks.NewMockHandler(m.ctrl)
+	m.stdout = &bytes.Buffer{}
+	m.stderr = &bytes.Buffer{}
+
+	return m
+}
+
+func setupTest(m *Mock) func() {
+	if m == nil {
+		panic("Mock not initialized")
+	}
+
+	newCli = func(config *cli.Configuration) cli.Handler {
+		m.config = config
+
+		return m.handler
+	}
+
+	return func() {
+		defer m.ctrl.Finish()
+		defer util.AssertPanic(m.t)
+	}
+}
+
+func (m *Mock) run(stdin string, args ...string) int {
+	return run(args, strings.NewReader(stdin), m.stdout, m.stderr)
+}
+
+func TestUnknownCommand(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	assert.Equal(t, 2, m.run("", "unknown"))
+	assert.Equal(t, 2, m.run(""))
+}
+
+func TestPutFromArgument(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	task := `{"name":"add"}`
+
+	m.handler.EXPECT().Init()
+	m.handler.EXPECT().Put([]byte(task)).Return(uint64(7), nil)
+	m.handler.EXPECT().Close()
+
+	assert.Equal(t, 0, m.run("", "put", "-url", "tcp://127.0.0.1:11300",
+		"-tubes", "mika, pera", "-priority", "10", "-delay", "2s", "-ttr", "1m", task))
+
+	assert.Equal(t, "7\n", m.stdout.String())
+	assert.Equal(t, "tcp://127.0.0.1:11300", m.config.Url)
+	assert.Equal(t, []string{"mika", "pera"}, m.config.Tubes)
+	assert.Equal(t, uint32(10), m.config.PutPriority)
+	assert.Equal(t, time.Second*2, m.config.PutDelay)
+	assert.Equal(t, time.Minute, m.config.PutTtr)
+}
+
+func TestPutFromStdin(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	tasks := `{"name":"add"}
+{"name":"sub"}`
+
+	m.handler.EXPECT().Init()
+	m.handler.EXPECT().PutBulk([]byte(tasks)).Return([]*cli.PutResult{
+		{Item: 1, Id: 8}, {Item: 2, Id: 9, Tube: "math"}}, nil)
+	m.handler.EXPECT().Close()
+
+	assert.Equal(t, 0, m.run(tasks, "put"))
+	assert.Contains(t, m.stdout.String(), "2     9   math")
+}
+
+func TestPutFromFile(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	m.handler.EXPECT().Init()
+	m.handler.EXPECT().PutFromFile().Return([]*cli.PutResult{
+		{Item: 1, Id: 9}, {Item: 2, Err: errors.New("Task(2) name not specified")}}, nil)
+	m.handler.EXPECT().Close()
+
+	//failed entry is reported and exit code is non-zero
+	assert.Equal(t, 1, m.run("", "put", "-file", "tasks.json"))
+	assert.Equal(t, "tasks.json", m.config.TaskDataFile)
+	assert.Contains(t, m.stdout.String(), "Task(2) name not specified")
+}
+
+func TestDelete(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	m.handler.EXPECT().Init()
+	m.handler.EXPECT().Delete(uint64(13))
+	m.handler.EXPECT().Close()
+
+	assert.Equal(t, 0, m.run("", "delete", "13"))
+}
+
+func TestDeleteInvalidId(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	assert.Equal(t, 1, m.run("", "delete", "mika"))
+	assert.Equal(t, 2, m.run("", "delete"))
+	assert.Contains(t, m.stderr.String(), "Usage of delete")
+}
+
+func TestConfigInit(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	m.handler.EXPECT().WriteDefaultConfiguration(m.stdout)
+
+	assert.Equal(t, 0, m.run("", "config", "init"))
+	assert.Equal(t, 2, m.run("", "config"))
+	assert.Contains(t, m.stderr.String(), "Usage: task-queue config init")
+}
+
+func TestDeadLetterList(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	m.handler.EXPECT().Init()
+	m.handler.EXPECT().DeadLetters().Return([]*common.DeadLetter{
+		{Id: 14, JobId: 13, Tube: "default", Attempts: 2, Error: "failed"}}, nil)
+	m.handler.EXPECT().Close()
+
+	assert.Equal(t, 0, m.run("", "dead-letter", "list", "-dead-letter-tube", "dead"))
+	assert.Equal(t, "dead", m.config.DeadLetterTube)
+	assert.Contains(t, m.stdout.String(), "failed")
+}
+
+func TestDeadLetterRequeue(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	m.handler.EXPECT().Init()
+	m.handler.EXPECT().Requeue(uint64(14)).Return(uint64(15), nil)
+	m.handler.EXPECT().Close()
+
+	assert.Equal(t, 0, m.run("", "dead-letter", "requeue", "14"))
+	assert.Equal(t, "15\n", m.stdout.String())
+	assert.Equal(t, 2, m.run("", "dead-letter", "unknown"))
+	assert.Contains(t, m.stderr.String(), `unknown dead-letter command "unknown"`)
+}
+
+func TestResult(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	m.handler.EXPECT().Init()
+	m.handler.EXPECT().Result(uint64(7)).Return(
+		&result.Record{JobId: 7, TaskName: "add", Status: result.StatusSuccess}, nil)
+	m.handler.EXPECT().Close()
+
+	assert.Equal(t, 0, m.run("", "result", "-url", "tcp://127.0.0.1:11300", "-result-dir", "results", "7"))
+	assert.Equal(t, "results", m.config.ResultDir)
+	assert.Contains(t, m.stdout.String(), `"status": "success"`)
+}
+
+func TestWorker(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	m.handler.EXPECT().Init()
+	m.handler.EXPECT().Start(gomock.Any())
+	m.handler.EXPECT().Close()
+
+	assert.Equal(t, 0, m.run("", "worker", "-url", "tcp://127.0.0.1:11300", "-http-addr", ":9090"))
+	assert.Equal(t, ":9090", m.config.HttpAddr)
+}
+
+func TestTubes(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	m.handler.EXPECT().Init()
+	m.handler.EXPECT().ListTubes().Return([]string{"default", "mika"}, nil)
+	m.handler.EXPECT().Close()
+
+	assert.Equal(t, 0, m.run("", "tubes", "-format", "json"))
+	assert.JSONEq(t, `["default","mika"]`, m.stdout.String())
+}
+
+func TestStats(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	m.handler.EXPECT().Init().Times(2)
+	m.handler.EXPECT().Stats().Return(&consumer.ServerStats{Tubes: 2, Version: "1.12"}, nil)
+	m.handler.EXPECT().StatsTube("mika").Return(&consumer.TubeStats{Name: "mika", Buried: 3}, nil)
+	m.handler.EXPECT().Close().Times(2)
+
+	assert.Equal(t, 0, m.run("", "stats"))
+	assert.Contains(t, m.stdout.String(), "Version:     1.12")
+
+	m.stdout.Reset()
+
+	assert.Equal(t, 0, m.run("", "stats", "-format", "json", "mika"))
+	assert.Contains(t, m.stdout.String(), `"buried": 3`)
+}
+
+func TestPeek(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	m.handler.EXPECT().Init().Times(3)
+	m.handler.EXPECT().Peek("buried", "mika").Return(&cli.Job{Id: 13,
+		Stats: &consumer.JobStats{Tube: "mika", State: "buried", Ttr: time.Minute}, Body: []byte("job")}, nil).Times(2)
+	m.handler.EXPECT().Peek("ready", "mika").Return(&cli.Job{Id: 14,
+		Stats: &consumer.JobStats{Tube: "mika", State: "ready"}, Body: []byte(`{"name":"add"}`)}, nil)
+	m.handler.EXPECT().Close().Times(3)
+
+	assert.Equal(t, 0, m.run("", "peek", "buried", "mika"))
+	assert.Contains(t, m.stdout.String(), "State:     buried")
+	assert.Contains(t, m.stdout.String(), "Body:      job")
+
+	//JSON body is written as is, other body as string and durations in seconds
+	m.stdout.Reset()
+
+	assert.Equal(t, 0, m.run("", "peek", "-format", "json", "buried", "mika"))
+	assert.Contains(t, m.stdout.String(), `"body": "job"`)
+	assert.Contains(t, m.stdout.String(), `"ttr": 60`)
+
+	m.stdout.Reset()
+
+	assert.Equal(t, 0, m.run("", "peek", "-format", "json", "ready", "mika"))
+	assert.Contains(t, m.stdout.String(), `"name": "add"`)
+
+	assert.Equal(t, 2, m.run("", "peek", "buried"))
+}
+
+func TestKick(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	m.handler.EXPECT().Init().Times(2)
+	m.handler.EXPECT().Kick("mika", 10).Return(4, nil)
+	m.handler.EXPECT().KickJob(uint64(13))
+	m.handler.EXPECT().Close().Times(2)
+
+	assert.Equal(t, 0, m.run("", "kick", "mika", "10"))
+	assert.Equal(t, "4\n", m.stdout.String())
+	assert.Equal(t, 0, m.run("", "kick-job", "13"))
+	assert.Equal(t, 1, m.run("", "kick", "mika", "all"))
+}
+
+func TestPause(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	m.handler.EXPECT().Init()
+	m.handler.EXPECT().PauseTube("mika", time.Minute)
+	m.handler.EXPECT().Close()
+
+	assert.Equal(t, 0, m.run("", "pause", "mika", "1m"))
+	assert.Equal(t, 1, m.run("", "pause", "mika", "soon"))
+}
+
+func TestExport(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	m.handler.EXPECT().Init()
+	m.handler.EXPECT().Export("mika", m.stdout).Return(2, nil)
+	m.handler.EXPECT().Close()
+
+	assert.Equal(t, 0, m.run("", "export", "-copy", "mika"))
+	assert.True(t, m.config.ExportCopy)
+	assert.Equal(t, 2, m.run("", "export"))
+}
+
+func TestImport(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	archive := `{"tube":"mika","state":"ready"}`
+
+	m.handler.EXPECT().Init()
+	m.handler.EXPECT().Import(gomock.Any()).DoAndReturn(func(r io.Reader) (int, error) {
+		data, err := ioutil.ReadAll(r)
+
+		assert.Nil(t, err)
+		assert.Equal(t, archive, string(data))
+
+		return 1, nil
+	})
+	m.handler.EXPECT().Close()
+
+	assert.Equal(t, 0, m.run(archive, "import", "-dry-run", "-tube", "pera", "-rate", "10"))
+	assert.Equal(t, "1\n", m.stdout.String())
+	assert.True(t, m.config.ImportDryRun)
+	assert.Equal(t, "pera", m.config.ImportTube)
+	assert.Equal(t, float64(10), m.config.ImportRate)
+}
+
+func TestWatch(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	connectionH := cmocks.NewMockHandler(m.ctrl)
+
+	server := httptest.NewServer(connection.NewTubesHandler(connectionH))
+	defer server.Close()
+
+	connectionH.EXPECT().Watch("pera")
+	connectionH.EXPECT().Ignore("mika")
+	connectionH.EXPECT().WatchedTubes().Return([]string{"mika", "pera"}).Times(2)
+	connectionH.EXPECT().WatchedTubes().Return([]string{"pera"})
+
+	assert.Equal(t, 0, m.run("", "watching", "-worker", server.URL))
+	assert.Equal(t, "mika\npera\n", m.stdout.String())
+
+	m.stdout.Reset()
+
+	assert.Equal(t, 0, m.run("", "watch", "-worker", server.URL, "-format", "json", "pera"))
+	assert.JSONEq(t, `["mika","pera"]`, m.stdout.String())
+
+	m.stdout.Reset()
+
+	assert.Equal(t, 0, m.run("", "ignore", "-worker", server.URL, "mika"))
+	assert.Equal(t, "pera\n", m.stdout.String())
+
+	assert.Equal(t, 2, m.run("", "ignore", "-worker", server.URL))
+}
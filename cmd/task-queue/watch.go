@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/mnikita/task-queue/pkg/connection"
+	"io"
+	"text/tabwriter"
+)
+
+//newWatchFlagSet creates flag set of commands changing watched tubes of running worker
+func newWatchFlagSet(name string, worker *string, format *string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(worker, "worker", "127.0.0.1:9091", "admin HTTP server address of running worker, see worker -admin-addr")
+	fs.StringVar(format, "format", formatTable, "output format, "+formatTable+" or "+formatJson)
+
+	return fs
+}
+
+//runWatchCommand sends watched tubes request to running worker and writes watched tubes
+func runWatchCommand(name string, nArgs int, args []string, stdout io.Writer, stderr io.Writer,
+	request func(client *connection.TubesClient, tube string) ([]string, error)) error {
+
+	var worker, format string
+
+	fs := newWatchFlagSet(name, &worker, &format, stderr)
+
+	if err := parseArgs(fs, args, nArgs, nArgs); err != nil {
+		return err
+	}
+
+	tubes, err := request(connection.NewTubesClient(worker), fs.Arg(0))
+
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(stdout, format, tubes, func(tw *tabwriter.Writer) {
+		for _, tube := range tubes {
+			_, _ = fmt.Fprintln(tw, tube)
+		}
+	})
+}
+
+func runWatching(args []string, _ io.Reader, stdout io.Writer, stderr io.Writer) error {
+	return runWatchCommand("watching", 0, args, stdout, stderr, func(client *connection.TubesClient, _ string) ([]string, error) {
+		return client.WatchedTubes()
+	})
+}
+
+func runWatch(args []string, _ io.Reader, stdout io.Writer, stderr io.Writer) error {
+	return runWatchCommand("watch", 1, args, stdout, stderr, (*connection.TubesClient).Watch)
+}
+
+func runIgnore(args []string, _ io.Reader, stdout io.Writer, stderr io.Writer) error {
+	return runWatchCommand("ignore", 1, args, stdout, stderr, (*connection.TubesClient).Ignore)
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/google/wire"
 	"github.com/mnikita/task-queue/pkg/connection"
 	"github.com/mnikita/task-queue/pkg/consumer"
+	"time"
 )
 
 var WireSet = wire.NewSet(NewDialer, NewConfiguration)
@@ -12,20 +13,22 @@ var WireSet = wire.NewSet(NewDialer, NewConfiguration)
 const NetworkTcp = "tcp"
 
 type Configuration struct {
-	Addr  string
-	Tubes []string
 }
 
+//BeanstakldDialer keeps no state of dialed connections, so it is shared by concurrent dials
 type BeanstakldDialer struct {
 	*Configuration
-
-	handler *gob.Conn
 }
 
 type TubeAdapter struct {
 	*gob.Tube
 }
 
+//ConnAdapter extends beanstalkd connection with operations on named tubes
+type ConnAdapter struct {
+	*gob.Conn
+}
+
 func NewConfiguration() *Configuration {
 	return &Configuration{}
 }
@@ -39,21 +42,81 @@ func (ta *TubeAdapter) Name() string {
 }
 
 func (b *BeanstakldDialer) Dial(addr string, tubes []string) (consumer.ConnectionHandler, error) {
-	//check for ENV
-	b.Addr = addr
-	b.Tubes = tubes
+	handler, err := gob.DialTimeout(NetworkTcp, addr, gob.DefaultDialTimeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConnAdapter{Conn: handler}, nil
+}
+
+func (b *BeanstakldDialer) CreateChannels(handler consumer.ConnectionHandler, tubes []string) connection.Channels {
+	return gob.NewTubeSet(handler.(*ConnAdapter).Conn, tubes...)
+}
+
+func (b *BeanstakldDialer) CreateChannel(handler consumer.ConnectionHandler, tube string) connection.Channel {
+	return &TubeAdapter{Tube: &gob.Tube{Conn: handler.(*ConnAdapter).Conn, Name: tube}}
+}
+
+func (c *ConnAdapter) PutTube(tube string, body []byte, pri uint32, delay, ttr time.Duration) (id uint64, err error) {
+	return c.tube(tube).Put(body, pri, delay, ttr)
+}
+
+func (c *ConnAdapter) ReserveTube(tube string, timeout time.Duration) (id uint64, body []byte, err error) {
+	return gob.NewTubeSet(c.Conn, tube).Reserve(timeout)
+}
+
+func (c *ConnAdapter) tube(name string) *gob.Tube {
+	return &gob.Tube{Conn: c.Conn, Name: name}
+}
+
+func (c *ConnAdapter) PeekReady(tube string) (id uint64, body []byte, err error) {
+	return c.tube(tube).PeekReady()
+}
 
-	var err error
+func (c *ConnAdapter) PeekDelayed(tube string) (id uint64, body []byte, err error) {
+	return c.tube(tube).PeekDelayed()
+}
 
-	b.handler, err = gob.DialTimeout(NetworkTcp, addr, gob.DefaultDialTimeout)
+func (c *ConnAdapter) PeekBuried(tube string) (id uint64, body []byte, err error) {
+	return c.tube(tube).PeekBuried()
+}
 
-	return b.handler, err
+func (c *ConnAdapter) Kick(tube string, bound int) (n int, err error) {
+	return c.tube(tube).Kick(bound)
 }
 
-func (b *BeanstakldDialer) CreateChannels() connection.Channels {
-	return gob.NewTubeSet(b.handler, b.Tubes...)
+func (c *ConnAdapter) PauseTube(tube string, delay time.Duration) error {
+	return c.tube(tube).Pause(delay)
 }
 
-func (b *BeanstakldDialer) CreateChannel() connection.Channel {
-	return &TubeAdapter{Tube: &gob.Tube{Conn: b.handler, Name: b.Tubes[0]}}
+func (c *ConnAdapter) StatsJob(id uint64) (*consumer.JobStats, error) {
+	stats, err := c.Conn.StatsJob(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return consumer.ParseJobStats(stats)
+}
+
+func (c *ConnAdapter) StatsTube(tube string) (*consumer.TubeStats, error) {
+	stats, err := c.tube(tube).Stats()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return consumer.ParseTubeStats(stats)
+}
+
+func (c *ConnAdapter) Stats() (*consumer.ServerStats, error) {
+	stats, err := c.Conn.Stats()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return consumer.ParseServerStats(stats)
 }
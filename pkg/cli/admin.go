@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"encoding/json"
+	"github.com/mnikita/task-queue/pkg/consumer"
+	"github.com/mnikita/task-queue/pkg/log"
+	"time"
+)
+
+//Job states accepted by Peek
+const (
+	StateReady   = "ready"
+	StateDelayed = "delayed"
+	StateBuried  = "buried"
+)
+
+//Job describes job body together with its stats
+type Job struct {
+	Id    uint64             `json:"id"`
+	Stats *consumer.JobStats `json:"stats"`
+	Body  []byte             `json:"body"`
+}
+
+//MarshalJSON writes JSON body as is and other body as string
+func (j *Job) MarshalJSON() ([]byte, error) {
+	var body interface{} = string(j.Body)
+
+	if json.Valid(j.Body) {
+		body = json.RawMessage(j.Body)
+	}
+
+	return json.Marshal(struct {
+		Id    uint64             `json:"id"`
+		Stats *consumer.JobStats `json:"stats"`
+		Body  interface{}        `json:"body"`
+	}{j.Id, j.Stats, body})
+}
+
+func (cli *Cli) job(id uint64, body []byte) (*Job, error) {
+	stats, err := cli.container.ConnectionHandler().StatsJob(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Job{Id: id, Stats: stats, Body: body}, nil
+}
+
+//ListTubes lists existing tubes
+func (cli *Cli) ListTubes() ([]string, error) {
+	return cli.container.ConnectionHandler().ListTubes()
+}
+
+func (cli *Cli) Stats() (*consumer.ServerStats, error) {
+	return cli.container.ConnectionHandler().Stats()
+}
+
+func (cli *Cli) StatsTube(tube string) (*consumer.TubeStats, error) {
+	return cli.container.ConnectionHandler().StatsTube(tube)
+}
+
+//Peek returns job of the tube in given state, which would be reserved or kicked next
+func (cli *Cli) Peek(state string, tube string) (*Job, error) {
+	ch := cli.container.ConnectionHandler()
+
+	var peek func(tube string) (uint64, []byte, error)
+
+	switch state {
+	case StateReady:
+		peek = ch.PeekReady
+	case StateDelayed:
+		peek = ch.PeekDelayed
+	case StateBuried:
+		peek = ch.PeekBuried
+	default:
+		return nil, log.UnknownPeekStateError(state)
+	}
+
+	id, body, err := peek(tube)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cli.job(id, body)
+}
+
+//Job returns job body and stats
+func (cli *Cli) Job(id uint64) (*Job, error) {
+	body, err := cli.container.ConnectionHandler().Peek(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cli.job(id, body)
+}
+
+//Kick moves up to bound buried, or delayed if none are buried, jobs of the tube into ready queue
+func (cli *Cli) Kick(tube string, bound int) (int, error) {
+	return cli.container.ConnectionHandler().Kick(tube, bound)
+}
+
+func (cli *Cli) KickJob(id uint64) error {
+	return cli.container.ConnectionHandler().KickJob(id)
+}
+
+//PauseTube delays reserving jobs from the tube
+func (cli *Cli) PauseTube(tube string, delay time.Duration) error {
+	return cli.container.ConnectionHandler().PauseTube(tube, delay)
+}
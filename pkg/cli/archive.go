@@ -0,0 +1,348 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/mnikita/task-queue/pkg/consumer"
+	"github.com/mnikita/task-queue/pkg/log"
+	"io"
+	"time"
+)
+
+//ArchivedJob is one line of NDJSON archive written by Export and read by Import
+type ArchivedJob struct {
+	//Id of the job on the exporting server
+	Id uint64 `json:"id"`
+
+	Tube     string        `json:"tube"`
+	State    string        `json:"state"`
+	Priority uint32        `json:"priority"`
+	Ttr      time.Duration `json:"ttr"`
+
+	//Remaining delay of delayed job
+	Delay time.Duration `json:"delay,omitempty"`
+
+	Body []byte `json:"body"`
+}
+
+const (
+	//Pause of drained tube, renewed while export runs
+	exportPause = time.Minute
+
+	//Delay keeping probe job of scanned tube from being reserved before it is deleted
+	exportProbeDelay = time.Hour
+)
+
+//exportedStates lists job states in order of export
+var exportedStates = []string{StateReady, StateDelayed, StateBuried}
+
+func archivedJob(job *Job) *ArchivedJob {
+	a := &ArchivedJob{Id: job.Id, Tube: job.Stats.Tube, State: job.Stats.State,
+		Priority: job.Stats.Priority, Ttr: job.Stats.Ttr, Body: job.Body}
+
+	if a.State == StateDelayed {
+		a.Delay = job.Stats.TimeLeft
+	}
+
+	return a
+}
+
+func hasState(states []string, state string) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+
+	return false
+}
+
+//Export writes ready, delayed and buried jobs of the tube to NDJSON archive.
+//Jobs are deleted after they are written unless ExportCopy is set.
+//Drained tube is paused until export finishes
+func (cli *Cli) Export(tube string, w io.Writer) (n int, err error) {
+	encoder := json.NewEncoder(w)
+
+	write := func(job *Job) error {
+		if err := encoder.Encode(archivedJob(job)); err != nil {
+			return err
+		}
+
+		log.Logger().CliJobExported(job.Id, job.Stats.State, tube)
+
+		n++
+
+		return nil
+	}
+
+	if cli.ExportCopy {
+		return n, cli.exportCopy(tube, write)
+	}
+
+	return n, cli.exportDrain(tube, write)
+}
+
+//exportDrain writes and deletes next job in every state until tube is empty.
+//Tube is paused meanwhile, so running workers can not reserve peeked job before it is deleted
+func (cli *Cli) exportDrain(tube string, write func(job *Job) error) (err error) {
+	stats, err := cli.StatsTube(tube)
+
+	if consumer.IsNotFound(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var paused time.Time
+
+	pause := func() error {
+		paused = time.Now()
+
+		return cli.PauseTube(tube, exportPause)
+	}
+
+	if err = pause(); err != nil {
+		return err
+	}
+
+	//previous pause is restored, tube is resumed if it was not paused
+	defer func() {
+		if resumeErr := cli.PauseTube(tube, stats.PauseTimeLeft); err == nil {
+			err = resumeErr
+		}
+	}()
+
+	for _, state := range exportedStates {
+		for {
+			//pause expires if export is interrupted
+			if time.Since(paused) > exportPause/2 {
+				if err = pause(); err != nil {
+					return err
+				}
+			}
+
+			job, err := cli.Peek(state, tube)
+
+			if consumer.IsNotFound(err) {
+				break
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if err = write(job); err != nil {
+				return err
+			}
+
+			if err = cli.Delete(job.Id); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+//exportCopy writes jobs without changing the tube
+func (cli *Cli) exportCopy(tube string, write func(job *Job) error) error {
+	return cli.scanTube(tube, exportedStates, write)
+}
+
+//scanTube invokes handler for jobs of the tube in given states without reserving them.
+//Beanstalkd can not list jobs of a tube, so every job id below id of a probe job is inspected.
+//Body is read only for jobs of the tube
+func (cli *Cli) scanTube(tube string, states []string, handler func(job *Job) error) error {
+	ch := cli.container.ConnectionHandler()
+
+	last, err := cli.probeJobId(tube)
+
+	if err != nil {
+		return err
+	}
+
+	for id := uint64(1); id < last; id++ {
+		stats, err := ch.StatsJob(id)
+
+		if consumer.IsNotFound(err) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if stats.Tube != tube || !hasState(states, stats.State) {
+			continue
+		}
+
+		body, err := ch.Peek(id)
+
+		//deleted after stats were read
+		if consumer.IsNotFound(err) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err = handler(&Job{Id: id, Stats: stats, Body: body}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//probeJobId puts delayed probe job to the tube and deletes it. Job ids increase,
+//so ids of all existing jobs are lower than returned id
+func (cli *Cli) probeJobId(tube string) (uint64, error) {
+	ch := cli.container.ConnectionHandler()
+
+	id, err := ch.PutTube(tube, []byte("{}"), 0, exportProbeDelay, cli.PutTtr)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return id, ch.Delete(id)
+}
+
+//readArchive reads and validates all archived jobs
+func readArchive(r io.Reader) (jobs []*ArchivedJob, err error) {
+	reader := bufio.NewReader(r)
+
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			job := &ArchivedJob{}
+
+			if jsonErr := json.Unmarshal(data, job); jsonErr != nil {
+				return nil, log.InvalidArchivedJobError(line, jsonErr)
+			}
+
+			if !hasState(exportedStates, job.State) {
+				return nil, log.UnknownArchivedJobStateError(line, job.State)
+			}
+
+			if job.Tube == "" {
+				return nil, log.MissingArchivedJobTubeError(line)
+			}
+
+			jobs = append(jobs, job)
+		}
+
+		if err == io.EOF {
+			return jobs, nil
+		}
+	}
+}
+
+//Import puts jobs from NDJSON archive written by Export, restoring their priority,
+//remaining delay, time to run and state. Archive is validated before any job is put.
+//Jobs are put to ImportTube if set, at most ImportRate jobs per second.
+//Buried jobs are buried by reserving them, so they must be imported to a tube no worker
+//watches: a worker reserving imported job aborts import, and ready jobs reserved before it
+//are released with their reserve count increased, which counts against their retries
+func (cli *Cli) Import(r io.Reader) (n int, err error) {
+	jobs, err := readArchive(r)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if cli.ImportDryRun {
+		return len(jobs), nil
+	}
+
+	var interval time.Duration
+
+	if cli.ImportRate > 0 {
+		interval = time.Duration(float64(time.Second) / cli.ImportRate)
+	}
+
+	next := time.Now()
+
+	for _, job := range jobs {
+		if interval > 0 {
+			time.Sleep(time.Until(next))
+
+			next = next.Add(interval)
+		}
+
+		tube := job.Tube
+
+		if cli.ImportTube != "" {
+			tube = cli.ImportTube
+		}
+
+		id, err := cli.importJob(tube, job)
+
+		if err != nil {
+			return n, err
+		}
+
+		log.Logger().CliJobImported(job.Id, job.State, id, tube)
+
+		n++
+	}
+
+	return n, nil
+}
+
+func (cli *Cli) importJob(tube string, job *ArchivedJob) (uint64, error) {
+	ch := cli.container.ConnectionHandler()
+
+	if job.State != StateBuried {
+		return ch.PutTube(tube, job.Body, job.Priority, job.Delay, job.Ttr)
+	}
+
+	//put jobs can not be buried directly. Job is put most urgent, reserved and buried
+	id, err := ch.PutTube(tube, job.Body, 0, 0, job.Ttr)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return id, cli.buryImported(tube, id, job.Priority)
+}
+
+//buryImported reserves jobs of the tube until imported job is reserved and buries it.
+//Other reserved jobs are released keeping their priority. Tube can not be paused meanwhile,
+//as pause applies to reserves of the importer too
+func (cli *Cli) buryImported(tube string, id uint64, pri uint32) (err error) {
+	var reserved []uint64
+
+	defer func() {
+		for _, id := range reserved {
+			if releaseErr := cli.release(id); err == nil {
+				err = releaseErr
+			}
+		}
+	}()
+
+	ch := cli.container.ConnectionHandler()
+
+	for {
+		reservedId, _, err := ch.ReserveTube(tube, 0)
+
+		if err != nil {
+			return err
+		}
+
+		if reservedId == id {
+			return ch.Bury(id, pri)
+		}
+
+		reserved = append(reserved, reservedId)
+	}
+}
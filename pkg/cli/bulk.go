@@ -0,0 +1,208 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/mnikita/task-queue/pkg/common"
+	"github.com/mnikita/task-queue/pkg/log"
+	"sync"
+	"time"
+)
+
+//Fields of bulk task entry overriding put defaults. Fields are removed from job body
+const (
+	BulkFieldPriority = "priority"
+	BulkFieldDelay    = "delay"
+	BulkFieldTtr      = "ttr"
+	BulkFieldTube     = "tube"
+)
+
+//PutResult reports outcome of one bulk task entry
+type PutResult struct {
+	//Array index or input line of the entry, starting from 1
+	Item int
+
+	Id   uint64
+	Tube string
+	Err  error
+}
+
+//bulkEntry is unparsed task entry of bulk input
+type bulkEntry struct {
+	item int
+	data json.RawMessage
+}
+
+//bulkTask is validated task entry ready to put
+type bulkTask struct {
+	body  []byte
+	tube  string
+	pri   uint32
+	delay time.Duration
+	ttr   time.Duration
+}
+
+//putOverrides stores optional per entry put options
+type putOverrides struct {
+	Priority *uint32 `json:"priority"`
+	Delay    string  `json:"delay"`
+	Ttr      string  `json:"ttr"`
+	Tube     string  `json:"tube"`
+}
+
+//splitBulkTasks splits JSON array, single JSON task or newline-delimited JSON into task entries
+func splitBulkTasks(data []byte) ([]*bulkEntry, error) {
+	data = bytes.TrimSpace(data)
+
+	if len(data) == 0 {
+		return nil, log.EmptyBulkTasksError()
+	}
+
+	var entries []*bulkEntry
+
+	if data[0] == '[' {
+		var items []json.RawMessage
+
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, err
+		}
+
+		for i, item := range items {
+			entries = append(entries, &bulkEntry{item: i + 1, data: item})
+		}
+	} else if json.Valid(data) {
+		//single task may span multiple lines
+		entries = append(entries, &bulkEntry{item: 1, data: data})
+	} else {
+		for i, line := range bytes.Split(data, []byte("\n")) {
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				entries = append(entries, &bulkEntry{item: i + 1, data: line})
+			}
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, log.EmptyBulkTasksError()
+	}
+
+	return entries, nil
+}
+
+func parseDuration(value string, defaultValue time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	return time.ParseDuration(value)
+}
+
+//parseBulkTask validates entry against task envelope and applies its put overrides
+func (cli *Cli) parseBulkTask(entry *bulkEntry) (task *bulkTask, err error) {
+	var fields map[string]json.RawMessage
+	var overrides putOverrides
+
+	if err = json.Unmarshal(entry.data, &fields); err != nil {
+		return nil, log.InvalidBulkTaskError(entry.item, err)
+	}
+
+	if err = json.Unmarshal(entry.data, &overrides); err != nil {
+		return nil, log.InvalidBulkTaskError(entry.item, err)
+	}
+
+	task = &bulkTask{tube: overrides.Tube, pri: cli.PutPriority}
+
+	if overrides.Priority != nil {
+		task.pri = *overrides.Priority
+	}
+
+	if task.delay, err = parseDuration(overrides.Delay, cli.PutDelay); err != nil {
+		return nil, log.InvalidBulkTaskError(entry.item, err)
+	}
+
+	if task.ttr, err = parseDuration(overrides.Ttr, cli.PutTtr); err != nil {
+		return nil, log.InvalidBulkTaskError(entry.item, err)
+	}
+
+	for _, field := range []string{BulkFieldPriority, BulkFieldDelay, BulkFieldTtr, BulkFieldTube} {
+		delete(fields, field)
+	}
+
+	if task.body, err = json.Marshal(fields); err != nil {
+		return nil, log.InvalidBulkTaskError(entry.item, err)
+	}
+
+	envelope := &common.Task{}
+
+	if err = json.Unmarshal(task.body, envelope); err != nil {
+		return nil, log.InvalidBulkTaskError(entry.item, err)
+	}
+
+	if envelope.Name == "" {
+		return nil, log.MissingBulkTaskNameError(entry.item)
+	}
+
+	return task, nil
+}
+
+func (cli *Cli) putBulkTask(task *bulkTask) (uint64, error) {
+	ch := cli.container.ConnectionHandler()
+
+	if task.tube == "" {
+		return ch.Put(task.body, task.pri, task.delay, task.ttr)
+	}
+
+	return ch.PutTube(task.tube, task.body, task.pri, task.delay, task.ttr)
+}
+
+//PutBulk puts tasks from JSON array, single JSON task or newline-delimited JSON.
+//Every entry is validated and put independently, failures are reported per entry.
+//Up to PutPipeline puts are sent without waiting for previous replies
+func (cli *Cli) PutBulk(data []byte) ([]*PutResult, error) {
+	entries, err := splitBulkTasks(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*PutResult, len(entries))
+	tasks := make([]*bulkTask, len(entries))
+	queue := make(chan int, len(entries))
+
+	for i, entry := range entries {
+		tasks[i], err = cli.parseBulkTask(entry)
+
+		results[i] = &PutResult{Item: entry.item, Err: err}
+
+		if err == nil {
+			results[i].Tube = tasks[i].tube
+
+			queue <- i
+		}
+	}
+
+	close(queue)
+
+	pipeline := cli.PutPipeline
+
+	if pipeline < 1 {
+		pipeline = 1
+	}
+
+	var wg sync.WaitGroup
+
+	for n := 0; n < pipeline; n++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range queue {
+				results[i].Id, results[i].Err = cli.putBulkTask(tasks[i])
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return results, nil
+}
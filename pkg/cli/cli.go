@@ -4,8 +4,10 @@ package cli
 import (
 	"encoding/json"
 	"github.com/mnikita/task-queue/pkg/common"
+	"github.com/mnikita/task-queue/pkg/consumer"
 	"github.com/mnikita/task-queue/pkg/container"
 	"github.com/mnikita/task-queue/pkg/log"
+	"github.com/mnikita/task-queue/pkg/result"
 	"github.com/mnikita/task-queue/pkg/util"
 	"io"
 	"io/ioutil"
@@ -29,9 +31,29 @@ type Handler interface {
 	Start(OsSignalCallback) error
 	Put(taskData []byte) (uint64, error)
 	Delete(uint64) error
-	PutFromFile() (uint64, error)
+	PutFromFile() ([]*PutResult, error)
+	PutBulk(data []byte) ([]*PutResult, error)
 	WriteDefaultConfiguration(writer io.Writer) (int, error)
 	WriteDefaultConfigurationToFile(file string) (int, error)
+
+	DeadLetters() ([]*common.DeadLetter, error)
+	DeadLetter(id uint64) (*common.DeadLetter, error)
+	Requeue(id uint64) (uint64, error)
+	RequeueAll() (int, error)
+
+	Result(id uint64) (*result.Record, error)
+
+	ListTubes() ([]string, error)
+	Stats() (*consumer.ServerStats, error)
+	StatsTube(tube string) (*consumer.TubeStats, error)
+	Peek(state string, tube string) (*Job, error)
+	Job(id uint64) (*Job, error)
+	Kick(tube string, bound int) (int, error)
+	KickJob(id uint64) error
+	PauseTube(tube string, delay time.Duration) error
+
+	Export(tube string, w io.Writer) (int, error)
+	Import(r io.Reader) (int, error)
 }
 
 type Configuration struct {
@@ -43,6 +65,33 @@ type Configuration struct {
 	PutPriority uint32
 	PutDelay    time.Duration
 	PutTtr      time.Duration
+
+	//Number of bulk puts sent without waiting for previous replies
+	PutPipeline int
+
+	//Overrides dead-letter tube from consumer configuration
+	DeadLetterTube string
+
+	//Directory of file result store. Result store set in configuration file takes precedence
+	ResultDir string
+
+	//Listen address of HTTP server exposing metrics. Server address set in configuration file takes precedence
+	HttpAddr string
+
+	//Listen address of admin HTTP server changing watched tubes. Admin address set in configuration file takes precedence
+	AdminAddr string
+
+	//Export copies jobs leaving the tube unchanged instead of draining it
+	ExportCopy bool
+
+	//Tube jobs are imported to. Tube of the archived job is used if not set
+	ImportTube string
+
+	//Import validates archive without putting jobs
+	ImportDryRun bool
+
+	//Maximum number of jobs imported per second. Not limited if zero
+	ImportRate float64
 }
 
 type Cli struct {
@@ -64,6 +113,7 @@ func NewConfiguration() *Configuration {
 		PutPriority: 1024,
 		PutDelay:    0,
 		PutTtr:      time.Second * 10,
+		PutPipeline: 16,
 	}
 }
 
@@ -91,12 +141,31 @@ func (cli *Cli) Init() (err error) {
 	config.Url = cli.Url
 	config.Tubes = cli.Tubes
 
+	if cli.ResultDir != "" {
+		resultConfig := cli.container.Config().ResultConfig
+
+		resultConfig.Backend = result.BackendFile
+		resultConfig.Dir = cli.ResultDir
+	}
+
+	if cli.HttpAddr != "" {
+		cli.container.Config().ServerConfig.Addr = cli.HttpAddr
+	}
+
+	if cli.AdminAddr != "" {
+		cli.container.Config().ServerConfig.AdminAddr = cli.AdminAddr
+	}
+
 	err = cli.container.Init(cli.ConfigFile)
 
 	if err != nil {
 		return err
 	}
 
+	if cli.DeadLetterTube != "" {
+		cli.container.Config().ConsumerConfig.DeadLetterTube = cli.DeadLetterTube
+	}
+
 	return nil
 }
 
@@ -108,14 +177,15 @@ func (cli *Cli) Container() container.Handler {
 	return cli.container
 }
 
-func (cli *Cli) PutFromFile() (id uint64, err error) {
-	taskData, err := ioutil.ReadFile(cli.TaskDataFile)
+//PutFromFile puts tasks from task data file, see PutBulk
+func (cli *Cli) PutFromFile() ([]*PutResult, error) {
+	data, err := ioutil.ReadFile(cli.TaskDataFile)
 
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return cli.Put(taskData)
+	return cli.PutBulk(data)
 }
 
 func (cli *Cli) Put(taskData []byte) (id uint64, err error) {
@@ -143,10 +213,25 @@ func (cli *Cli) Delete(id uint64) error {
 	return ch.Delete(id)
 }
 
+//Result returns stored outcome of the job
+func (cli *Cli) Result(id uint64) (*result.Record, error) {
+	store := cli.container.ResultStore()
+
+	if util.IsNil(store) {
+		return nil, log.MissingResultStore()
+	}
+
+	return store.Get(id)
+}
+
 func (cli *Cli) Start(callback OsSignalCallback) (err error) {
 	w := cli.container.Worker()
 	c := cli.container.Consumer()
 
+	if err = cli.container.StartServer(); err != nil {
+		return err
+	}
+
 	w.StartWorker()
 	err = c.StartConsumer()
 
@@ -172,10 +257,13 @@ func (cli *Cli) Start(callback OsSignalCallback) (err error) {
 
 	<-done
 
-	c.StopConsumer()
+	//stop reserving new jobs, release queued tasks and wait running tasks to finish
+	c.Drain()
 	w.StopWorker()
 
-	//TODO: wait for tasks to finish or timeout
+	//task events must reach consumer before connection is closed
+	cli.container.Connector().Flush()
+	c.StopConsumer()
 
 	return nil
 }
@@ -1,13 +1,18 @@
 package cli_test
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"github.com/mnikita/task-queue/pkg/cli"
+	"github.com/mnikita/task-queue/pkg/common"
 	"github.com/mnikita/task-queue/pkg/log"
+	"github.com/mnikita/task-queue/pkg/memory"
 	"github.com/mnikita/task-queue/pkg/util"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"os"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -114,6 +119,69 @@ func TestContainerStart(t *testing.T) {
 	log.Logger().Info("TEST: Done.")
 }
 
+func TestMemoryContainerStart(t *testing.T) {
+	broker := memory.NewBroker(memory.NewConfiguration())
+
+	config := cli.NewConfiguration()
+	config.Url = "memory://"
+	config.Tubes = []string{"default"}
+
+	m := newMock2(t)
+	m.cli = cli.InitializeMemoryCli(config, broker)
+
+	assert.Nil(t, m.cli.Init())
+
+	signals := make(chan chan os.Signal, 1)
+	done := make(chan bool)
+
+	go func() {
+		err := m.cli.Start(func(c chan os.Signal) {
+			signals <- c
+		})
+
+		assert.Nil(t, err)
+
+		done <- true
+	}()
+
+	time.Sleep(time.Millisecond * 100)
+
+	td, err := readTestData()
+
+	if err != nil {
+		panic(err)
+	}
+
+	ids := make([]uint64, len(td))
+
+	for i, tds := range td {
+		ids[i], err = m.cli.Put(tds)
+
+		assert.Nil(t, err)
+	}
+
+	//wait for long task to finish
+	time.Sleep(time.Second)
+
+	conn := broker.Connect()
+
+	//successful tasks are deleted
+	for _, id := range ids[:2] {
+		_, err = conn.Peek(id)
+		assert.EqualError(t, err, "peek: not found")
+	}
+
+	//error task is buried without retry policy
+	stats, err := conn.StatsJob(ids[2])
+	assert.Nil(t, err)
+	assert.Equal(t, memory.StateBuried, stats.State)
+
+	(<-signals) <- syscall.SIGINT
+	<-done
+
+	assert.Nil(t, m.cli.Close())
+}
+
 func readTestData() (testdata []json.RawMessage, err error) {
 	//TODO: read from test volume or test path (Docker and local testing)
 	bytes, err := ioutil.ReadFile("../test/data/integration_test_tasks.json")
@@ -126,3 +194,217 @@ func readTestData() (testdata []json.RawMessage, err error) {
 
 	return testdata, err
 }
+
+func TestMemoryPutBulk(t *testing.T) {
+	broker := memory.NewBroker(memory.NewConfiguration())
+
+	config := cli.NewConfiguration()
+	config.Url = "memory://"
+	config.Tubes = []string{"default"}
+	config.TaskDataFile = "../test/data/integration_test_tasks.json"
+
+	m := newMock2(t)
+	m.cli = cli.InitializeMemoryCli(config, broker)
+
+	assert.Nil(t, m.cli.Init())
+
+	results, err := m.cli.PutFromFile()
+	assert.Nil(t, err)
+	assert.Len(t, results, 3)
+
+	for i, r := range results {
+		assert.Equal(t, i+1, r.Item)
+		assert.Nil(t, r.Err)
+	}
+
+	tasks := `{"name":"add","priority":5,"ttr":"1m","tube":"math"}
+
+{"name":"add","delay":"1h"}
+{"payload":1}
+{"name":
+`
+
+	results, err = m.cli.PutBulk([]byte(tasks))
+	assert.Nil(t, err)
+	assert.Len(t, results, 4)
+
+	conn := broker.Connect()
+
+	//overrides are applied and removed from job body
+	stats, _ := conn.StatsJob(results[0].Id)
+	assert.Equal(t, "math", stats.Tube)
+	assert.Equal(t, uint32(5), stats.Priority)
+	assert.Equal(t, time.Minute, stats.Ttr)
+
+	body, _ := conn.Peek(results[0].Id)
+	assert.JSONEq(t, `{"name":"add"}`, string(body))
+
+	assert.Equal(t, 3, results[1].Item)
+	stats, _ = conn.StatsJob(results[1].Id)
+	assert.Equal(t, "default", stats.Tube)
+	assert.Equal(t, memory.StateDelayed, stats.State)
+
+	assert.Equal(t, log.MissingBulkTaskNameError(4), results[2].Err)
+	assert.Equal(t, 5, results[3].Item)
+	assert.NotNil(t, results[3].Err)
+
+	_, err = m.cli.PutBulk([]byte(" \n"))
+	assert.Equal(t, log.EmptyBulkTasksError(), err)
+
+	assert.Nil(t, m.cli.Close())
+}
+
+func newMemoryCli(t *testing.T, broker *memory.Broker, config *cli.Configuration) cli.Handler {
+	config.Url = "memory://"
+	config.Tubes = []string{"default"}
+
+	handler := cli.InitializeMemoryCli(config, broker)
+
+	assert.Nil(t, handler.Init())
+
+	return handler
+}
+
+func TestMemoryExportImport(t *testing.T) {
+	source := memory.NewBroker(memory.NewConfiguration())
+	conn := source.Connect()
+
+	ready, _ := conn.PutTube("mika", []byte(`{"name":"ready"}`), 5, 0, time.Minute)
+	_, _ = conn.PutTube("mika", []byte(`{"name":"delayed"}`), 6, time.Hour, time.Minute)
+	buried, _ := conn.PutTube("mika", []byte(`{"name":"buried"}`), 7, 0, time.Minute)
+	_, _ = conn.PutTube("pera", []byte(`{"name":"other"}`), 5, 0, time.Minute)
+
+	_, _, _ = conn.ReserveTube("mika", 0)
+	_, _, _ = conn.ReserveTube("mika", 0)
+	assert.Nil(t, conn.Bury(buried, 7))
+	assert.Nil(t, conn.Release(ready, 5, 0))
+
+	config := cli.NewConfiguration()
+	config.ExportCopy = true
+
+	exporter := newMemoryCli(t, source, config)
+
+	//copy leaves tube unchanged
+	var archive bytes.Buffer
+
+	n, err := exporter.Export("mika", &archive)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+
+	stats, _ := conn.StatsTube("mika")
+	assert.Equal(t, 3, stats.Ready+stats.Delayed+stats.Buried)
+
+	config.ExportCopy = false
+	archive.Reset()
+
+	n, err = exporter.Export("mika", &archive)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+
+	//drained tube is paused while exported and resumed afterwards
+	stats, _ = conn.StatsTube("mika")
+	assert.Equal(t, 0, stats.Ready+stats.Delayed+stats.Buried)
+	assert.Equal(t, 2, stats.Pauses)
+	assert.Equal(t, time.Duration(0), stats.PauseTimeLeft)
+
+	n, err = exporter.Export("laza", &archive)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	assert.Nil(t, exporter.Close())
+
+	target := memory.NewBroker(memory.NewConfiguration())
+
+	config = cli.NewConfiguration()
+	config.ImportDryRun = true
+	config.ImportTube = "laza"
+	config.ImportRate = 1000
+
+	importer := newMemoryCli(t, target, config)
+
+	n, err = importer.Import(bytes.NewReader(archive.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+
+	_, err = target.Connect().StatsTube("laza")
+	assert.NotNil(t, err)
+
+	config.ImportDryRun = false
+
+	n, err = importer.Import(bytes.NewReader(archive.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+
+	stats, _ = target.Connect().StatsTube("laza")
+	assert.Equal(t, 1, stats.Ready)
+	assert.Equal(t, 1, stats.Delayed)
+	assert.Equal(t, 1, stats.Buried)
+
+	id, body, _ := target.Connect().PeekBuried("laza")
+	assert.Equal(t, `{"name":"buried"}`, string(body))
+
+	jobStats, _ := target.Connect().StatsJob(id)
+	assert.Equal(t, uint32(7), jobStats.Priority)
+	assert.Equal(t, time.Minute, jobStats.Ttr)
+
+	_, err = importer.Import(strings.NewReader(`{"tube":"mika","state":"reserved"}`))
+	assert.Equal(t, log.UnknownArchivedJobStateError(1, "reserved"), err)
+
+	assert.Nil(t, importer.Close())
+}
+
+func TestMemoryKeepAlive(t *testing.T) {
+	common.RegisterTask("KeepAlive", func() common.TaskHandler {
+		return common.NewBaseTaskHandler(func(_ context.Context, _ interface{}, _ *common.Task,
+			_ common.TaskProcessEventHandler) error {
+			time.Sleep(time.Millisecond * 1500)
+
+			return nil
+		})
+	})
+
+	broker := memory.NewBroker(memory.NewConfiguration())
+
+	//default consumer configuration does not read job stats
+	config := cli.NewConfiguration()
+	config.PutTtr = time.Second
+
+	m := newMock2(t)
+	m.cli = newMemoryCli(t, broker, config)
+
+	signals := make(chan chan os.Signal, 1)
+	done := make(chan bool)
+
+	go func() {
+		err := m.cli.Start(func(c chan os.Signal) {
+			signals <- c
+		})
+
+		assert.Nil(t, err)
+
+		done <- true
+	}()
+
+	id, err := m.cli.Put([]byte(`{"name":"KeepAlive"}`))
+	assert.Nil(t, err)
+
+	//job running longer than time to run is touched and stays reserved once
+	time.Sleep(time.Millisecond * 1300)
+
+	conn := broker.Connect()
+
+	stats, err := conn.StatsJob(id)
+	assert.Nil(t, err)
+	assert.Equal(t, memory.StateReserved, stats.State)
+	assert.Equal(t, 1, stats.Reserves)
+
+	time.Sleep(time.Second)
+
+	_, err = conn.Peek(id)
+	assert.EqualError(t, err, "peek: not found")
+
+	(<-signals) <- syscall.SIGINT
+	<-done
+
+	assert.Nil(t, m.cli.Close())
+}
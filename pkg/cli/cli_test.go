@@ -2,14 +2,20 @@
 package cli_test
 
 import (
+	"errors"
 	"github.com/golang/mock/gomock"
 	"github.com/mnikita/task-queue/pkg/cli"
 	"github.com/mnikita/task-queue/pkg/cli/mocks"
+	"github.com/mnikita/task-queue/pkg/common"
 	"github.com/mnikita/task-queue/pkg/connection"
 	ccmocks "github.com/mnikita/task-queue/pkg/connection/mocks"
+	nmocks "github.com/mnikita/task-queue/pkg/connector/mocks"
+	"github.com/mnikita/task-queue/pkg/consumer"
 	cmocks "github.com/mnikita/task-queue/pkg/consumer/mocks"
 	"github.com/mnikita/task-queue/pkg/container"
 	lmocks "github.com/mnikita/task-queue/pkg/container/mocks"
+	"github.com/mnikita/task-queue/pkg/log"
+	"github.com/mnikita/task-queue/pkg/result"
 	"github.com/mnikita/task-queue/pkg/util"
 	wmocks "github.com/mnikita/task-queue/pkg/worker/mocks"
 	"github.com/stretchr/testify/assert"
@@ -149,27 +155,225 @@ func TestStart(t *testing.T) {
 
 	worker := wmocks.NewMockHandler(m.ctrl)
 	consumer := cmocks.NewMockHandler(m.ctrl)
+	connector := nmocks.NewMockHandler(m.ctrl)
 
+	m.handler.EXPECT().StartServer()
 	worker.EXPECT().StartWorker()
-	worker.EXPECT().StopWorker()
-
 	consumer.EXPECT().StartConsumer()
-	consumer.EXPECT().StopConsumer()
+
+	gomock.InOrder(
+		consumer.EXPECT().Drain(),
+		worker.EXPECT().StopWorker(),
+		connector.EXPECT().Flush(),
+		consumer.EXPECT().StopConsumer(),
+	)
 
 	m.handler.EXPECT().Worker().Return(worker)
 	m.handler.EXPECT().Consumer().Return(consumer)
+	m.handler.EXPECT().Connector().Return(connector)
 
-	var ch chan os.Signal
+	signals := make(chan chan os.Signal, 1)
 
 	go func() {
 		err := m.cli.Start(func(c chan os.Signal) {
-			ch = c
+			signals <- c
 		})
 
 		assert.Nil(t, err)
 	}()
 
 	time.Sleep(time.Millisecond * 100)
-	ch <- syscall.SIGINT
+	(<-signals) <- syscall.SIGINT
 	time.Sleep(time.Millisecond * 100)
 }
+
+func newDeadLetterMock(t *testing.T) (*Mock, *cmocks.MockConnectionHandler) {
+	var config = cli.NewConfiguration()
+	config.Url = "mock"
+
+	m := newMock(t, config)
+
+	ch := cmocks.NewMockConnectionHandler(m.ctrl)
+
+	cc := &container.Configuration{ConsumerConfig: consumer.NewConfiguration()}
+	cc.ConsumerConfig.DeadLetterTube = "dead"
+
+	m.handler.EXPECT().Config().Return(cc).AnyTimes()
+	m.handler.EXPECT().ConnectionHandler().Return(ch).AnyTimes()
+
+	return m, ch
+}
+
+func TestDeadLetters(t *testing.T) {
+	m, ch := newDeadLetterMock(t)
+	defer setupTest(m)()
+
+	notFound := errors.New("stats-job: not found")
+
+	//jobs below probe job id are inspected, dead letters are peeked without reserving them
+	gomock.InOrder(
+		ch.EXPECT().PutTube("dead", []byte("{}"), uint32(0), time.Hour, m.PutTtr).Return(uint64(17), nil),
+		ch.EXPECT().Delete(uint64(17)),
+	)
+
+	for id := uint64(1); id < 14; id++ {
+		ch.EXPECT().StatsJob(id).Return(nil, notFound)
+	}
+
+	ch.EXPECT().StatsJob(uint64(14)).Return(&consumer.JobStats{Tube: "dead", State: cli.StateBuried}, nil)
+	ch.EXPECT().Peek(uint64(14)).Return(
+		[]byte(`{"job_id": 13, "tube": "default", "attempts": 2, "error": "failed"}`), nil)
+	ch.EXPECT().StatsJob(uint64(15)).Return(&consumer.JobStats{Tube: "default", State: cli.StateReady}, nil)
+	ch.EXPECT().StatsJob(uint64(16)).Return(&consumer.JobStats{Tube: "dead", State: "reserved"}, nil)
+
+	letters, err := m.cli.DeadLetters()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []*common.DeadLetter{{Id: 14, JobId: 13, Tube: "default", Attempts: 2,
+		Error: "failed"}}, letters)
+}
+
+func TestRequeue(t *testing.T) {
+	m, ch := newDeadLetterMock(t)
+	defer setupTest(m)()
+
+	body := []byte(`{"name":"add"}`)
+
+	ch.EXPECT().Peek(uint64(14)).Return(
+		[]byte(`{"job_id": 13, "tube": "default", "body": "eyJuYW1lIjoiYWRkIn0="}`), nil)
+	ch.EXPECT().StatsJob(uint64(14)).Return(&consumer.JobStats{Priority: 10, Ttr: time.Minute}, nil)
+	ch.EXPECT().PutTube("default", body, uint32(10), m.PutDelay, time.Minute).Return(uint64(15), nil)
+	ch.EXPECT().Delete(uint64(14))
+
+	id, err := m.cli.Requeue(uint64(14))
+
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(15), id)
+}
+
+func TestRequeueAll(t *testing.T) {
+	m, ch := newDeadLetterMock(t)
+	defer setupTest(m)()
+
+	gomock.InOrder(
+		ch.EXPECT().ReserveTube("dead", time.Duration(0)).Return(
+			uint64(14), []byte(`{"job_id": 13, "tube": "default", "body": "eyJuYW1lIjoiYWRkIn0="}`), nil),
+		ch.EXPECT().StatsJob(uint64(14)).Return(&consumer.JobStats{Priority: 10, Ttr: time.Minute}, nil),
+		ch.EXPECT().PutTube("default", gomock.Any(), uint32(10), m.PutDelay, time.Minute).Return(uint64(15), nil),
+		ch.EXPECT().Delete(uint64(14)),
+		//dead letter without origin tube stays in dead-letter tube
+		ch.EXPECT().ReserveTube("dead", time.Duration(0)).Return(uint64(16), []byte(`{"job_id": 12}`), nil),
+		ch.EXPECT().ReserveTube("dead", time.Duration(0)).Return(uint64(0), nil, consumer.ErrTimeout),
+		ch.EXPECT().StatsJob(uint64(16)).Return(&consumer.JobStats{Priority: 10}, nil),
+		ch.EXPECT().Release(uint64(16), uint32(10), time.Duration(0)),
+	)
+
+	n, err := m.cli.RequeueAll()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestRequeueAllDeadlineSoon(t *testing.T) {
+	m, ch := newDeadLetterMock(t)
+	defer setupTest(m)()
+
+	//dead letters reserved before reserved one is about to expire are requeued
+	gomock.InOrder(
+		ch.EXPECT().ReserveTube("dead", time.Duration(0)).Return(
+			uint64(14), []byte(`{"job_id": 13, "tube": "default"}`), nil),
+		ch.EXPECT().StatsJob(uint64(14)).Return(&consumer.JobStats{Priority: 10, Ttr: time.Minute}, nil),
+		ch.EXPECT().PutTube("default", gomock.Any(), uint32(10), m.PutDelay, time.Minute).Return(uint64(15), nil),
+		ch.EXPECT().Delete(uint64(14)),
+		ch.EXPECT().ReserveTube("dead", time.Duration(0)).Return(uint64(0), nil, consumer.ErrDeadlineSoon),
+	)
+
+	n, err := m.cli.RequeueAll()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestResult(t *testing.T) {
+	var config = cli.NewConfiguration()
+	config.Url = "mock"
+
+	m := newMock(t, config)
+	defer setupTest(m)()
+
+	store := result.NewMemoryStore(0)
+	record := &result.Record{JobId: 7, TaskName: "add", Status: result.StatusSuccess}
+
+	assert.Nil(t, store.Save(record))
+
+	m.handler.EXPECT().ResultStore().Return(store)
+
+	r, err := m.cli.Result(7)
+
+	assert.Nil(t, err)
+	assert.Equal(t, record, r)
+}
+
+func TestResultWithoutStore(t *testing.T) {
+	var config = cli.NewConfiguration()
+	config.Url = "mock"
+
+	m := newMock(t, config)
+	defer setupTest(m)()
+
+	m.handler.EXPECT().ResultStore().Return(nil)
+
+	_, err := m.cli.Result(7)
+
+	assert.Equal(t, log.MissingResultStore(), err)
+}
+
+func TestPeek(t *testing.T) {
+	var config = cli.NewConfiguration()
+	config.Url = "mock"
+
+	m := newMock(t, config)
+	defer setupTest(m)()
+
+	ch := cmocks.NewMockConnectionHandler(m.ctrl)
+	stats := &consumer.JobStats{Id: 13, Tube: "mika", State: "buried"}
+
+	m.handler.EXPECT().ConnectionHandler().Return(ch).Times(2)
+	ch.EXPECT().PeekBuried("mika").Return(uint64(13), []byte("job"), nil)
+	ch.EXPECT().StatsJob(uint64(13)).Return(stats, nil)
+
+	job, err := m.cli.Peek(cli.StateBuried, "mika")
+
+	assert.Nil(t, err)
+	assert.Equal(t, &cli.Job{Id: 13, Stats: stats, Body: []byte("job")}, job)
+
+	m.handler.EXPECT().ConnectionHandler().Return(ch)
+
+	_, err = m.cli.Peek("reserved", "mika")
+
+	assert.Equal(t, log.UnknownPeekStateError("reserved"), err)
+}
+
+func TestJob(t *testing.T) {
+	var config = cli.NewConfiguration()
+	config.Url = "mock"
+
+	m := newMock(t, config)
+	defer setupTest(m)()
+
+	ch := cmocks.NewMockConnectionHandler(m.ctrl)
+
+	m.handler.EXPECT().ConnectionHandler().Return(ch).Times(2)
+	ch.EXPECT().Peek(uint64(13)).Return(nil, errors.New("peek: not found"))
+
+	_, err := m.cli.Job(13)
+
+	assert.EqualError(t, err, "peek: not found")
+
+	ch.EXPECT().Kick("mika", 5).Return(2, nil)
+
+	n, err := m.cli.Kick("mika", 5)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+}
@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"encoding/json"
+	"github.com/mnikita/task-queue/pkg/common"
+	"github.com/mnikita/task-queue/pkg/consumer"
+	"github.com/mnikita/task-queue/pkg/log"
+)
+
+func (cli *Cli) deadLetterTube() (string, error) {
+	tube := cli.container.Config().ConsumerConfig.DeadLetterTube
+
+	if tube == "" {
+		return "", log.MissingDeadLetterTube()
+	}
+
+	return tube, nil
+}
+
+func parseDeadLetter(id uint64, body []byte) (*common.DeadLetter, error) {
+	letter := &common.DeadLetter{}
+
+	if err := json.Unmarshal(body, letter); err != nil {
+		return nil, log.InvalidDeadLetterError(id, err)
+	}
+
+	letter.Id = id
+
+	return letter, nil
+}
+
+//reserveDeadLetters reserves all ready jobs from dead-letter tube and invokes handler for each one.
+//Reserved jobs not deleted by the handler must be released afterwards. Reserving stops early
+//without error when time to run of a reserved job is about to expire
+func (cli *Cli) reserveDeadLetters(handler func(id uint64, body []byte) error) error {
+	tube, err := cli.deadLetterTube()
+
+	if err != nil {
+		return err
+	}
+
+	ch := cli.container.ConnectionHandler()
+
+	for {
+		id, body, err := ch.ReserveTube(tube, 0)
+
+		if consumer.IsTimeout(err) {
+			return nil
+		}
+
+		if consumer.IsDeadlineSoon(err) {
+			log.Logger().CliDeadLettersStopped(tube)
+
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err = handler(id, body); err != nil {
+			return err
+		}
+	}
+}
+
+//release puts reserved job back to the ready queue keeping its priority
+func (cli *Cli) release(id uint64) error {
+	ch := cli.container.ConnectionHandler()
+
+	stats, err := ch.StatsJob(id)
+
+	if err != nil {
+		return err
+	}
+
+	return ch.Release(id, stats.Priority, 0)
+}
+
+//DeadLetters lists ready, delayed and buried jobs of dead-letter tube. Dead letters are
+//peeked, so they stay available to other clients, but every job on the server is inspected
+//to find them, see scanTube
+func (cli *Cli) DeadLetters() (letters []*common.DeadLetter, err error) {
+	tube, err := cli.deadLetterTube()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = cli.scanTube(tube, exportedStates, func(job *Job) error {
+		letter, err := parseDeadLetter(job.Id, job.Body)
+
+		if err != nil {
+			log.Logger().Error(err)
+
+			return nil
+		}
+
+		letters = append(letters, letter)
+
+		return nil
+	})
+
+	return letters, err
+}
+
+//DeadLetter reads dead letter by job id
+func (cli *Cli) DeadLetter(id uint64) (*common.DeadLetter, error) {
+	body, err := cli.container.ConnectionHandler().Peek(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseDeadLetter(id, body)
+}
+
+//Requeue puts dead letter job back to its origin tube with priority and time to run
+//of the failed job, and deletes dead letter
+func (cli *Cli) Requeue(id uint64) (uint64, error) {
+	letter, err := cli.DeadLetter(id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return cli.requeue(letter)
+}
+
+func (cli *Cli) requeue(letter *common.DeadLetter) (uint64, error) {
+	if letter.Tube == "" {
+		return 0, log.MissingDeadLetterOriginError(letter.Id)
+	}
+
+	ch := cli.container.ConnectionHandler()
+
+	//dead letter keeps priority and time to run of the failed job
+	stats, err := ch.StatsJob(letter.Id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := ch.PutTube(letter.Tube, letter.Body, stats.Priority, cli.PutDelay, stats.Ttr)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return id, ch.Delete(letter.Id)
+}
+
+//RequeueAll puts all ready dead letter jobs back to their origin tubes.
+//Dead letters which cannot be requeued are left in the dead-letter tube
+func (cli *Cli) RequeueAll() (n int, err error) {
+	var failed []uint64
+
+	defer func() {
+		for _, id := range failed {
+			if releaseErr := cli.release(id); err == nil {
+				err = releaseErr
+			}
+		}
+	}()
+
+	err = cli.reserveDeadLetters(func(id uint64, body []byte) error {
+		letter, err := parseDeadLetter(id, body)
+
+		if err == nil {
+			_, err = cli.requeue(letter)
+		}
+
+		if err != nil {
+			log.Logger().Error(err)
+
+			failed = append(failed, id)
+
+			return nil
+		}
+
+		n++
+
+		return nil
+	})
+
+	return n, err
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/google/wire"
 	"github.com/mnikita/task-queue/pkg/beanstalkd"
 	"github.com/mnikita/task-queue/pkg/container"
+	"github.com/mnikita/task-queue/pkg/memory"
 )
 
 //TODO: Initialize with url, tubes to dispatch to connection.NewConfiguration
@@ -16,3 +17,10 @@ func InitializeCli(config *Configuration) *Cli {
 
 	return &Cli{}
 }
+
+//InitializeMemoryCli creates Cli running hermetically on in-process broker
+func InitializeMemoryCli(config *Configuration, broker *memory.Broker) *Cli {
+	wire.Build(NewCli, container.WireSet, memory.WireSet)
+
+	return &Cli{}
+}
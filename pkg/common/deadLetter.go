@@ -0,0 +1,20 @@
+package common
+
+import "time"
+
+//DeadLetter is an envelope for jobs moved to the dead-letter tube after failing for good
+type DeadLetter struct {
+	//Id of the dead-letter job
+	Id uint64 `json:"-"`
+
+	//Id of the original job
+	JobId uint64 `json:"job_id"`
+
+	Error     string    `json:"error"`
+	Tube      string    `json:"tube"`
+	Attempts  int       `json:"attempts"`
+	Timestamp time.Time `json:"timestamp"`
+
+	//Original job body
+	Body []byte `json:"body"`
+}
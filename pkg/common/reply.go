@@ -0,0 +1,21 @@
+package common
+
+import (
+	"encoding/json"
+	"time"
+)
+
+//Reply is an envelope for task outcome put to the reply tube of the waiting caller
+type Reply struct {
+	CorrelationId string `json:"correlation_id"`
+
+	//Id of the task job
+	JobId uint64 `json:"job_id"`
+
+	//Results reported by task handler, each marshalled to JSON
+	Results []json.RawMessage `json:"results,omitempty"`
+
+	//Error of failed task. Empty on success
+	Error     string    `json:"error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
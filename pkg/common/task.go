@@ -1,17 +1,23 @@
-//go:generate mockgen -destination=./mocks/mock_task.go -package=mocks . TaskHandler,TaskPayloadHandler,TaskProcessEventHandler,TaskQueueEventHandler
+//go:generate mockgen -destination=./mocks/mock_task.go -package=mocks . TaskHandler,TaskPayloadHandler,TaskProcessEventHandler,TaskQueueEventHandler,TaskQueueFullHandler
 // Package common provides primitives for task registration and marshalling of task request data
 package common
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/mnikita/task-queue/pkg/log"
+	"time"
 )
 
+//Task envelope schema version set by producer. Zero for jobs put without version
+const TaskSchemaVersion = 1
+
 const (
 	Error = iota
 	Success
 	Heartbeat
 	Result
+	Release
 )
 
 //TaskHandler handles task requests. Final task implements TaskHandle interface
@@ -22,6 +28,16 @@ type TaskHandler interface {
 	Payload() interface{}
 }
 
+//ContextTaskHandler is TaskHandler which can be cancelled through given context.
+//Context is cancelled on task timeout and worker shutdown. Task thread does not wait
+//for cancelled handler: handler ignoring the context leaks its goroutine until it returns,
+//and task events it sends meanwhile are dropped
+type ContextTaskHandler interface {
+	TaskHandler
+
+	HandleContext(ctx context.Context) error
+}
+
 //TaskPayloadHandler handles consumer task payload.
 //TaskPayloadHandler implementation dispatches consumer requests to worker queue
 type TaskPayloadHandler interface {
@@ -33,6 +49,7 @@ type TaskProcessEventHandler interface {
 	OnTaskSuccess(task *Task)
 	OnTaskHeartbeat(task *Task)
 	OnTaskError(task *Task, err error)
+	OnTaskRelease(task *Task, delay time.Duration)
 
 	OnTaskResult(task *Task, a ...interface{})
 }
@@ -43,7 +60,20 @@ type TaskQueueEventHandler interface {
 	OnTaskAcceptTimeout(task *Task)
 }
 
-var eventTypes = []string{"Error", "Success", "Heartbeat", "Result"}
+//TaskQueueFullHandler is optionally implemented by TaskQueueEventHandler
+//to be notified of tasks released because their dedicated queue is full
+type TaskQueueFullHandler interface {
+	OnTaskQueueFull(task *Task, releaseDelay time.Duration)
+}
+
+//TaskRouter selects dedicated worker queue of a task
+type TaskRouter interface {
+	//RouteTask returns dedicated queue of a task, nil if task is queued on common task queue.
+	//Task is released after release delay if dedicated queue is full
+	RouteTask(task *Task) (queue chan<- *Task, releaseDelay time.Duration)
+}
+
+var eventTypes = []string{"Error", "Success", "Heartbeat", "Result", "Release"}
 
 //TaskProcessEvent struct contains task process event data
 type TaskProcessEvent struct {
@@ -51,6 +81,9 @@ type TaskProcessEvent struct {
 	Task    *Task
 	Err     error
 	Result  []interface{}
+
+	//Release delay
+	Delay time.Duration
 }
 
 //Task struct contains task requests data
@@ -58,10 +91,77 @@ type Task struct {
 	Id      uint64          `json:"-"`
 	Name    string          `json:"name"`
 	Payload json.RawMessage `json:"payload"`
+
+	//Tube task outcome is put to for the waiting caller. No reply is sent if not set
+	ReplyTo string `json:"reply_to,omitempty"`
+
+	//Caller request id returned in the reply
+	CorrelationId string `json:"correlation_id,omitempty"`
+
+	//Time caller stops waiting for the reply. Reply is not sent after it
+	ReplyDeadline *time.Time `json:"reply_deadline,omitempty"`
+
+	//Optional metadata. Job body is kept on release, so headers are preserved across retries
+	Headers map[string]string `json:"headers,omitempty"`
+
+	//Trace id propagated from the producer
+	TraceId string `json:"trace_id,omitempty"`
+
+	//Time task was put to the queue
+	EnqueuedAt *time.Time `json:"enqueued_at,omitempty"`
+
+	//Host task was put from
+	Origin string `json:"origin,omitempty"`
+
+	//Envelope schema version
+	Version int `json:"version,omitempty"`
+
+	//Number of times the job has been attempted, not counting reserves released without failure. Zero if unknown
+	Attempts int `json:"-"`
+
+	//Job time to run. Zero if unknown
+	Ttr time.Duration `json:"-"`
+
+	//Tube job was reserved from. Empty if unknown
+	Tube string `json:"-"`
+
+	//Time task was handed over to worker. Zero if unknown
+	ReceivedAt time.Time `json:"-"`
+
+	//Results reported by task handler
+	Results []interface{} `json:"-"`
+}
+
+type taskContextKey struct{}
+
+//Header returns task header value. Empty string is returned for missing header
+func (t *Task) Header(key string) string {
+	return t.Headers[key]
+}
+
+//SetHeader sets task header value
+func (t *Task) SetHeader(key string, value string) {
+	if t.Headers == nil {
+		t.Headers = make(map[string]string)
+	}
+
+	t.Headers[key] = value
+}
+
+//ContextWithTask returns context carrying processed task, so handlers can read task metadata
+func ContextWithTask(ctx context.Context, task *Task) context.Context {
+	return context.WithValue(ctx, taskContextKey{}, task)
+}
+
+//TaskFromContext returns task processed within the context
+func TaskFromContext(ctx context.Context) (*Task, bool) {
+	task, ok := ctx.Value(taskContextKey{}).(*Task)
+
+	return task, ok
 }
 
 //TaskHandlerFunc is helper class for creating short task implementation containing one processing function
-type TaskHandlerFunc func(interface{}, *Task, TaskProcessEventHandler) error
+type TaskHandlerFunc func(context.Context, interface{}, *Task, TaskProcessEventHandler) error
 
 //BaseTaskHandler is base primitive for final tasks implementations.
 //It is a default implementation of TaskHandler interface
@@ -81,6 +181,9 @@ func (b *BaseTaskHandler) Payload() interface{} {
 type TaskThreadError struct {
 	Err  error
 	Task *Task
+
+	//Stack trace of recovered task panic
+	Stack []byte
 }
 
 //TaskConstructor creates TaskHandler instances
@@ -103,13 +206,23 @@ func (b *BaseTaskHandler) SetTaskProcessEventHandler(eventHandler TaskProcessEve
 }
 
 func (b *BaseTaskHandler) Handle() error {
-	return b.handler(b.payload, b.task, b.eventHandler)
+	return b.HandleContext(context.Background())
+}
+
+func (b *BaseTaskHandler) HandleContext(ctx context.Context) error {
+	return b.handler(ctx, b.payload, b.task, b.eventHandler)
 }
 
 func NewTaskThreadError(task *Task, err error) *TaskThreadError {
 	return &TaskThreadError{Task: task, Err: log.TaskThreadError(task.Name, err)}
 }
 
+//NewTaskPanicError creates TaskThreadError from value recovered from task panic
+func NewTaskPanicError(task *Task, value interface{}, stack []byte) *TaskThreadError {
+	return &TaskThreadError{Task: task, Err: log.TaskThreadError(task.Name, log.TaskPanicError(value)),
+		Stack: stack}
+}
+
 func (e *TaskProcessEvent) GetEventType() string {
 	return eventTypes[e.EventId]
 }
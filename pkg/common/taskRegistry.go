@@ -56,6 +56,13 @@ func GetRegisteredTaskHandler(task *Task) (TaskHandler, error) {
 	return taskHandler, nil
 }
 
+//IsTaskRegistered reports whether task name is registered
+func IsTaskRegistered(taskName string) bool {
+	_, ok := newRegisteredTasks()[taskName]
+
+	return ok
+}
+
 //GetRegisteredTasks returns slice with all task names registered
 func GetRegisteredTasks() []string {
 	return funk.Keys(newRegisteredTasks()).([]string)
@@ -1,6 +1,7 @@
 package common_test
 
 import (
+	"context"
 	"github.com/mnikita/task-queue/pkg/common"
 	"github.com/stretchr/testify/assert"
 	"os"
@@ -27,7 +28,7 @@ func setupTest(m *Mock) func() {
 	}
 }
 
-func HandleShortTest(_ interface{}, _ *common.Task, _ common.TaskProcessEventHandler) error {
+func HandleShortTest(_ context.Context, _ interface{}, _ *common.Task, _ common.TaskProcessEventHandler) error {
 	return nil
 }
 
@@ -0,0 +1,57 @@
+package common_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mnikita/task-queue/pkg/common"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTaskWithoutHeaders(t *testing.T) {
+	task := &common.Task{}
+
+	assert.Nil(t, json.Unmarshal([]byte(`{"name": "add", "payload": {"a": 1}}`), task))
+	assert.Equal(t, "add", task.Name)
+	assert.Nil(t, task.Headers)
+	assert.Nil(t, task.EnqueuedAt)
+	assert.Equal(t, 0, task.Version)
+	assert.Empty(t, task.Header("tenant"))
+
+	data, err := json.Marshal(task)
+
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"name": "add", "payload": {"a": 1}}`, string(data))
+}
+
+func TestTaskHeaders(t *testing.T) {
+	enqueuedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	task := &common.Task{Name: "add", TraceId: "trace-1", EnqueuedAt: &enqueuedAt, Origin: "host",
+		Version: common.TaskSchemaVersion}
+	task.SetHeader("tenant", "acme")
+
+	data, err := json.Marshal(task)
+	assert.Nil(t, err)
+
+	decoded := &common.Task{}
+
+	assert.Nil(t, json.Unmarshal(data, decoded))
+	assert.Equal(t, "acme", decoded.Header("tenant"))
+	assert.Equal(t, "trace-1", decoded.TraceId)
+	assert.Equal(t, enqueuedAt, *decoded.EnqueuedAt)
+	assert.Equal(t, "host", decoded.Origin)
+	assert.Equal(t, common.TaskSchemaVersion, decoded.Version)
+}
+
+func TestTaskFromContext(t *testing.T) {
+	task := &common.Task{Name: "add"}
+
+	_, ok := common.TaskFromContext(context.Background())
+	assert.False(t, ok)
+
+	actual, ok := common.TaskFromContext(common.ContextWithTask(context.Background(), task))
+	assert.True(t, ok)
+	assert.Equal(t, task, actual)
+}
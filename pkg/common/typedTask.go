@@ -0,0 +1,110 @@
+package common
+
+import (
+	"context"
+	"github.com/mnikita/task-queue/pkg/log"
+	"reflect"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+//NewTypedTaskConstructor creates TaskConstructor from typed handling function of form
+//func(context.Context, *Payload) (Result, error). Payload argument and result are optional.
+//Task payload is decoded into new Payload instance for every task and result is reported as task result
+func NewTypedTaskConstructor(taskName string, fn interface{}) (TaskConstructor, error) {
+	payloadType, err := typedTaskPayloadType(taskName, fn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	handler := typedTaskHandlerFunc(reflect.ValueOf(fn))
+
+	return func() TaskHandler {
+		if payloadType == nil {
+			return NewBaseTaskHandler(handler)
+		}
+
+		return NewBaseTaskHandlerWithPayload(handler, reflect.New(payloadType.Elem()).Interface())
+	}, nil
+}
+
+//RegisterTypedTask registers typed handling function by task name. Function signature is validated on registration
+func RegisterTypedTask(taskName string, fn interface{}) error {
+	constructor, err := NewTypedTaskConstructor(taskName, fn)
+
+	if err != nil {
+		return err
+	}
+
+	RegisterTask(taskName, constructor)
+
+	return nil
+}
+
+//MustRegisterTypedTask is like RegisterTypedTask but panics if function signature is invalid
+func MustRegisterTypedTask(taskName string, fn interface{}) {
+	if err := RegisterTypedTask(taskName, fn); err != nil {
+		panic(err)
+	}
+}
+
+//typedTaskPayloadType validates handling function and returns its payload pointer type, nil without payload
+func typedTaskPayloadType(taskName string, fn interface{}) (reflect.Type, error) {
+	if fn == nil {
+		return nil, log.InvalidTypedTaskError(taskName, "nil", "not a function")
+	}
+
+	t := reflect.TypeOf(fn)
+
+	if t.Kind() != reflect.Func {
+		return nil, log.InvalidTypedTaskError(taskName, t.String(), "not a function")
+	}
+
+	if t.IsVariadic() || t.NumIn() < 1 || t.NumIn() > 2 || t.In(0) != contextType {
+		return nil, log.InvalidTypedTaskError(taskName, t.String(),
+			"expected context.Context and optional payload pointer arguments")
+	}
+
+	if t.NumOut() < 1 || t.NumOut() > 2 || t.Out(t.NumOut()-1) != errorType {
+		return nil, log.InvalidTypedTaskError(taskName, t.String(),
+			"expected optional result and error return values")
+	}
+
+	if t.NumIn() == 1 {
+		return nil, nil
+	}
+
+	payloadType := t.In(1)
+
+	if payloadType.Kind() != reflect.Ptr {
+		return nil, log.InvalidTypedTaskError(taskName, t.String(), "payload argument is not a pointer")
+	}
+
+	return payloadType, nil
+}
+
+func typedTaskHandlerFunc(fn reflect.Value) TaskHandlerFunc {
+	return func(ctx context.Context, payload interface{}, task *Task, eventHandler TaskProcessEventHandler) error {
+		args := []reflect.Value{reflect.ValueOf(&ctx).Elem()}
+
+		if fn.Type().NumIn() == 2 {
+			args = append(args, reflect.ValueOf(payload))
+		}
+
+		out := fn.Call(args)
+
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			return err
+		}
+
+		if len(out) == 2 && eventHandler != nil {
+			eventHandler.OnTaskResult(task, out[0].Interface())
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,112 @@
+package common_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/mnikita/task-queue/pkg/common"
+	"github.com/mnikita/task-queue/pkg/common/mocks"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type addPayload struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+var errAdd = errors.New("add error")
+
+func handleAdd(_ context.Context, payload *addPayload) (int, error) {
+	if payload.A < 0 {
+		return 0, errAdd
+	}
+
+	return payload.A + payload.B, nil
+}
+
+func newTypedTaskHandler(t *testing.T, fn interface{}, task *common.Task,
+	eventHandler common.TaskProcessEventHandler) common.TaskHandler {
+	constructor, err := common.NewTypedTaskConstructor(task.Name, fn)
+
+	assert.Nil(t, err)
+
+	taskHandler := constructor()
+
+	if payload := taskHandler.Payload(); payload != nil {
+		assert.Nil(t, json.Unmarshal(task.Payload, payload))
+	}
+
+	taskHandler.SetTask(task)
+	taskHandler.SetTaskProcessEventHandler(eventHandler)
+
+	return taskHandler
+}
+
+func TestTypedTask(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	eventHandler := mocks.NewMockTaskProcessEventHandler(ctrl)
+
+	task := &common.Task{Name: "add", Payload: []byte(`{"a": 1, "b": 2}`)}
+
+	eventHandler.EXPECT().OnTaskResult(task, 3)
+
+	taskHandler := newTypedTaskHandler(t, handleAdd, task, eventHandler)
+
+	assert.Equal(t, &addPayload{A: 1, B: 2}, taskHandler.Payload())
+	assert.Nil(t, taskHandler.Handle())
+}
+
+func TestTypedTaskError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	eventHandler := mocks.NewMockTaskProcessEventHandler(ctrl)
+
+	task := &common.Task{Name: "add", Payload: []byte(`{"a": -1}`)}
+
+	taskHandler := newTypedTaskHandler(t, handleAdd, task, eventHandler)
+
+	assert.Equal(t, errAdd, taskHandler.Handle())
+}
+
+func TestTypedTaskWithoutPayload(t *testing.T) {
+	called := false
+
+	task := &common.Task{Name: "ping"}
+
+	taskHandler := newTypedTaskHandler(t, func(_ context.Context) error {
+		called = true
+
+		return nil
+	}, task, nil)
+
+	assert.Nil(t, taskHandler.Payload())
+	assert.Nil(t, taskHandler.Handle())
+	assert.True(t, called)
+}
+
+func TestInvalidTypedTask(t *testing.T) {
+	invalid := []interface{}{
+		nil,
+		"not a function",
+		func(_ *addPayload) error { return nil },
+		func(_ context.Context, _ addPayload) error { return nil },
+		func(_ context.Context, _ *addPayload) int { return 0 },
+		func(_ context.Context, _ *addPayload) (int, int, error) { return 0, 0, nil },
+		func(_ context.Context, _ ...*addPayload) error { return nil },
+	}
+
+	for _, fn := range invalid {
+		_, err := common.NewTypedTaskConstructor("invalid", fn)
+
+		assert.NotNil(t, err)
+	}
+
+	assert.Panics(t, func() {
+		common.MustRegisterTypedTask("invalid", "not a function")
+	})
+}
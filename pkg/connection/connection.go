@@ -1,12 +1,17 @@
-//go:generate mockgen -destination=./mocks/mock_connection.go -package=mocks . Handler,Dialer,Channels,Channel
+//go:generate mockgen -destination=./mocks/mock_connection.go -package=mocks . Handler,Dialer,Channels,Channel,EventHandler
 package connection
 
 import (
+	"errors"
 	"github.com/google/wire"
 	"github.com/mnikita/task-queue/pkg/consumer"
 	"github.com/mnikita/task-queue/pkg/log"
 	"github.com/mnikita/task-queue/pkg/util"
+	"io"
+	"net"
 	"net/url"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -14,11 +19,23 @@ var WireSet = wire.NewSet(NewConnection, NewConfiguration,
 	wire.Bind(new(Handler), new(*Connection)),
 	wire.Bind(new(consumer.ConnectionHandler), new(*Connection)))
 
+//DefaultTube is watched by connection without configured tubes
+const DefaultTube = "default"
+
+//Dialer is shared by connection and producer, so it must be safe for concurrent dials
 type Dialer interface {
 	Dial(addr string, tubes []string) (consumer.ConnectionHandler, error)
 
-	CreateChannels() Channels
-	CreateChannel() Channel
+	//CreateChannels creates channel reserving from tubes of dialed connection
+	CreateChannels(handler consumer.ConnectionHandler, tubes []string) Channels
+	//CreateChannel creates channel putting to tube of dialed connection
+	CreateChannel(handler consumer.ConnectionHandler, tube string) Channel
+}
+
+//EventHandler handles connection state changes
+type EventHandler interface {
+	OnConnect()
+	OnDisconnect(err error)
 }
 
 type Handler interface {
@@ -27,12 +44,36 @@ type Handler interface {
 
 	Config() *Configuration
 
+	//ConfigCopy returns copy of configuration taken under lock, as watched tubes are
+	//changed while connection runs
+	ConfigCopy() *Configuration
+
 	Dialer() Dialer
+
+	SetEventHandler(eventHandler EventHandler)
+
+	//SetTubes changes watched tubes of established connection. Change applies to next
+	//reserve, jobs reserved before are kept. Tubes are left unchanged on error
+	SetTubes(tubes []string) error
+
+	//Watch adds tube to watched tubes of established connection.
+	//Change applies to next reserve, jobs reserved before are kept
+	Watch(tube string) error
+	//Ignore removes tube from watched tubes. Last watched tube can not be ignored
+	Ignore(tube string) error
+	WatchedTubes() []string
 }
 
 type Configuration struct {
 	Tubes []string
 	Url   string
+
+	//Initial delay between reconnection attempts, doubled after each failed attempt.
+	//Broken connection is not re-established if not set
+	ReconnectBackoff time.Duration
+
+	//Maximum delay between reconnection attempts
+	MaxReconnectBackoff time.Duration
 }
 
 type Channels interface {
@@ -45,17 +86,31 @@ type Channel interface {
 	Put(body []byte, pri uint32, delay, ttr time.Duration) (id uint64, err error)
 }
 
-type Connection struct {
+//session stores connection handler and channels of one established connection
+type session struct {
+	handler  consumer.ConnectionHandler
 	channels Channels
 	channel  Channel
-	consumer.ConnectionHandler
+}
+
+//Connection re-establishes broken connection in background.
+//Operations fail with connection unavailable error until connection is restored
+type Connection struct {
+	mux     sync.RWMutex
+	session *session
+
+	closed       bool
+	closeChannel chan struct{}
 
 	dialer Dialer
 
+	eventHandler EventHandler
+
 	*Configuration
 }
 
-func parseUrl(urlText string) (addr string, err error) {
+//ParseUrl returns server address of connection URL
+func ParseUrl(urlText string) (addr string, err error) {
 	serverUrl, err := url.Parse(urlText)
 
 	if err != nil {
@@ -67,8 +122,20 @@ func parseUrl(urlText string) (addr string, err error) {
 	return addr, nil
 }
 
+//IsBrokenConnection reports whether err is caused by broken network connection
+func IsBrokenConnection(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var netErr net.Error
+
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) || errors.As(err, &netErr)
+}
+
 func (c *Connection) establishConnection() error {
-	addr, err := parseUrl(c.Url)
+	addr, err := ParseUrl(c.Url)
 
 	if err != nil {
 		return err
@@ -76,41 +143,154 @@ func (c *Connection) establishConnection() error {
 
 	log.Logger().BeanUrl(c.Url)
 
-	c.ConnectionHandler, err = c.dialer.Dial(addr, c.Tubes)
+	c.mux.RLock()
+	tubes := c.Tubes
+	c.mux.RUnlock()
+
+	handler, err := c.dialer.Dial(addr, tubes)
 
 	if err != nil {
 		return err
 	}
 
-	if c.Tubes != nil && len(c.Tubes) > 0 {
-		if len(c.Tubes) > 1 {
-			c.channels = c.dialer.CreateChannels()
-		} else {
-			c.channel = c.dialer.CreateChannel()
-		}
-	}
+	s := c.newSession(handler, tubes)
 
-	t, err := c.ListTubes()
+	t, err := s.handler.ListTubes()
 
 	if err != nil {
+		_ = s.handler.Close()
+
 		return err
 	}
 
+	c.mux.Lock()
+
+	if c.closed {
+		c.mux.Unlock()
+
+		return s.handler.Close()
+	}
+
+	previous := c.session
+	c.session = s
+
+	c.mux.Unlock()
+
+	//operations still running on previous connection fail without marking new one broken
+	if previous != nil {
+		_ = previous.handler.Close()
+	}
+
 	log.Logger().BeanConnectionEstablished(t)
 
+	c.OnConnect()
+
 	return nil
 }
 
+//newSession creates channels of the connection handler. Jobs are reserved from all tubes
+//and put to the tube if only one is configured. Default tube is used if there are no tubes
+func (c *Connection) newSession(handler consumer.ConnectionHandler, tubes []string) *session {
+	s := &session{handler: handler}
+
+	if len(tubes) > 0 {
+		s.channels = c.dialer.CreateChannels(handler, tubes)
+	}
+
+	if len(tubes) == 1 {
+		s.channel = c.dialer.CreateChannel(handler, tubes[0])
+	}
+
+	return s
+}
+
+//current returns established session. Error is returned while connection is broken
+func (c *Connection) current() (*session, error) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	if c.session == nil {
+		return nil, log.ConnectionUnavailableError()
+	}
+
+	return c.session, nil
+}
+
+//check marks session broken on network error and starts reconnecting
+func (c *Connection) check(s *session, err error) error {
+	if IsBrokenConnection(err) {
+		c.disconnect(s, err)
+	}
+
+	return err
+}
+
+func (c *Connection) disconnect(s *session, cause error) {
+	c.mux.Lock()
+
+	//session already replaced by another failed operation. Watched tube changes keep the handler
+	if c.session == nil || c.session.handler != s.handler || c.closed {
+		c.mux.Unlock()
+
+		return
+	}
+
+	c.session = nil
+
+	c.mux.Unlock()
+
+	_ = s.handler.Close()
+
+	log.Logger().BeanConnectionLost(cause)
+
+	c.OnDisconnect(cause)
+
+	if c.ReconnectBackoff > 0 {
+		go c.reconnect()
+	}
+}
+
+//reconnect establishes connection with exponential backoff until it succeeds or connection is closed
+func (c *Connection) reconnect() {
+	backoff := c.ReconnectBackoff
+
+	for {
+		select {
+		case <-c.closeChannel:
+			return
+		case <-time.After(backoff):
+		}
+
+		err := c.establishConnection()
+
+		if err == nil {
+			return
+		}
+
+		backoff *= 2
+
+		if c.MaxReconnectBackoff > 0 && backoff > c.MaxReconnectBackoff {
+			backoff = c.MaxReconnectBackoff
+		}
+
+		log.Logger().BeanReconnectFailed(err, backoff)
+	}
+}
+
 func NewConnection(config *Configuration, dialer Dialer) *Connection {
 	connection := &Connection{Configuration: config}
 
 	connection.dialer = dialer
+	connection.closeChannel = make(chan struct{})
 
 	return connection
 }
 
 func NewConfiguration() *Configuration {
-	return &Configuration{}
+	return &Configuration{
+		ReconnectBackoff:    time.Millisecond * 500,
+		MaxReconnectBackoff: time.Second * 30,
+	}
 }
 
 func (c *Connection) Init() (err error) {
@@ -124,45 +304,403 @@ func (c *Connection) Init() (err error) {
 }
 
 func (c *Connection) Close() error {
-	return c.ConnectionHandler.Close()
+	c.mux.Lock()
+
+	if c.closed {
+		c.mux.Unlock()
+
+		return nil
+	}
+
+	c.closed = true
+	close(c.closeChannel)
+
+	s := c.session
+	c.session = nil
+
+	c.mux.Unlock()
+
+	if s == nil {
+		return nil
+	}
+
+	return s.handler.Close()
 }
 
 func (c *Connection) Config() *Configuration {
 	return c.Configuration
 }
 
+func (c *Connection) ConfigCopy() *Configuration {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	config := *c.Configuration
+	config.Tubes = append([]string(nil), c.Tubes...)
+
+	return &config
+}
+
 func (c *Connection) Dialer() Dialer {
 	return c.dialer
 }
 
+func (c *Connection) SetEventHandler(eventHandler EventHandler) {
+	c.eventHandler = eventHandler
+}
+
+func (c *Connection) SetTubes(tubes []string) error {
+	for _, tube := range tubes {
+		if tube == "" {
+			return log.InvalidTubeNameError(tube)
+		}
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.Tubes = tubes
+
+	if c.session != nil {
+		c.session = c.newSession(c.session.handler, tubes)
+	}
+
+	log.Logger().BeanTubesChanged(tubes)
+
+	return nil
+}
+
+func (c *Connection) Watch(tube string) error {
+	if tube == "" {
+		return log.InvalidTubeNameError(tube)
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	watched := c.watched()
+
+	for _, t := range watched {
+		if t == tube {
+			return nil
+		}
+	}
+
+	c.setWatched(append(watched, tube))
+
+	log.Logger().BeanTubeWatched(tube)
+
+	return nil
+}
+
+func (c *Connection) Ignore(tube string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	watched := c.watched()
+
+	var tubes []string
+
+	for _, t := range watched {
+		if t != tube {
+			tubes = append(tubes, t)
+		}
+	}
+
+	if len(tubes) == len(watched) {
+		return nil
+	}
+
+	if len(tubes) == 0 {
+		return log.LastWatchedTubeError(tube)
+	}
+
+	c.setWatched(tubes)
+
+	log.Logger().BeanTubeIgnored(tube)
+
+	return nil
+}
+
+//watched returns copy of watched tubes. Called under lock
+func (c *Connection) watched() []string {
+	if len(c.Tubes) == 0 {
+		return []string{DefaultTube}
+	}
+
+	return append([]string{}, c.Tubes...)
+}
+
+//setWatched replaces reserve channels of established session keeping put channel.
+//Broken connection is re-established with given tubes. Called under lock
+func (c *Connection) setWatched(tubes []string) {
+	c.Tubes = tubes
+
+	if c.session != nil {
+		c.session = &session{handler: c.session.handler, channel: c.session.channel,
+			channels: c.dialer.CreateChannels(c.session.handler, tubes)}
+	}
+}
+
+func (c *Connection) WatchedTubes() []string {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	return c.watched()
+}
+
+func (c *Connection) OnConnect() {
+	if !util.IsNil(c.eventHandler) {
+		c.eventHandler.OnConnect()
+	}
+}
+
+func (c *Connection) OnDisconnect(err error) {
+	if !util.IsNil(c.eventHandler) {
+		c.eventHandler.OnDisconnect(err)
+	}
+}
+
 func (c *Connection) Reserve(timeout time.Duration) (id uint64, body []byte, err error) {
-	if util.IsNil(c.channels) {
-		return c.ConnectionHandler.Reserve(timeout)
+	s, err := c.current()
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if util.IsNil(s.channels) {
+		id, body, err = s.handler.Reserve(timeout)
+	} else {
+		id, body, err = s.channels.Reserve(timeout)
 	}
 
-	return c.channels.Reserve(timeout)
+	return id, body, c.check(s, err)
+}
+
+func (c *Connection) ReserveTube(tube string, timeout time.Duration) (id uint64, body []byte, err error) {
+	s, err := c.current()
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	id, body, err = s.handler.ReserveTube(tube, timeout)
+
+	return id, body, c.check(s, err)
+}
+
+func (c *Connection) Release(id uint64, pri uint32, delay time.Duration) error {
+	s, err := c.current()
+
+	if err != nil {
+		return err
+	}
+
+	return c.check(s, s.handler.Release(id, pri, delay))
 }
 
 func (c *Connection) Delete(id uint64) (err error) {
 	log.Logger().ConsumerDelete(id)
 
-	return c.ConnectionHandler.Delete(id)
+	s, err := c.current()
+
+	if err != nil {
+		return err
+	}
+
+	return c.check(s, s.handler.Delete(id))
+}
+
+func (c *Connection) Bury(id uint64, pri uint32) error {
+	s, err := c.current()
+
+	if err != nil {
+		return err
+	}
+
+	return c.check(s, s.handler.Bury(id, pri))
+}
+
+func (c *Connection) Touch(id uint64) error {
+	s, err := c.current()
+
+	if err != nil {
+		return err
+	}
+
+	return c.check(s, s.handler.Touch(id))
 }
 
 func (c *Connection) Put(body []byte, pri uint32, delay, ttr time.Duration) (id uint64, err error) {
-	if util.IsNil(c.channel) {
+	s, err := c.current()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if util.IsNil(s.channel) {
 		return 0, log.MissingChannel()
 	}
 
-	log.Logger().ConsumerPut(c.channel.Name(), pri, delay, ttr)
+	log.Logger().ConsumerPut(s.channel.Name(), pri, delay, ttr)
+
+	id, err = s.channel.Put(body, pri, delay, ttr)
+
+	return id, c.check(s, err)
+}
+
+func (c *Connection) PutTube(tube string, body []byte, pri uint32, delay, ttr time.Duration) (id uint64, err error) {
+	log.Logger().ConsumerPut(tube, pri, delay, ttr)
+
+	s, err := c.current()
+
+	if err != nil {
+		return 0, err
+	}
+
+	id, err = s.handler.PutTube(tube, body, pri, delay, ttr)
+
+	return id, c.check(s, err)
+}
+
+func (c *Connection) Peek(id uint64) (body []byte, err error) {
+	s, err := c.current()
+
+	if err != nil {
+		return nil, err
+	}
+
+	body, err = s.handler.Peek(id)
+
+	return body, c.check(s, err)
+}
+
+func (c *Connection) ListTubes() (tubes []string, err error) {
+	s, err := c.current()
+
+	if err != nil {
+		return nil, err
+	}
+
+	tubes, err = s.handler.ListTubes()
+
+	return tubes, c.check(s, err)
+}
+
+func (c *Connection) PeekReady(tube string) (id uint64, body []byte, err error) {
+	s, err := c.current()
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	id, body, err = s.handler.PeekReady(tube)
+
+	return id, body, c.check(s, err)
+}
+
+func (c *Connection) PeekDelayed(tube string) (id uint64, body []byte, err error) {
+	s, err := c.current()
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	id, body, err = s.handler.PeekDelayed(tube)
 
-	return c.channel.Put(body, pri, delay, ttr)
+	return id, body, c.check(s, err)
+}
+
+func (c *Connection) PeekBuried(tube string) (id uint64, body []byte, err error) {
+	s, err := c.current()
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	id, body, err = s.handler.PeekBuried(tube)
+
+	return id, body, c.check(s, err)
+}
+
+func (c *Connection) Kick(tube string, bound int) (n int, err error) {
+	s, err := c.current()
+
+	if err != nil {
+		return 0, err
+	}
+
+	n, err = s.handler.Kick(tube, bound)
+
+	return n, c.check(s, err)
+}
+
+func (c *Connection) KickJob(id uint64) error {
+	s, err := c.current()
+
+	if err != nil {
+		return err
+	}
+
+	return c.check(s, s.handler.KickJob(id))
+}
+
+func (c *Connection) StatsJob(id uint64) (stats *consumer.JobStats, err error) {
+	s, err := c.current()
+
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err = s.handler.StatsJob(id)
+
+	return stats, c.check(s, err)
+}
+
+func (c *Connection) StatsTube(tube string) (stats *consumer.TubeStats, err error) {
+	s, err := c.current()
+
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err = s.handler.StatsTube(tube)
+
+	return stats, c.check(s, err)
+}
+
+func (c *Connection) Stats() (stats *consumer.ServerStats, err error) {
+	s, err := c.current()
+
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err = s.handler.Stats()
+
+	return stats, c.check(s, err)
+}
+
+func (c *Connection) PauseTube(tube string, delay time.Duration) error {
+	s, err := c.current()
+
+	if err != nil {
+		return err
+	}
+
+	return c.check(s, s.handler.PauseTube(tube, delay))
 }
 
 func (c *Connection) DefaultTube() (string, error) {
-	if util.IsNil(c.channel) {
+	s, err := c.current()
+
+	if err != nil {
+		return "", err
+	}
+
+	if util.IsNil(s.channel) {
 		return "", log.MissingChannel()
 	}
 
-	return c.channel.Name(), nil
+	return s.channel.Name(), nil
 }
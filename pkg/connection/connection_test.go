@@ -2,13 +2,19 @@ package connection_test
 
 import (
 	"errors"
+	"fmt"
 	"github.com/golang/mock/gomock"
 	"github.com/mnikita/task-queue/pkg/connection"
 	"github.com/mnikita/task-queue/pkg/connection/mocks"
 	"github.com/mnikita/task-queue/pkg/consumer"
 	cmocks "github.com/mnikita/task-queue/pkg/consumer/mocks"
+	"github.com/mnikita/task-queue/pkg/log"
+	"github.com/mnikita/task-queue/pkg/memory"
 	"github.com/mnikita/task-queue/pkg/util"
 	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -102,7 +108,7 @@ func TestTubeSet(t *testing.T) {
 	ch := mocks.NewMockChannels(m.ctrl)
 
 	m.dialer.EXPECT().Dial(gomock.Eq("127.0.0.1:11300"), gomock.Eq(m.bc.Tubes)).Return(m.conn, nil)
-	m.dialer.EXPECT().CreateChannels().Return(ch)
+	m.dialer.EXPECT().CreateChannels(m.conn, m.bc.Tubes).Return(ch)
 	m.conn.EXPECT().ListTubes().Return([]string{"mika", "pera", "laza"}, nil)
 	m.conn.EXPECT().Close()
 
@@ -122,7 +128,8 @@ func TestTube(t *testing.T) {
 	ch := mocks.NewMockChannel(m.ctrl)
 
 	m.dialer.EXPECT().Dial(gomock.Eq("127.0.0.1:11300"), gomock.Eq(m.bc.Tubes)).Return(m.conn, nil)
-	m.dialer.EXPECT().CreateChannel().Return(ch)
+	m.dialer.EXPECT().CreateChannel(m.conn, m.bc.Tubes[0]).Return(ch)
+	m.dialer.EXPECT().CreateChannels(m.conn, m.bc.Tubes).Return(mocks.NewMockChannels(m.ctrl))
 	m.conn.EXPECT().ListTubes().Return([]string{"mika"}, nil)
 	m.conn.EXPECT().Close()
 
@@ -157,6 +164,47 @@ func TestReserve(t *testing.T) {
 	assert.Nil(t, m.conn.Close())
 }
 
+func TestAdmin(t *testing.T) {
+	m := newMock(t)
+
+	m.bc.Url = "tcp://127.0.0.1:11300"
+	m.bc.Tubes = nil
+
+	stats := &consumer.TubeStats{Name: "mika", Ready: 2}
+
+	m.dialer.EXPECT().Dial(gomock.Eq("127.0.0.1:11300"), gomock.Eq(m.bc.Tubes)).Return(m.conn, nil)
+	m.conn.EXPECT().ListTubes().Return([]string{"mika"}, nil)
+	m.conn.EXPECT().PeekBuried("mika").Return(uint64(13), []byte("job"), nil)
+	m.conn.EXPECT().Kick("mika", 10).Return(1, nil)
+	m.conn.EXPECT().StatsTube("mika").Return(stats, nil)
+	m.conn.EXPECT().PauseTube("mika", time.Minute)
+
+	m.conn.EXPECT().Close()
+
+	defer setupTest(m)()
+
+	assert.Nil(t, m.handler.Init())
+
+	c := m.handler.(consumer.ConnectionHandler)
+
+	id, body, err := c.PeekBuried("mika")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(13), id)
+	assert.Equal(t, []byte("job"), body)
+
+	n, err := c.Kick("mika", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	tubeStats, err := c.StatsTube("mika")
+	assert.Nil(t, err)
+	assert.Equal(t, stats, tubeStats)
+
+	assert.Nil(t, c.PauseTube("mika", time.Minute))
+
+	assert.Nil(t, m.conn.Close())
+}
+
 func TestReserveTubeSeb(t *testing.T) {
 	m := newMock(t)
 
@@ -167,7 +215,7 @@ func TestReserveTubeSeb(t *testing.T) {
 	ch.EXPECT().Reserve(time.Second)
 
 	m.dialer.EXPECT().Dial(gomock.Eq("127.0.0.1:11300"), gomock.Eq(m.bc.Tubes)).Return(m.conn, nil)
-	m.dialer.EXPECT().CreateChannels().Return(ch)
+	m.dialer.EXPECT().CreateChannels(m.conn, m.bc.Tubes).Return(ch)
 	m.conn.EXPECT().ListTubes().Return([]string{"mika"}, nil)
 
 	m.conn.EXPECT().Close()
@@ -195,7 +243,8 @@ func TestPutTube(t *testing.T) {
 	ch.EXPECT().Put([]byte{}, uint32(1), time.Second, time.Second)
 
 	m.dialer.EXPECT().Dial(gomock.Eq("127.0.0.1:11300"), gomock.Eq(m.bc.Tubes)).Return(m.conn, nil)
-	m.dialer.EXPECT().CreateChannel().Return(ch)
+	m.dialer.EXPECT().CreateChannel(m.conn, m.bc.Tubes[0]).Return(ch)
+	m.dialer.EXPECT().CreateChannels(m.conn, m.bc.Tubes).Return(mocks.NewMockChannels(m.ctrl))
 	m.conn.EXPECT().ListTubes().Return([]string{"default"}, nil)
 
 	m.conn.EXPECT().Close()
@@ -222,7 +271,7 @@ func TestPutFaultTube(t *testing.T) {
 	ch := mocks.NewMockChannels(m.ctrl)
 
 	m.dialer.EXPECT().Dial(gomock.Eq("127.0.0.1:11300"), gomock.Eq(m.bc.Tubes)).Return(m.conn, nil)
-	m.dialer.EXPECT().CreateChannels().Return(ch)
+	m.dialer.EXPECT().CreateChannels(m.conn, m.bc.Tubes).Return(ch)
 	m.conn.EXPECT().ListTubes().Return([]string{"mika"}, nil)
 
 	m.conn.EXPECT().Close()
@@ -265,3 +314,274 @@ func TestPutFaultTube2(t *testing.T) {
 
 	assert.Nil(t, m.conn.Close())
 }
+
+func TestIsBrokenConnection(t *testing.T) {
+	assert.False(t, connection.IsBrokenConnection(nil))
+	assert.False(t, connection.IsBrokenConnection(errors.New("reserve-with-timeout: timeout")))
+	assert.True(t, connection.IsBrokenConnection(fmt.Errorf("reserve-with-timeout: %w", io.EOF)))
+	assert.True(t, connection.IsBrokenConnection(&net.OpError{Op: "read", Err: syscall.ECONNRESET}))
+}
+
+func TestReconnect(t *testing.T) {
+	m := newMock(t)
+
+	m.bc.Url = "tcp://127.0.0.1:11300"
+	m.bc.ReconnectBackoff = time.Millisecond * 10
+
+	eh := mocks.NewMockEventHandler(m.ctrl)
+	m.handler.SetEventHandler(eh)
+
+	conn := cmocks.NewMockConnectionHandler(m.ctrl)
+	broken := fmt.Errorf("reserve-with-timeout: %w", io.EOF)
+
+	gomock.InOrder(
+		m.dialer.EXPECT().Dial(gomock.Eq("127.0.0.1:11300"), gomock.Nil()).Return(m.conn, nil),
+		m.conn.EXPECT().ListTubes().Return([]string{"default"}, nil),
+		eh.EXPECT().OnConnect(),
+		m.conn.EXPECT().Reserve(time.Second).Return(uint64(0), nil, broken),
+		m.conn.EXPECT().Close(),
+		eh.EXPECT().OnDisconnect(broken),
+		m.dialer.EXPECT().Dial(gomock.Eq("127.0.0.1:11300"), gomock.Nil()).Return(nil, errors.New("refused")),
+		m.dialer.EXPECT().Dial(gomock.Eq("127.0.0.1:11300"), gomock.Nil()).Return(conn, nil),
+		conn.EXPECT().ListTubes().Return([]string{"default"}, nil),
+		eh.EXPECT().OnConnect(),
+		conn.EXPECT().Reserve(time.Second),
+		conn.EXPECT().Close(),
+	)
+
+	defer setupTest(m)()
+
+	assert.Nil(t, m.handler.Init())
+
+	c := m.handler.(consumer.ConnectionHandler)
+
+	_, _, err := c.Reserve(time.Second)
+	assert.Equal(t, broken, err)
+
+	_, _, err = c.Reserve(time.Second)
+	assert.Equal(t, log.ConnectionUnavailableError(), err)
+
+	//first attempt after 10ms fails, second after another 20ms succeeds
+	time.Sleep(time.Millisecond * 100)
+
+	_, _, err = c.Reserve(time.Second)
+	assert.Nil(t, err)
+
+	assert.Nil(t, m.handler.Close())
+	assert.Nil(t, m.handler.Close())
+}
+
+func TestCloseDuringOutage(t *testing.T) {
+	m := newMock(t)
+
+	m.bc.Url = "tcp://127.0.0.1:11300"
+	m.bc.ReconnectBackoff = time.Millisecond * 10
+
+	m.dialer.EXPECT().Dial(gomock.Eq("127.0.0.1:11300"), gomock.Nil()).Return(m.conn, nil)
+	m.conn.EXPECT().ListTubes().Return([]string{"default"}, nil)
+	m.conn.EXPECT().Delete(uint64(1)).Return(&net.OpError{Op: "write", Err: syscall.EPIPE})
+	m.conn.EXPECT().Close()
+	m.dialer.EXPECT().Dial(gomock.Eq("127.0.0.1:11300"), gomock.Nil()).Return(
+		nil, errors.New("refused")).AnyTimes()
+
+	defer setupTest(m)()
+
+	assert.Nil(t, m.handler.Init())
+
+	c := m.handler.(consumer.ConnectionHandler)
+
+	assert.NotNil(t, c.Delete(1))
+
+	time.Sleep(time.Millisecond * 30)
+
+	assert.Nil(t, m.handler.Close())
+
+	_, err := c.ListTubes()
+	assert.Equal(t, log.ConnectionUnavailableError(), err)
+}
+
+func TestSetTubes(t *testing.T) {
+	m := newMock(t)
+
+	m.bc.Url = "tcp://127.0.0.1:11300"
+	m.bc.Tubes = []string{"mika"}
+
+	tubes := []string{"mika", "pera"}
+
+	ch := mocks.NewMockChannel(m.ctrl)
+	chs := mocks.NewMockChannels(m.ctrl)
+	chs2 := mocks.NewMockChannels(m.ctrl)
+
+	m.dialer.EXPECT().Dial(gomock.Eq("127.0.0.1:11300"), gomock.Eq([]string{"mika"})).Return(m.conn, nil)
+	m.dialer.EXPECT().CreateChannel(m.conn, "mika").Return(ch)
+	m.dialer.EXPECT().CreateChannels(m.conn, []string{"mika"}).Return(chs)
+	m.dialer.EXPECT().CreateChannels(m.conn, tubes).Return(chs2)
+	m.conn.EXPECT().ListTubes().Return([]string{"mika"}, nil)
+
+	chs.EXPECT().Reserve(time.Second).Return(uint64(1), []byte("{}"), nil)
+	chs2.EXPECT().Reserve(time.Second)
+
+	//job reserved before change is deleted on the same connection
+	m.conn.EXPECT().Delete(uint64(1))
+	m.conn.EXPECT().Close()
+
+	defer setupTest(m)()
+
+	c := m.handler.(consumer.ConnectionHandler)
+
+	assert.Nil(t, m.handler.Init())
+
+	id, _, err := c.Reserve(time.Second)
+	assert.Nil(t, err)
+
+	assert.Nil(t, m.handler.SetTubes(tubes))
+	assert.Equal(t, tubes, m.bc.Tubes)
+
+	_, _, err = c.Reserve(time.Second)
+	assert.Nil(t, err)
+
+	assert.Nil(t, c.Delete(id))
+
+	assert.Nil(t, m.handler.Close())
+}
+
+func TestSetTubesInvalid(t *testing.T) {
+	m := newMock(t)
+
+	m.bc.Url = "tcp://127.0.0.1:11300"
+	m.bc.Tubes = nil
+
+	m.dialer.EXPECT().Dial(gomock.Eq("127.0.0.1:11300"), gomock.Nil()).Return(m.conn, nil)
+	m.conn.EXPECT().ListTubes().Return([]string{"default"}, nil)
+	m.conn.EXPECT().Close()
+
+	defer setupTest(m)()
+
+	assert.Nil(t, m.handler.Init())
+	assert.Equal(t, log.InvalidTubeNameError(""), m.handler.SetTubes([]string{"mika", ""}))
+
+	//previous tubes are kept
+	assert.Nil(t, m.bc.Tubes)
+
+	assert.Nil(t, m.handler.Close())
+}
+
+func TestSetTubesMemory(t *testing.T) {
+	broker := memory.NewBroker(memory.NewConfiguration())
+
+	config := connection.NewConfiguration()
+	config.Url = "memory://"
+	config.Tubes = []string{"mika"}
+
+	handler := connection.NewConnection(config, memory.NewDialer(broker))
+	c := consumer.ConnectionHandler(handler)
+
+	assert.Nil(t, handler.Init())
+
+	_, err := c.Put([]byte("{}"), 0, 0, time.Minute)
+	assert.Nil(t, err)
+
+	id, _, err := c.Reserve(0)
+	assert.Nil(t, err)
+
+	assert.Nil(t, handler.SetTubes([]string{"mika", "pera"}))
+
+	//reserved job is not released by reloading tubes
+	stats, err := c.StatsJob(id)
+	assert.Nil(t, err)
+	assert.Equal(t, memory.StateReserved, stats.State)
+
+	assert.Nil(t, c.Delete(id))
+	assert.Nil(t, handler.Close())
+}
+
+func TestWatchIgnore(t *testing.T) {
+	m := newMock(t)
+
+	m.bc.Url = "tcp://127.0.0.1:11300"
+	m.bc.Tubes = []string{"mika"}
+
+	ch := mocks.NewMockChannel(m.ctrl)
+	chs := mocks.NewMockChannels(m.ctrl)
+	watched := mocks.NewMockChannels(m.ctrl)
+	ignored := mocks.NewMockChannels(m.ctrl)
+
+	m.dialer.EXPECT().Dial(gomock.Eq("127.0.0.1:11300"), gomock.Eq([]string{"mika"})).Return(m.conn, nil)
+	m.dialer.EXPECT().CreateChannel(m.conn, "mika").Return(ch)
+	m.dialer.EXPECT().CreateChannels(m.conn, []string{"mika"}).Return(chs)
+	m.dialer.EXPECT().CreateChannels(m.conn, []string{"mika", "pera"}).Return(watched)
+	m.dialer.EXPECT().CreateChannels(m.conn, []string{"pera"}).Return(ignored)
+	m.conn.EXPECT().ListTubes().Return([]string{"mika"}, nil)
+	m.conn.EXPECT().Close()
+
+	//single tube is reserved through its tube set instead of default tube
+	gomock.InOrder(
+		chs.EXPECT().Reserve(time.Second),
+		watched.EXPECT().Reserve(time.Second),
+		ignored.EXPECT().Reserve(time.Second),
+	)
+
+	//jobs are put to configured tube regardless of watched tubes
+	ch.EXPECT().Name().Return("mika")
+	ch.EXPECT().Put([]byte{}, uint32(1), time.Second, time.Second)
+
+	defer setupTest(m)()
+
+	assert.Nil(t, m.handler.Init())
+
+	c := m.handler.(consumer.ConnectionHandler)
+
+	_, _, err := c.Reserve(time.Second)
+	assert.Nil(t, err)
+
+	assert.Nil(t, m.handler.Watch("pera"))
+	assert.Nil(t, m.handler.Watch("pera"))
+	assert.Equal(t, []string{"mika", "pera"}, m.handler.WatchedTubes())
+
+	//configuration copy does not share watched tubes
+	config := m.handler.ConfigCopy()
+	assert.Equal(t, []string{"mika", "pera"}, config.Tubes)
+	assert.Equal(t, m.bc.Url, config.Url)
+	config.Tubes[0] = "laza"
+	assert.Equal(t, []string{"mika", "pera"}, m.bc.Tubes)
+
+	_, _, err = c.Reserve(time.Second)
+	assert.Nil(t, err)
+
+	assert.Nil(t, m.handler.Ignore("mika"))
+	assert.Nil(t, m.handler.Ignore("laza"))
+	assert.Equal(t, log.LastWatchedTubeError("pera"), m.handler.Ignore("pera"))
+	assert.Equal(t, log.InvalidTubeNameError(""), m.handler.Watch(""))
+	assert.Equal(t, []string{"pera"}, m.bc.Tubes)
+
+	_, _, err = c.Reserve(time.Second)
+	assert.Nil(t, err)
+
+	_, err = c.Put([]byte{}, uint32(1), time.Second, time.Second)
+	assert.Nil(t, err)
+
+	assert.Nil(t, m.handler.Close())
+}
+
+func TestWatchDefaultTube(t *testing.T) {
+	m := newMock(t)
+
+	m.bc.Url = "tcp://127.0.0.1:11300"
+
+	chs := mocks.NewMockChannels(m.ctrl)
+
+	m.dialer.EXPECT().Dial(gomock.Eq("127.0.0.1:11300"), gomock.Nil()).Return(m.conn, nil)
+	m.dialer.EXPECT().CreateChannels(m.conn, []string{connection.DefaultTube, "mika"}).Return(chs)
+	m.conn.EXPECT().ListTubes().Return([]string{"default"}, nil)
+	m.conn.EXPECT().Close()
+
+	defer setupTest(m)()
+
+	assert.Nil(t, m.handler.Init())
+
+	assert.Equal(t, []string{connection.DefaultTube}, m.handler.WatchedTubes())
+	assert.Nil(t, m.handler.Watch("mika"))
+	assert.Equal(t, []string{connection.DefaultTube, "mika"}, m.handler.WatchedTubes())
+
+	assert.Nil(t, m.handler.Close())
+}
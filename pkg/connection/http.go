@@ -0,0 +1,109 @@
+package connection
+
+import (
+	"encoding/json"
+	"github.com/mnikita/task-queue/pkg/log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//PathTubes of watched tubes HTTP endpoint. GET lists watched tubes,
+//PUT PathTubes+tube watches and DELETE PathTubes+tube ignores the tube
+const PathTubes = "/tubes/"
+
+//TubesStatus is response of watched tubes endpoint
+type TubesStatus struct {
+	Tubes []string `json:"tubes"`
+	Error string   `json:"error,omitempty"`
+}
+
+//NewTubesHandler returns HTTP handler changing watched tubes of running connection
+func NewTubesHandler(handler Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tube := strings.TrimPrefix(r.URL.Path, PathTubes)
+
+		var err error
+
+		switch {
+		case r.Method == http.MethodGet && tube == "":
+		case r.Method == http.MethodPut && tube != "":
+			err = handler.Watch(tube)
+		case r.Method == http.MethodDelete && tube != "":
+			err = handler.Ignore(tube)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		status := &TubesStatus{Tubes: handler.WatchedTubes()}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err != nil {
+			status.Error = err.Error()
+
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+
+		_ = json.NewEncoder(w).Encode(status)
+	})
+}
+
+//TubesClient changes watched tubes of worker through its HTTP server
+type TubesClient struct {
+	//Worker HTTP server address, e.g. http://127.0.0.1:9090
+	Addr string
+
+	Client *http.Client
+}
+
+func NewTubesClient(addr string) *TubesClient {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+
+	return &TubesClient{Addr: strings.TrimSuffix(addr, "/"), Client: http.DefaultClient}
+}
+
+func (c *TubesClient) WatchedTubes() ([]string, error) {
+	return c.do(http.MethodGet, "")
+}
+
+func (c *TubesClient) Watch(tube string) ([]string, error) {
+	return c.do(http.MethodPut, tube)
+}
+
+func (c *TubesClient) Ignore(tube string) ([]string, error) {
+	return c.do(http.MethodDelete, tube)
+}
+
+func (c *TubesClient) do(method string, tube string) ([]string, error) {
+	req, err := http.NewRequest(method, c.Addr+PathTubes+url.PathEscape(tube), nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	status := &TubesStatus{}
+
+	if err = json.NewDecoder(resp.Body).Decode(status); err != nil {
+		return nil, log.WorkerRequestError(method, req.URL.String(), resp.Status)
+	}
+
+	if status.Error != "" {
+		return status.Tubes, log.WorkerRequestError(method, req.URL.String(), status.Error)
+	}
+
+	return status.Tubes, nil
+}
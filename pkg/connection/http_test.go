@@ -0,0 +1,50 @@
+package connection_test
+
+import (
+	"github.com/golang/mock/gomock"
+	"github.com/mnikita/task-queue/pkg/connection"
+	"github.com/mnikita/task-queue/pkg/connection/mocks"
+	"github.com/mnikita/task-queue/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTubesHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	handler := mocks.NewMockHandler(ctrl)
+
+	mux := http.NewServeMux()
+	mux.Handle(connection.PathTubes, connection.NewTubesHandler(handler))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := connection.NewTubesClient(server.URL)
+
+	gomock.InOrder(
+		handler.EXPECT().WatchedTubes().Return([]string{"mika"}),
+		handler.EXPECT().Watch("pera"),
+		handler.EXPECT().WatchedTubes().Return([]string{"mika", "pera"}),
+		handler.EXPECT().Ignore("pera").Return(log.LastWatchedTubeError("pera")),
+		handler.EXPECT().WatchedTubes().Return([]string{"pera"}),
+	)
+
+	tubes, err := client.WatchedTubes()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"mika"}, tubes)
+
+	tubes, err = client.Watch("pera")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"mika", "pera"}, tubes)
+
+	_, err = client.Ignore("pera")
+	assert.Contains(t, err.Error(), log.LastWatchedTubeError("pera").Error())
+
+	resp, err := http.Post(server.URL+connection.PathTubes, "application/json", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
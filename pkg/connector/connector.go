@@ -5,7 +5,10 @@ import (
 	"github.com/google/wire"
 	"github.com/mnikita/task-queue/pkg/common"
 	"github.com/mnikita/task-queue/pkg/log"
+	"github.com/mnikita/task-queue/pkg/metrics"
 	"github.com/mnikita/task-queue/pkg/util"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,9 +21,24 @@ type Handler interface {
 
 	Config() *Configuration
 
+	//Flush waits for pending task events to be accepted or time out
+	Flush()
+
 	SetTaskEventChannel(eventChannel chan<- *common.TaskProcessEvent)
 	SetTaskQueueChannel(taskQueueChannel chan<- *common.Task)
 	SetEventHandler(eventHandler common.TaskQueueEventHandler)
+
+	//SetTaskRouter sets router of tasks to dedicated queues. All tasks are queued on task queue channel if not set
+	SetTaskRouter(router common.TaskRouter)
+
+	//SetMetrics sets metrics timeouts are recorded to. Metrics are not recorded if not set
+	SetMetrics(metrics *metrics.Metrics)
+
+	//Reload replaces timeouts used for tasks and events sent after the call
+	Reload(config *Configuration)
+
+	//AcceptTimeouts returns number of tasks not accepted by worker queue in time
+	AcceptTimeouts() uint64
 }
 
 type Connector struct {
@@ -30,7 +48,18 @@ type Connector struct {
 
 	eventHandler common.TaskQueueEventHandler
 
+	taskRouter common.TaskRouter
+
+	metrics *metrics.Metrics
+
 	*Configuration
+
+	//guards configuration replaced on reload
+	mux sync.RWMutex
+
+	pending sync.WaitGroup
+
+	acceptTimeouts uint64
 }
 
 type Configuration struct {
@@ -38,14 +67,30 @@ type Configuration struct {
 	WaitToAcceptEvent        time.Duration
 }
 
+//timeouts returns current task and event accept timeouts
+func (c *Connector) timeouts() (task time.Duration, event time.Duration) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	return c.WaitToAcceptConsumerTask, c.WaitToAcceptEvent
+}
+
 func (c *Connector) sendProcessEvent(event *common.TaskProcessEvent) {
 	//send events asynchronously to avoid blocking execution thread for a task
 	//timeout to prevent thread leaks
+	c.pending.Add(1)
+
+	_, timeout := c.timeouts()
+
 	go func() {
+		defer c.pending.Done()
+
 		select {
 		case c.taskEventChannel <- event:
-		case <-time.After(c.WaitToAcceptEvent):
-			log.Logger().TaskProcessEventTimeout(event.GetEventType(), event.Task.Name, c.WaitToAcceptEvent)
+		case <-time.After(timeout):
+			log.Logger().TaskProcessEventTimeout(event.GetEventType(), event.Task.Name, timeout)
+
+			c.metrics.EventTimeout(event.GetEventType(), event.Task)
 		}
 	}()
 }
@@ -75,6 +120,10 @@ func (c *Connector) Config() *Configuration {
 	return c.Configuration
 }
 
+func (c *Connector) Flush() {
+	c.pending.Wait()
+}
+
 func (c *Connector) SetTaskEventChannel(
 	eventChannel chan<- *common.TaskProcessEvent) {
 	c.taskEventChannel = eventChannel
@@ -88,12 +137,50 @@ func (c *Connector) SetEventHandler(eventHandler common.TaskQueueEventHandler) {
 	c.eventHandler = eventHandler
 }
 
-//Handles task payload from consumer
+func (c *Connector) SetTaskRouter(router common.TaskRouter) {
+	c.taskRouter = router
+}
+
+func (c *Connector) SetMetrics(metrics *metrics.Metrics) {
+	c.metrics = metrics
+}
+
+func (c *Connector) AcceptTimeouts() uint64 {
+	return atomic.LoadUint64(&c.acceptTimeouts)
+}
+
+func (c *Connector) Reload(config *Configuration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	*c.Configuration = *config
+}
+
+//Handles task payload from consumer. Task is stamped with hand over time,
+//so every payload must be given its own task
 func (c *Connector) HandlePayload(task *common.Task) {
+	task.ReceivedAt = time.Now()
+
+	if !util.IsNil(c.taskRouter) {
+		//dedicated queue does not block consumer
+		if queue, releaseDelay := c.taskRouter.RouteTask(task); queue != nil {
+			select {
+			case queue <- task:
+				c.OnTaskQueued(task)
+			default:
+				c.OnTaskQueueFull(task, releaseDelay)
+			}
+
+			return
+		}
+	}
+
+	timeout, _ := c.timeouts()
+
 	select {
 	case c.taskQueueChannel <- task:
 		c.OnTaskQueued(task)
-	case <-time.After(c.WaitToAcceptConsumerTask):
+	case <-time.After(timeout):
 		c.OnTaskAcceptTimeout(task)
 	}
 }
@@ -114,6 +201,12 @@ func (c *Connector) OnTaskError(task *common.Task, err error) {
 		Err:  err})
 }
 
+func (c *Connector) OnTaskRelease(task *common.Task, delay time.Duration) {
+	c.sendProcessEvent(&common.TaskProcessEvent{EventId: common.Release,
+		Task:  task,
+		Delay: delay})
+}
+
 func (c *Connector) OnTaskResult(task *common.Task, a ...interface{}) {
 	c.sendProcessEvent(&common.TaskProcessEvent{EventId: common.Result,
 		Task:   task,
@@ -128,8 +221,27 @@ func (c *Connector) OnTaskQueued(task *common.Task) {
 	}
 }
 
+func (c *Connector) OnTaskQueueFull(task *common.Task, releaseDelay time.Duration) {
+	log.Logger().TaskQueueFull(task.Name, releaseDelay)
+
+	c.OnTaskRelease(task, releaseDelay)
+
+	if h, ok := c.eventHandler.(common.TaskQueueFullHandler); ok && !util.IsNil(h) {
+		h.OnTaskQueueFull(task, releaseDelay)
+	}
+}
+
 func (c *Connector) OnTaskAcceptTimeout(task *common.Task) {
-	log.Logger().TaskQueueTimeout(task.Name, c.WaitToAcceptConsumerTask)
+	timeout, _ := c.timeouts()
+
+	log.Logger().TaskQueueTimeout(task.Name, timeout)
+
+	atomic.AddUint64(&c.acceptTimeouts, 1)
+
+	c.metrics.AcceptTimeout(task)
+
+	//release job to be retried instead of waiting for time to run to expire
+	c.OnTaskRelease(task, 0)
 
 	if !util.IsNil(c.eventHandler) {
 		c.eventHandler.OnTaskAcceptTimeout(task)
@@ -7,8 +7,13 @@ import (
 	"github.com/google/wire"
 	"github.com/mnikita/task-queue/pkg/common"
 	"github.com/mnikita/task-queue/pkg/connector"
+	"github.com/mnikita/task-queue/pkg/health"
 	"github.com/mnikita/task-queue/pkg/log"
+	"github.com/mnikita/task-queue/pkg/metrics"
+	"github.com/mnikita/task-queue/pkg/result"
 	"github.com/mnikita/task-queue/pkg/util"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -30,8 +35,30 @@ type ConnectionHandler interface {
 	Bury(id uint64, pri uint32) error
 	Touch(id uint64) error
 	Put(body []byte, pri uint32, delay, ttr time.Duration) (id uint64, err error)
+	PutTube(tube string, body []byte, pri uint32, delay, ttr time.Duration) (id uint64, err error)
+	ReserveTube(tube string, timeout time.Duration) (id uint64, body []byte, err error)
+	Peek(id uint64) (body []byte, err error)
 	ListTubes() ([]string, error)
 
+	//PeekReady returns next ready job of the tube
+	PeekReady(tube string) (id uint64, body []byte, err error)
+	//PeekDelayed returns delayed job of the tube with shortest delay left
+	PeekDelayed(tube string) (id uint64, body []byte, err error)
+	//PeekBuried returns next buried job of the tube
+	PeekBuried(tube string) (id uint64, body []byte, err error)
+
+	//Kick moves up to bound buried jobs of the tube, or delayed jobs if there are none buried, to ready queue
+	Kick(tube string, bound int) (n int, err error)
+	//KickJob moves buried or delayed job to ready queue
+	KickJob(id uint64) error
+
+	StatsJob(id uint64) (*JobStats, error)
+	StatsTube(tube string) (*TubeStats, error)
+	Stats() (*ServerStats, error)
+
+	//PauseTube delays reserving new jobs from the tube
+	PauseTube(tube string, delay time.Duration) error
+
 	Close() error
 }
 
@@ -46,8 +73,24 @@ type Handler interface {
 	SetEventHandler(handler EventHandler)
 	SetTaskPayloadHandler(handler common.TaskPayloadHandler)
 
+	//SetResultStore sets store task outcomes are recorded to. Outcomes are not recorded if not set
+	SetResultStore(store result.Store)
+
+	//SetMetrics sets metrics job activity is recorded to. Metrics are not recorded if not set
+	SetMetrics(metrics *metrics.Metrics)
+
+	//SetMonitor sets health monitor consumer loop and connection activity is reported to
+	SetMonitor(monitor *health.Monitor)
+
 	StartConsumer() error
 	StopConsumer()
+
+	//Drain stops reserving new jobs while task events are still handled
+	Drain()
+
+	//Reload applies reloadable values of configuration, see Configuration.merge.
+	//Running consumer applies them between reserves
+	Reload(config *Configuration)
 }
 
 //Consumer stores configuration for consumer activation
@@ -60,10 +103,34 @@ type Consumer struct {
 
 	taskPayloadHandler common.TaskPayloadHandler
 
+	resultStore result.Store
+
+	metrics *metrics.Metrics
+	monitor *health.Monitor
+
 	*Configuration
 
 	taskEventChannel chan *common.TaskProcessEvent
 	quitChannel      chan bool
+	drainChannel     chan bool
+	reloadChannel    chan *Configuration
+
+	//set while consumer thread is running
+	running int32
+
+	//reserved jobs handed over to task payload handler
+	inFlight map[uint64]*common.Task
+
+	//jobs released without failure, e.g. turned away by busy worker.
+	//Their reserves are not counted as attempts
+	released       map[uint64]*releasedJob
+	releasedPruned time.Time
+}
+
+//releasedJob counts releases of the job which were not failures
+type releasedJob struct {
+	count int
+	at    time.Time
 }
 
 //Configuration stores initialization data for worker server
@@ -77,15 +144,38 @@ type Configuration struct {
 	ReleasePriority uint32
 	ReleaseDelay    time.Duration
 	BuryPriority    uint32
+
+	//Retry policy for tasks without own policy. Failed tasks are buried if not set
+	RetryPolicy *RetryPolicy
+
+	//Retry policies by task name
+	TaskRetryPolicies map[string]*RetryPolicy
+
+	//Tube failed and invalid jobs are moved to. Jobs are buried if not set
+	DeadLetterTube string
+
+	//Read job stats after reserve to provide tasks with job details like time to run.
+	//Enabled by container if worker touches or times out jobs by their time to run
+	FetchJobStats bool
 }
 
-//hard coded to avoid dependency on go-beanstalkd library only for one constant
-var ErrTimeout = errors.New("timeout")
+//hard coded to avoid dependency on go-beanstalkd library only for few constants
+var (
+	ErrTimeout      = errors.New("timeout")
+	ErrDeadlineSoon = errors.New("deadline soon")
+	ErrNotFound     = errors.New("not found")
+)
 
 const (
 	//Channel size to allocate. It is important for task implementation to send event
 	//asynchronously to avoid blocking the execution thread
 	TaskEventChannelSize = 1
+
+	//Time to run of reply jobs put to caller reply tube
+	ReplyTtr = time.Minute
+
+	//Time releases without failure are remembered after last release of the job
+	releasedRetention = time.Hour
 )
 
 //HandlePayload unmarshal payload data into Task instance to invoke given TaskPayloadHandler
@@ -102,6 +192,22 @@ func (con *Consumer) handlePayload(id uint64, body []byte) error {
 		return log.InvalidReserveTaskPayloadError(id, err)
 	}
 
+	if con.FetchJobStats {
+		con.readJobStats(task)
+	}
+
+	con.inFlight[id] = task
+
+	con.metrics.JobReserved(task)
+
+	con.recordResult(task, func(record *result.Record) {
+		record.Status = result.StatusRunning
+		record.StartedAt = time.Now().UTC()
+		record.FinishedAt = time.Time{}
+		record.Results = nil
+		record.Error = ""
+	})
+
 	con.taskPayloadHandler.HandlePayload(task)
 
 	return nil
@@ -112,15 +218,51 @@ func (con *Consumer) handleTaskEvent(taskProcessEvent *common.TaskProcessEvent)
 
 	log.Logger().TaskProcessEvent(taskProcessEvent.GetEventType(), taskProcessEvent.Task.Name)
 
+	task := taskProcessEvent.Task
+
 	switch taskProcessEvent.EventId {
 	case common.Error:
-		err = con.Bury(taskProcessEvent.Task.Id, con.BuryPriority)
+		delete(con.inFlight, task.Id)
+		con.metrics.JobFailed(task)
+		con.recordResult(task, func(record *result.Record) {
+			record.Status = result.StatusError
+			record.FinishedAt = time.Now().UTC()
+
+			if taskProcessEvent.Err != nil {
+				record.Error = taskProcessEvent.Err.Error()
+			}
+		})
+
+		err = con.handleTaskError(task, taskProcessEvent.Err)
 	case common.Success:
-		err = con.Delete(taskProcessEvent.Task.Id)
+		delete(con.inFlight, task.Id)
+		delete(con.released, task.Id)
+		con.recordResult(task, func(record *result.Record) {
+			record.Status = result.StatusSuccess
+			record.FinishedAt = time.Now().UTC()
+		})
+
+		con.reply(task, nil)
+		con.metrics.JobSucceeded(task)
+
+		err = con.Delete(task.Id)
 	case common.Heartbeat:
-		err = con.Touch(taskProcessEvent.Task.Id)
+		con.metrics.JobTouched(task)
+
+		err = con.Touch(task.Id)
 	case common.Result:
-		//ignoring return result
+		con.recordResult(task, func(record *result.Record) {
+			record.Results = append(record.Results, taskProcessEvent.Result...)
+		})
+	case common.Release:
+		delete(con.inFlight, task.Id)
+		con.recordResult(task, func(record *result.Record) {
+			record.Status = result.StatusReleased
+		})
+		con.metrics.JobReleased(task)
+		con.countRelease(task.Id)
+
+		err = con.Release(task.Id, con.ReleasePriority, taskProcessEvent.Delay)
 	}
 
 	if err != nil {
@@ -128,45 +270,408 @@ func (con *Consumer) handleTaskEvent(taskProcessEvent *common.TaskProcessEvent)
 	}
 }
 
-func (con *Consumer) handleConsume() {
-	con.OnStartConsume()
-	defer con.OnEndConsume()
+//recordResult updates stored task outcome. Result events may arrive after task is finished
+func (con *Consumer) recordResult(task *common.Task, update func(record *result.Record)) {
+	if util.IsNil(con.resultStore) {
+		return
+	}
 
-	for {
-		id, body, err := con.Reserve(con.WaitForConsumerReserve)
+	record, err := con.resultStore.Get(task.Id)
+
+	if err != nil {
+		record = &result.Record{JobId: task.Id, TaskName: task.Name}
+	}
+
+	update(record)
+
+	if err = con.resultStore.Save(record); err != nil {
+		log.Logger().Error(err)
+	}
+}
+
+//handleTaskError releases failed task with retry delay.
+//Task is moved to dead-letter tube or buried if retry policy is exhausted
+func (con *Consumer) handleTaskError(task *common.Task, cause error) error {
+	policy := con.retryPolicy(task.Name)
+
+	if policy != nil {
+		attempts, err := con.attempts(task.Id)
 
 		if err != nil {
-			if err.Error() == ErrTimeout.Error() {
-				con.OnReserveTimeout()
-			} else {
-				log.Logger().Error(err)
+			log.Logger().Error(err)
+		} else if policy.Exhausted(attempts) {
+			log.Logger().TaskRetryExhausted(task.Name, attempts)
+		} else {
+			delay := policy.Delay(attempts, con.ReleaseDelay)
+
+			log.Logger().TaskRetry(task.Name, attempts, delay)
+
+			con.metrics.JobReleased(task)
+
+			return con.Release(task.Id, con.ReleasePriority, delay)
+		}
+	}
+
+	con.reply(task, cause)
+
+	if con.DeadLetterTube == "" {
+		return con.bury(task)
+	}
+
+	//dead letter keeps original job body, which may hold fields unknown to task envelope
+	body, err := con.Peek(task.Id)
+
+	if err != nil {
+		log.Logger().Error(err)
+
+		return con.bury(task)
+	}
+
+	return con.deadLetter(task, body, cause)
+}
+
+//bury buries the job of the task
+func (con *Consumer) bury(task *common.Task) error {
+	delete(con.released, task.Id)
+
+	con.metrics.JobBuried(task)
+
+	return con.Bury(task.Id, con.BuryPriority)
+}
+
+//reply puts task outcome to reply tube of the waiting caller. Nothing is sent if task has no reply tube
+//or caller stopped waiting, as nobody would delete the reply from the tube
+func (con *Consumer) reply(task *common.Task, cause error) {
+	if task.ReplyTo == "" {
+		return
+	}
+
+	if task.ReplyDeadline != nil && time.Now().After(*task.ReplyDeadline) {
+		log.Logger().ConsumerReplyLate(task.Id, task.ReplyTo, *task.ReplyDeadline)
+
+		return
+	}
+
+	reply := &common.Reply{
+		CorrelationId: task.CorrelationId,
+		JobId:         task.Id,
+		Timestamp:     time.Now().UTC(),
+	}
+
+	if cause != nil {
+		reply.Error = cause.Error()
+	}
+
+	for _, r := range task.Results {
+		data, err := json.Marshal(r)
+
+		if err != nil {
+			log.Logger().Error(err)
+
+			continue
+		}
+
+		reply.Results = append(reply.Results, data)
+	}
+
+	data, err := json.Marshal(reply)
+
+	if err == nil {
+		_, err = con.PutTube(task.ReplyTo, data, con.ReleasePriority, 0, ReplyTtr)
+	}
+
+	if err != nil {
+		log.Logger().Error(err)
+
+		return
+	}
+
+	log.Logger().ConsumerReply(task.Id, task.ReplyTo)
+}
+
+//deadLetter puts job with failure details to dead-letter tube and deletes the original job.
+//Job is buried if dead-letter tube is not configured or cannot be written to
+func (con *Consumer) deadLetter(task *common.Task, body []byte, cause error) error {
+	id := task.Id
+
+	defer delete(con.released, id)
+
+	if con.DeadLetterTube == "" {
+		return con.bury(task)
+	}
+
+	stats, err := con.StatsJob(id)
+
+	if err != nil {
+		log.Logger().Error(err)
+
+		return con.bury(task)
+	}
+
+	letter := &common.DeadLetter{
+		JobId:     id,
+		Tube:      stats.Tube,
+		Attempts:  con.attemptsOf(id, stats),
+		Timestamp: time.Now().UTC(),
+		Body:      body,
+	}
+
+	if cause != nil {
+		letter.Error = cause.Error()
+	}
+
+	data, err := json.Marshal(letter)
+
+	if err != nil {
+		log.Logger().Error(err)
+
+		return con.bury(task)
+	}
+
+	_, err = con.PutTube(con.DeadLetterTube, data, stats.Priority, 0, stats.Ttr)
+
+	if err != nil {
+		log.Logger().Error(err)
+
+		return con.bury(task)
+	}
+
+	log.Logger().ConsumerDeadLetter(id, con.DeadLetterTube)
+
+	con.metrics.JobDeadLettered(task)
+
+	return con.Delete(id)
+}
+
+func (con *Consumer) retryPolicy(taskName string) *RetryPolicy {
+	if policy, ok := con.TaskRetryPolicies[taskName]; ok {
+		return policy
+	}
+
+	return con.RetryPolicy
+}
+
+//attempts reads number of times the job has been attempted from job stats
+func (con *Consumer) attempts(id uint64) (int, error) {
+	stats, err := con.StatsJob(id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return con.attemptsOf(id, stats), nil
+}
+
+//attemptsOf counts reserves of the job, except reserves this consumer released without failure
+func (con *Consumer) attemptsOf(id uint64, stats *JobStats) int {
+	r, ok := con.released[id]
+
+	if !ok {
+		return stats.Reserves
+	}
+
+	//current reserve is always an attempt
+	if stats.Reserves-r.count < 1 {
+		return 1
+	}
+
+	return stats.Reserves - r.count
+}
+
+//countRelease remembers release of the job which is not failure. Jobs not reserved again
+//by this consumer, e.g. finished by another worker, are forgotten after releasedRetention
+func (con *Consumer) countRelease(id uint64) {
+	now := time.Now()
+
+	if now.Sub(con.releasedPruned) > releasedRetention {
+		for releasedId, r := range con.released {
+			if now.Sub(r.at) > releasedRetention {
+				delete(con.released, releasedId)
 			}
-		} else if id != 0 {
-			err = con.handlePayload(id, body)
+		}
+
+		con.releasedPruned = now
+	}
+
+	r, ok := con.released[id]
+
+	if !ok {
+		r = &releasedJob{}
+		con.released[id] = r
+	}
+
+	r.count++
+	r.at = now
+}
+
+//readJobStats fills task with job details. Task is processed without details if stats are not available
+func (con *Consumer) readJobStats(task *common.Task) {
+	stats, err := con.StatsJob(task.Id)
+
+	if err != nil {
+		log.Logger().Error(err)
+
+		return
+	}
+
+	task.Ttr = stats.Ttr
+	task.Attempts = con.attemptsOf(task.Id, stats)
+	task.Tube = stats.Tube
+}
+
+//touchInFlight touches all reserved jobs handed over to task payload handler
+func (con *Consumer) touchInFlight() {
+	for id, task := range con.inFlight {
+		con.metrics.JobTouched(task)
+
+		if err := con.Touch(id); err != nil {
+			log.Logger().Error(err)
+		}
+	}
+}
+
+//IsTimeout reports whether err is reserve timeout error
+func IsTimeout(err error) bool {
+	return isConnError(err, ErrTimeout)
+}
+
+//IsDeadlineSoon reports whether err signals that reserved job time to run is about to expire
+func IsDeadlineSoon(err error) bool {
+	return isConnError(err, ErrDeadlineSoon)
+}
+
+//IsNotFound reports whether err is job not found error
+func IsNotFound(err error) bool {
+	return isConnError(err, ErrNotFound)
+}
+
+//isConnError compares error messages to avoid dependency on go-beanstalkd library.
+//Library errors are prefixed with operation name
+func isConnError(err error, target error) bool {
+	if err == nil {
+		return false
+	}
+
+	return err.Error() == target.Error() || strings.HasSuffix(err.Error(), ": "+target.Error())
+}
+
+func (con *Consumer) reserve() {
+	id, body, err := con.Reserve(con.WaitForConsumerReserve)
+
+	if err != nil {
+		if IsTimeout(err) {
+			con.monitor.ReserveCompleted()
+
+			con.OnReserveTimeout()
+		} else if IsDeadlineSoon(err) {
+			con.monitor.ReserveCompleted()
+
+			log.Logger().ConsumerDeadlineSoon()
+
+			con.touchInFlight()
+		} else {
+			con.monitor.ReserveFailed(err)
+
+			log.Logger().Error(err)
+		}
+	} else if id != 0 {
+		con.monitor.ReserveCompleted()
+
+		err = con.handlePayload(id, body)
+
+		if err != nil {
+			log.Logger().Error(err)
+
+			err = con.deadLetter(&common.Task{Id: id}, body, err)
 
 			if err != nil {
 				log.Logger().Error(err)
+			}
+		}
+	}
+}
+
+//flush handles task events already accepted and releases jobs still in flight
+func (con *Consumer) flush() {
+	for {
+		select {
+		case taskProcessEvent := <-con.taskEventChannel:
+			con.handleTaskEvent(taskProcessEvent)
+		default:
+			for id, task := range con.inFlight {
+				log.Logger().ConsumerReleaseInFlight(task.Name)
 
-				err = con.Bury(id, con.BuryPriority)
+				con.metrics.JobReleased(task)
+				con.countRelease(id)
 
-				if err != nil {
+				if err := con.Release(id, con.ReleasePriority, 0); err != nil {
 					log.Logger().Error(err)
 				}
+
+				delete(con.inFlight, id)
 			}
+
+			return
+		}
+	}
+}
+
+func (con *Consumer) handleConsume() {
+	con.monitor.ConsumerStarted()
+	defer con.monitor.ConsumerStopped()
+
+	con.OnStartConsume()
+	defer con.OnEndConsume()
+
+	reserving := true
+
+	for {
+		if reserving {
+			con.reserve()
 		}
 
 		select {
 		case <-con.quitChannel:
+			atomic.StoreInt32(&con.running, 0)
+
+			con.flush()
+
 			con.quitChannel <- true
 			return
+		case <-con.drainChannel:
+			reserving = false
+
+			con.monitor.ConsumerDraining()
+
+			con.drainChannel <- true
+		case config := <-con.reloadChannel:
+			con.merge(config)
+
+			con.reloadChannel <- config
 		case taskProcessEvent := <-con.taskEventChannel:
+			con.monitor.ConsumerActive()
+
 			con.handleTaskEvent(taskProcessEvent)
 		case <-time.After(con.Heartbeat):
+			con.monitor.ConsumerActive()
+
 			con.OnHeartbeat()
 		}
 	}
 }
 
+//merge copies values which can be changed without restart. Dead-letter tube may be set
+//by command line and job stats fetching by container, so they are kept
+func (c *Configuration) merge(config *Configuration) {
+	c.WaitForConsumerReserve = config.WaitForConsumerReserve
+	c.Heartbeat = config.Heartbeat
+	c.ReleasePriority = config.ReleasePriority
+	c.ReleaseDelay = config.ReleaseDelay
+	c.BuryPriority = config.BuryPriority
+	c.RetryPolicy = config.RetryPolicy
+	c.TaskRetryPolicies = config.TaskRetryPolicies
+}
+
 func NewConfiguration() *Configuration {
 	return &Configuration{
 		WaitForConsumerReserve: time.Second * 1,
@@ -195,7 +700,12 @@ func (con *Consumer) Init() error {
 	//important to allocate at least one slot to avoid
 	//blocking TaskProcessEventHandler while writing to the channel
 	con.taskEventChannel = make(chan *common.TaskProcessEvent, TaskEventChannelSize)
-	con.quitChannel = make(chan bool, 1)
+	//unbuffered to make sure stop and drain confirmations come from consumer thread
+	con.quitChannel = make(chan bool)
+	con.drainChannel = make(chan bool)
+	con.reloadChannel = make(chan *Configuration)
+	con.inFlight = make(map[uint64]*common.Task)
+	con.released = make(map[uint64]*releasedJob)
 
 	con.connectorHandler.SetTaskEventChannel(con.taskEventChannel)
 
@@ -207,6 +717,8 @@ func (con *Consumer) Close() error {
 
 	close(con.taskEventChannel)
 	close(con.quitChannel)
+	close(con.drainChannel)
+	close(con.reloadChannel)
 
 	if !util.IsNil(con.connectionHandler) {
 		return con.connectionHandler.Close()
@@ -231,6 +743,18 @@ func (con *Consumer) SetTaskPayloadHandler(handler common.TaskPayloadHandler) {
 	con.taskPayloadHandler = handler
 }
 
+func (con *Consumer) SetResultStore(store result.Store) {
+	con.resultStore = store
+}
+
+func (con *Consumer) SetMetrics(metrics *metrics.Metrics) {
+	con.metrics = metrics
+}
+
+func (con *Consumer) SetMonitor(monitor *health.Monitor) {
+	con.monitor = monitor
+}
+
 //StartConsumer starts consumer thread
 func (con *Consumer) StartConsumer() error {
 	if util.IsNil(con.connectionHandler) {
@@ -241,6 +765,8 @@ func (con *Consumer) StartConsumer() error {
 		return log.MissingTaskPayloadHandlerError()
 	}
 
+	atomic.StoreInt32(&con.running, 1)
+
 	go func() {
 		con.handleConsume()
 	}()
@@ -258,6 +784,30 @@ func (con *Consumer) StopConsumer() {
 	<-con.quitChannel
 }
 
+//Drain stops consumer from reserving new jobs
+func (con *Consumer) Drain() {
+	log.Logger().ConsumerDraining()
+	//send drain signal to consumer thread
+	con.drainChannel <- true
+
+	//wait for consumer thread to finish handing over reserved job
+	<-con.drainChannel
+}
+
+func (con *Consumer) Reload(config *Configuration) {
+	if atomic.LoadInt32(&con.running) == 0 {
+		con.merge(config)
+
+		return
+	}
+
+	//configuration is read by consumer thread, so it is replaced there
+	con.reloadChannel <- config
+
+	//wait for consumer thread to apply configuration
+	<-con.reloadChannel
+}
+
 func (con *Consumer) Reserve(timeout time.Duration) (id uint64, body []byte, err error) {
 	log.Logger().ConsumerReserve(timeout)
 
@@ -308,6 +858,30 @@ func (con *Consumer) Touch(id uint64) error {
 	return nil
 }
 
+func (con *Consumer) StatsJob(id uint64) (*JobStats, error) {
+	if !util.IsNil(con.connectionHandler) {
+		return con.connectionHandler.StatsJob(id)
+	}
+
+	return &JobStats{}, nil
+}
+
+func (con *Consumer) Peek(id uint64) ([]byte, error) {
+	if !util.IsNil(con.connectionHandler) {
+		return con.connectionHandler.Peek(id)
+	}
+
+	return nil, nil
+}
+
+func (con *Consumer) PutTube(tube string, body []byte, pri uint32, delay, ttr time.Duration) (uint64, error) {
+	if !util.IsNil(con.connectionHandler) {
+		return con.connectionHandler.PutTube(tube, body, pri, delay, ttr)
+	}
+
+	return 0, nil
+}
+
 func (con *Consumer) ListTubes() ([]string, error) {
 	if !util.IsNil(con.connectionHandler) {
 		return con.connectionHandler.ListTubes()
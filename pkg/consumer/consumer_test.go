@@ -1,6 +1,8 @@
 package consumer_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"github.com/golang/mock/gomock"
 	"github.com/mnikita/task-queue/pkg/common"
@@ -8,7 +10,11 @@ import (
 	"github.com/mnikita/task-queue/pkg/connector"
 	"github.com/mnikita/task-queue/pkg/consumer"
 	lmocks "github.com/mnikita/task-queue/pkg/consumer/mocks"
+	"github.com/mnikita/task-queue/pkg/metrics"
+	"github.com/mnikita/task-queue/pkg/result"
 	"github.com/mnikita/task-queue/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -253,3 +259,391 @@ func TestProcessEmptyPayload(t *testing.T) {
 
 	defer setupTest(m)()
 }
+
+func TestReleaseTask(t *testing.T) {
+	m := newMock(t)
+	m.cc.RetryPolicy = &consumer.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second * 2, Multiplier: 3}
+
+	releaseTask := &common.Task{Id: 13, Name: "add"}
+
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).Return(
+		uint64(13), []byte(`{"name": "add"}`), nil)
+	m.connectionH.EXPECT().StatsJob(uint64(13)).Return(&consumer.JobStats{Reserves: 2}, nil)
+	m.connectionH.EXPECT().Release(uint64(13), m.cc.ReleasePriority, time.Second*6)
+	m.taskPlh.EXPECT().HandlePayload(
+		gomock.Eq(releaseTask)).Do(func(task *common.Task) {
+		m.taskProcessEventHandler.OnTaskError(task, errors.New("test error"))
+	})
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).AnyTimes()
+
+	defer setupTest(m)()
+}
+
+func TestRetryAfterRelease(t *testing.T) {
+	m := newMock(t)
+	m.cc.RetryPolicy = &consumer.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Second * 2, Multiplier: 3}
+
+	task := &common.Task{Id: 13, Name: "add"}
+
+	//job turned away by busy worker is not counted as failed attempt
+	gomock.InOrder(
+		m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).Return(
+			uint64(13), []byte(`{"name": "add"}`), nil),
+		m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).Return(
+			uint64(13), []byte(`{"name": "add"}`), nil),
+		m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).AnyTimes(),
+	)
+
+	gomock.InOrder(
+		m.taskPlh.EXPECT().HandlePayload(gomock.Eq(task)).Do(func(task *common.Task) {
+			m.taskProcessEventHandler.OnTaskRelease(task, 0)
+		}),
+		m.taskPlh.EXPECT().HandlePayload(gomock.Eq(task)).Do(func(task *common.Task) {
+			m.taskProcessEventHandler.OnTaskError(task, errors.New("test error"))
+		}),
+	)
+
+	gomock.InOrder(
+		m.connectionH.EXPECT().Release(uint64(13), m.cc.ReleasePriority, time.Duration(0)),
+		m.connectionH.EXPECT().StatsJob(uint64(13)).Return(&consumer.JobStats{Reserves: 2}, nil),
+		m.connectionH.EXPECT().Release(uint64(13), m.cc.ReleasePriority, time.Second*2),
+	)
+
+	defer setupTest(m)()
+}
+
+func TestRetryExhausted(t *testing.T) {
+	m := newMock(t)
+	m.cc.RetryPolicy = consumer.NewRetryPolicy()
+	m.cc.TaskRetryPolicies = map[string]*consumer.RetryPolicy{
+		"add": {MaxAttempts: 3},
+	}
+
+	buryTask := &common.Task{Id: 13, Name: "add"}
+
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).Return(
+		uint64(13), []byte(`{"name": "add"}`), nil)
+	m.connectionH.EXPECT().StatsJob(uint64(13)).Return(&consumer.JobStats{Reserves: 3}, nil)
+	m.connectionH.EXPECT().Bury(uint64(13), m.getBuryPriority())
+	m.taskPlh.EXPECT().HandlePayload(
+		gomock.Eq(buryTask)).Do(func(task *common.Task) {
+		m.taskProcessEventHandler.OnTaskError(task, errors.New("test error"))
+	})
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).AnyTimes()
+
+	defer setupTest(m)()
+}
+
+func TestDeadLetterTask(t *testing.T) {
+	m := newMock(t)
+	m.cc.DeadLetterTube = "dead"
+
+	deadTask := &common.Task{Id: 13, Name: "add"}
+	stats := &consumer.JobStats{Tube: "default", Reserves: 1, Priority: 10, Ttr: time.Minute}
+
+	//fields unknown to task envelope are kept in dead letter
+	body := []byte(`{"name": "add", "extra": 1}`)
+
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).Return(uint64(13), body, nil)
+	m.connectionH.EXPECT().Peek(uint64(13)).Return(body, nil)
+	m.connectionH.EXPECT().StatsJob(uint64(13)).Return(stats, nil)
+	m.connectionH.EXPECT().PutTube("dead", gomock.Any(), uint32(10), time.Duration(0), time.Minute).Do(
+		func(_ string, data []byte, _ uint32, _, _ time.Duration) {
+			letter := &common.DeadLetter{}
+
+			assert.Nil(t, json.Unmarshal(data, letter))
+			assert.Equal(t, uint64(13), letter.JobId)
+			assert.Equal(t, "default", letter.Tube)
+			assert.Equal(t, 1, letter.Attempts)
+			assert.Equal(t, "test error", letter.Error)
+			assert.Equal(t, body, letter.Body)
+		})
+	m.connectionH.EXPECT().Delete(uint64(13))
+	m.taskPlh.EXPECT().HandlePayload(
+		gomock.Eq(deadTask)).Do(func(task *common.Task) {
+		m.taskProcessEventHandler.OnTaskError(task, errors.New("test error"))
+	})
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).AnyTimes()
+
+	defer setupTest(m)()
+}
+
+func TestDeadLetterInvalidPayload(t *testing.T) {
+	m := newMock(t)
+	m.cc.DeadLetterTube = "dead"
+
+	body := []byte(`{"name": "add", "payload":}`)
+
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).Return(uint64(13), body, nil)
+	m.connectionH.EXPECT().StatsJob(uint64(13)).Return(&consumer.JobStats{Tube: "default"}, nil)
+	m.connectionH.EXPECT().PutTube("dead", gomock.Any(), uint32(0), time.Duration(0), time.Duration(0)).Do(
+		func(_ string, data []byte, _ uint32, _, _ time.Duration) {
+			letter := &common.DeadLetter{}
+
+			assert.Nil(t, json.Unmarshal(data, letter))
+			assert.Equal(t, body, letter.Body)
+			assert.NotEmpty(t, letter.Error)
+		})
+	m.connectionH.EXPECT().Delete(uint64(13))
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).AnyTimes()
+
+	defer setupTest(m)()
+}
+
+func TestIsTimeout(t *testing.T) {
+	assert.True(t, consumer.IsTimeout(consumer.ErrTimeout))
+	assert.True(t, consumer.IsTimeout(errors.New("reserve-with-timeout: timeout")))
+	assert.False(t, consumer.IsTimeout(errors.New("reserve-with-timeout: deadline soon")))
+	assert.False(t, consumer.IsTimeout(nil))
+}
+
+func TestFetchJobStats(t *testing.T) {
+	m := newMock(t)
+	m.cc.FetchJobStats = true
+
+	reserveTask := &common.Task{Id: 13, Name: "add", Ttr: time.Minute, Attempts: 2}
+
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).Return(
+		uint64(13), []byte(`{"name": "add"}`), nil)
+	m.connectionH.EXPECT().StatsJob(uint64(13)).Return(&consumer.JobStats{Ttr: time.Minute, Reserves: 2}, nil)
+	m.connectionH.EXPECT().Delete(uint64(13))
+	m.taskPlh.EXPECT().HandlePayload(
+		gomock.Eq(reserveTask)).Do(func(task *common.Task) {
+		m.taskProcessEventHandler.OnTaskSuccess(task)
+	})
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).AnyTimes()
+
+	defer setupTest(m)()
+}
+
+func TestDeadlineSoon(t *testing.T) {
+	m := newMock(t)
+	//consumer reserves next job after heartbeat if no task event is received
+	m.cc.Heartbeat = time.Millisecond * 5
+
+	m.consumerEh.EXPECT().OnHeartbeat().AnyTimes()
+
+	reserveTask := &common.Task{Id: 13, Name: "add"}
+
+	gomock.InOrder(
+		m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).Return(
+			uint64(13), []byte(`{"name": "add"}`), nil),
+		m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).Return(
+			uint64(0), nil, errors.New("reserve-with-timeout: deadline soon")),
+		m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).AnyTimes(),
+	)
+
+	//task is still running when job deadline is about to expire
+	m.taskPlh.EXPECT().HandlePayload(gomock.Eq(reserveTask))
+	m.connectionH.EXPECT().Touch(uint64(13))
+
+	//job still in flight is released on consumer stop
+	m.connectionH.EXPECT().Release(uint64(13), m.cc.ReleasePriority, time.Duration(0))
+
+	defer setupTest(m)()
+}
+
+func TestReleaseOnAcceptTimeout(t *testing.T) {
+	m := newMock(t)
+
+	reserveTask := &common.Task{Id: 13, Name: "add"}
+
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).Return(
+		uint64(13), []byte(`{"name": "add"}`), nil)
+	m.connectionH.EXPECT().Release(uint64(13), m.cc.ReleasePriority, time.Duration(0))
+	m.taskPlh.EXPECT().HandlePayload(
+		gomock.Eq(reserveTask)).Do(func(task *common.Task) {
+		m.connector.(common.TaskQueueEventHandler).OnTaskAcceptTimeout(task)
+	})
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).AnyTimes()
+
+	defer setupTest(m)()
+}
+
+func TestDrain(t *testing.T) {
+	m := newMock(t)
+
+	reserveTask := &common.Task{Id: 13, Name: "add"}
+
+	var drained int32
+
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).Return(
+		uint64(13), []byte(`{"name": "add"}`), nil)
+	m.taskPlh.EXPECT().HandlePayload(gomock.Eq(reserveTask))
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).DoAndReturn(
+		func(timeout time.Duration) (uint64, []byte, error) {
+			assert.Equal(t, int32(0), atomic.LoadInt32(&drained), "reserve after drain")
+
+			return 0, nil, nil
+		}).AnyTimes()
+
+	//task events are still handled after drain
+	m.connectionH.EXPECT().Delete(uint64(13))
+
+	defer setupTest(m)()
+
+	m.consumer.Drain()
+	atomic.StoreInt32(&drained, 1)
+
+	m.taskProcessEventHandler.OnTaskSuccess(reserveTask)
+}
+
+func TestRecordResult(t *testing.T) {
+	m := newMock(t)
+
+	store := result.NewMemoryStore(0)
+	m.consumer.SetResultStore(store)
+
+	reserveTask := &common.Task{Id: 13, Name: "add"}
+
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).Return(
+		uint64(13), []byte(`{"name": "add"}`), nil)
+	m.connectionH.EXPECT().Delete(uint64(13))
+	m.taskPlh.EXPECT().HandlePayload(
+		gomock.Eq(reserveTask)).Do(func(task *common.Task) {
+		m.taskProcessEventHandler.OnTaskResult(task, 3)
+		//let result event take the event channel slot before success event
+		time.Sleep(time.Millisecond * 5)
+		m.taskProcessEventHandler.OnTaskSuccess(task)
+	})
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).AnyTimes()
+
+	setupTest(m)()
+
+	record, err := store.Get(13)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "add", record.TaskName)
+	assert.Equal(t, result.StatusSuccess, record.Status)
+	assert.Equal(t, []interface{}{3}, record.Results)
+	assert.False(t, record.StartedAt.IsZero())
+	assert.False(t, record.FinishedAt.IsZero())
+}
+
+func TestReplySuccess(t *testing.T) {
+	m := newMock(t)
+
+	replyTask := &common.Task{Id: 13, Name: "add", ReplyTo: "reply-1", CorrelationId: "1"}
+
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).Return(
+		uint64(13), []byte(`{"name": "add", "reply_to": "reply-1", "correlation_id": "1"}`), nil)
+	m.connectionH.EXPECT().PutTube("reply-1", gomock.Any(), m.cc.ReleasePriority, time.Duration(0),
+		consumer.ReplyTtr).Do(
+		func(_ string, body []byte, _ uint32, _, _ time.Duration) {
+			reply := &common.Reply{}
+
+			assert.Nil(t, json.Unmarshal(body, reply))
+			assert.Equal(t, "1", reply.CorrelationId)
+			assert.Equal(t, uint64(13), reply.JobId)
+			assert.Empty(t, reply.Error)
+			assert.Len(t, reply.Results, 1)
+			assert.JSONEq(t, `3`, string(reply.Results[0]))
+		})
+	m.connectionH.EXPECT().Delete(uint64(13))
+	m.taskPlh.EXPECT().HandlePayload(
+		gomock.Eq(replyTask)).Do(func(task *common.Task) {
+		task.Results = append(task.Results, 3)
+
+		m.taskProcessEventHandler.OnTaskSuccess(task)
+	})
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).AnyTimes()
+
+	defer setupTest(m)()
+}
+
+func TestReplyError(t *testing.T) {
+	m := newMock(t)
+
+	replyTask := &common.Task{Id: 13, Name: "add", ReplyTo: "reply-1", CorrelationId: "1"}
+
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).Return(
+		uint64(13), []byte(`{"name": "add", "reply_to": "reply-1", "correlation_id": "1"}`), nil)
+	m.connectionH.EXPECT().PutTube("reply-1", gomock.Any(), m.cc.ReleasePriority, time.Duration(0),
+		consumer.ReplyTtr).Do(
+		func(_ string, body []byte, _ uint32, _, _ time.Duration) {
+			reply := &common.Reply{}
+
+			assert.Nil(t, json.Unmarshal(body, reply))
+			assert.Equal(t, "1", reply.CorrelationId)
+			assert.Equal(t, "test error", reply.Error)
+			assert.Empty(t, reply.Results)
+		})
+	m.connectionH.EXPECT().Bury(uint64(13), m.getBuryPriority())
+	m.taskPlh.EXPECT().HandlePayload(
+		gomock.Eq(replyTask)).Do(func(task *common.Task) {
+		m.taskProcessEventHandler.OnTaskError(task, errors.New("test error"))
+	})
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).AnyTimes()
+
+	defer setupTest(m)()
+}
+
+func TestReplyLate(t *testing.T) {
+	m := newMock(t)
+
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).Return(uint64(13),
+		[]byte(`{"name": "add", "reply_to": "reply-1", "reply_deadline": "2020-01-01T00:00:00Z"}`), nil)
+	//reply is not put after caller stopped waiting
+	m.connectionH.EXPECT().Delete(uint64(13))
+	m.taskPlh.EXPECT().HandlePayload(gomock.Any()).Do(func(task *common.Task) {
+		m.taskProcessEventHandler.OnTaskSuccess(task)
+	})
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).AnyTimes()
+
+	defer setupTest(m)()
+}
+
+func TestMetrics(t *testing.T) {
+	m := newMock(t)
+
+	taskMetrics := metrics.NewMetrics()
+	m.consumer.SetMetrics(taskMetrics)
+
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).Return(
+		uint64(13), []byte(`{"name": "add"}`), nil)
+	m.connectionH.EXPECT().Bury(uint64(13), m.getBuryPriority())
+	m.taskPlh.EXPECT().HandlePayload(gomock.Any()).Do(func(task *common.Task) {
+		m.taskProcessEventHandler.OnTaskError(task, errors.New("test error"))
+	})
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).AnyTimes()
+
+	setupTest(m)()
+
+	var buf bytes.Buffer
+
+	assert.Nil(t, taskMetrics.Registry().Write(&buf))
+	assert.Contains(t, buf.String(), `task_queue_jobs_reserved_total{task="add",tube=""} 1`)
+	assert.Contains(t, buf.String(), `task_queue_jobs_failed_total{task="add",tube=""} 1`)
+	assert.Contains(t, buf.String(), `task_queue_jobs_buried_total{task="add",tube=""} 1`)
+}
+
+func TestReload(t *testing.T) {
+	m := newMock(t)
+
+	config := *m.cc
+	config.WaitForConsumerReserve = time.Millisecond * 20
+	config.ReleaseDelay = time.Second
+	config.DeadLetterTube = "dead"
+	config.FetchJobStats = true
+
+	var reloaded int32
+
+	m.connectionH.EXPECT().Reserve(m.getWaitForConsumerReserve()).DoAndReturn(
+		func(timeout time.Duration) (uint64, []byte, error) {
+			assert.Equal(t, int32(0), atomic.LoadInt32(&reloaded), "reserve with previous timeout")
+
+			return 0, nil, nil
+		}).AnyTimes()
+	m.connectionH.EXPECT().Reserve(config.WaitForConsumerReserve).MinTimes(1)
+
+	defer setupTest(m)()
+
+	m.consumer.Reload(&config)
+	atomic.StoreInt32(&reloaded, 1)
+
+	assert.Equal(t, time.Second, m.cc.ReleaseDelay)
+
+	//values set at start are kept
+	assert.Equal(t, "", m.cc.DeadLetterTube)
+	assert.False(t, m.cc.FetchJobStats)
+}
@@ -0,0 +1,77 @@
+package consumer
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+//RetryPolicy defines how failed tasks are released back to the tube before they get buried
+type RetryPolicy struct {
+	//Maximum number of attempts, including the first one
+	MaxAttempts int
+
+	//Delay before the first retry. Consumer ReleaseDelay is used if not set
+	BaseDelay time.Duration
+
+	//Factor the delay grows by on every next retry
+	Multiplier float64
+
+	//Fraction of the delay randomly added or subtracted to spread retries
+	Jitter float64
+
+	//Upper limit for the delay. Not limited if not set
+	MaxDelay time.Duration
+}
+
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   time.Second * 5,
+		Multiplier:  2,
+		Jitter:      0.1,
+		MaxDelay:    time.Minute * 10,
+	}
+}
+
+//Exhausted reports whether there are no attempts left after given number of attempts
+func (p *RetryPolicy) Exhausted(attempts int) bool {
+	return attempts >= p.MaxAttempts
+}
+
+//Delay calculates release delay after given number of failed attempts
+func (p *RetryPolicy) Delay(attempts int, baseDelay time.Duration) time.Duration {
+	if p.BaseDelay > 0 {
+		baseDelay = p.BaseDelay
+	}
+
+	multiplier := p.Multiplier
+
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	delay := float64(baseDelay) * math.Pow(multiplier, float64(attempts-1))
+
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (rand.Float64()*2 - 1)
+	}
+
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+
+	return time.Duration(delay)
+}
@@ -0,0 +1,39 @@
+package consumer_test
+
+import (
+	"github.com/mnikita/task-queue/pkg/consumer"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	p := &consumer.RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, Multiplier: 2,
+		MaxDelay: time.Second * 5}
+
+	assert.Equal(t, time.Second, p.Delay(1, time.Minute))
+	assert.Equal(t, time.Second*2, p.Delay(2, time.Minute))
+	assert.Equal(t, time.Second*4, p.Delay(3, time.Minute))
+	assert.Equal(t, time.Second*5, p.Delay(4, time.Minute))
+}
+
+func TestRetryDelayDefaults(t *testing.T) {
+	p := &consumer.RetryPolicy{MaxAttempts: 2}
+
+	//consumer release delay is used as base delay, multiplier defaults to constant delay
+	assert.Equal(t, time.Second*3, p.Delay(1, time.Second*3))
+	assert.Equal(t, time.Second*3, p.Delay(2, time.Second*3))
+
+	assert.False(t, p.Exhausted(1))
+	assert.True(t, p.Exhausted(2))
+}
+
+func TestRetryDelayJitter(t *testing.T) {
+	p := &consumer.RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second * 10, Jitter: 0.5}
+
+	for i := 0; i < 100; i++ {
+		d := p.Delay(1, 0)
+
+		assert.True(t, d >= time.Second*5 && d <= time.Second*15)
+	}
+}
@@ -0,0 +1,281 @@
+package consumer
+
+import (
+	"encoding/json"
+	"github.com/mnikita/task-queue/pkg/log"
+	"strconv"
+	"time"
+)
+
+//Job stats fields
+const (
+	JobStatsId       = "id"
+	JobStatsTube     = "tube"
+	JobStatsState    = "state"
+	JobStatsPriority = "pri"
+	JobStatsAge      = "age"
+	JobStatsDelay    = "delay"
+	JobStatsTtr      = "ttr"
+	JobStatsTimeLeft = "time-left"
+	JobStatsReserves = "reserves"
+	JobStatsTimeouts = "timeouts"
+	JobStatsReleases = "releases"
+	JobStatsBuries   = "buries"
+	JobStatsKicks    = "kicks"
+)
+
+//Tube stats fields
+const (
+	TubeStatsName          = "name"
+	TubeStatsUrgent        = "current-jobs-urgent"
+	TubeStatsReady         = "current-jobs-ready"
+	TubeStatsReserved      = "current-jobs-reserved"
+	TubeStatsDelayed       = "current-jobs-delayed"
+	TubeStatsBuried        = "current-jobs-buried"
+	TubeStatsTotalJobs     = "total-jobs"
+	TubeStatsUsing         = "current-using"
+	TubeStatsWatching      = "current-watching"
+	TubeStatsWaiting       = "current-waiting"
+	TubeStatsDeletes       = "cmd-delete"
+	TubeStatsPauses        = "cmd-pause-tube"
+	TubeStatsPause         = "pause"
+	TubeStatsPauseTimeLeft = "pause-time-left"
+)
+
+//Server stats fields
+const (
+	StatsUrgent      = "current-jobs-urgent"
+	StatsReady       = "current-jobs-ready"
+	StatsReserved    = "current-jobs-reserved"
+	StatsDelayed     = "current-jobs-delayed"
+	StatsBuried      = "current-jobs-buried"
+	StatsTotalJobs   = "total-jobs"
+	StatsTimeouts    = "job-timeouts"
+	StatsTubes       = "current-tubes"
+	StatsConnections = "current-connections"
+	StatsProducers   = "current-producers"
+	StatsWorkers     = "current-workers"
+	StatsWaiting     = "current-waiting"
+	StatsPid         = "pid"
+	StatsVersion     = "version"
+	StatsUptime      = "uptime"
+	StatsHostname    = "hostname"
+)
+
+//JobStats describes job as reported by stats-job command
+type JobStats struct {
+	Id       uint64        `json:"id"`
+	Tube     string        `json:"tube"`
+	State    string        `json:"state"`
+	Priority uint32        `json:"priority"`
+	Age      time.Duration `json:"age"`
+	Delay    time.Duration `json:"delay"`
+	Ttr      time.Duration `json:"ttr"`
+	TimeLeft time.Duration `json:"time_left"`
+	Reserves int           `json:"reserves"`
+	Timeouts int           `json:"timeouts"`
+	Releases int           `json:"releases"`
+	Buries   int           `json:"buries"`
+	Kicks    int           `json:"kicks"`
+}
+
+//TubeStats describes tube as reported by stats-tube command
+type TubeStats struct {
+	Name          string        `json:"name"`
+	Urgent        int           `json:"urgent"`
+	Ready         int           `json:"ready"`
+	Reserved      int           `json:"reserved"`
+	Delayed       int           `json:"delayed"`
+	Buried        int           `json:"buried"`
+	TotalJobs     int           `json:"total_jobs"`
+	Using         int           `json:"using"`
+	Watching      int           `json:"watching"`
+	Waiting       int           `json:"waiting"`
+	Deletes       int           `json:"deletes"`
+	Pauses        int           `json:"pauses"`
+	Pause         time.Duration `json:"pause"`
+	PauseTimeLeft time.Duration `json:"pause_time_left"`
+}
+
+//ServerStats describes server as reported by stats command
+type ServerStats struct {
+	Urgent      int           `json:"urgent"`
+	Ready       int           `json:"ready"`
+	Reserved    int           `json:"reserved"`
+	Delayed     int           `json:"delayed"`
+	Buried      int           `json:"buried"`
+	TotalJobs   int           `json:"total_jobs"`
+	Timeouts    int           `json:"timeouts"`
+	Tubes       int           `json:"tubes"`
+	Connections int           `json:"connections"`
+	Producers   int           `json:"producers"`
+	Workers     int           `json:"workers"`
+	Waiting     int           `json:"waiting"`
+	Pid         int           `json:"pid"`
+	Version     string        `json:"version"`
+	Uptime      time.Duration `json:"uptime"`
+	Hostname    string        `json:"hostname"`
+}
+
+//statsParser reads typed fields of stats, keeping first invalid field error.
+//Missing fields are read as zero
+type statsParser struct {
+	stats map[string]string
+	err   error
+
+	invalid func(field string, err error) error
+}
+
+func (p *statsParser) uint(field string, bitSize int) uint64 {
+	s, ok := p.stats[field]
+
+	if !ok {
+		return 0
+	}
+
+	v, err := strconv.ParseUint(s, 10, bitSize)
+
+	if err != nil && p.err == nil {
+		p.err = p.invalid(field, err)
+	}
+
+	return v
+}
+
+func (p *statsParser) int(field string) int {
+	return int(p.uint(field, 32))
+}
+
+func (p *statsParser) seconds(field string) time.Duration {
+	return time.Duration(p.uint(field, 64)) * time.Second
+}
+
+//ParseJobStats converts stats-job response to JobStats
+func ParseJobStats(stats map[string]string) (*JobStats, error) {
+	id, _ := strconv.ParseUint(stats[JobStatsId], 10, 64)
+
+	p := &statsParser{stats: stats, invalid: func(field string, err error) error {
+		return log.InvalidJobStatsError(id, field, err)
+	}}
+
+	s := &JobStats{
+		Id:       p.uint(JobStatsId, 64),
+		Tube:     stats[JobStatsTube],
+		State:    stats[JobStatsState],
+		Priority: uint32(p.uint(JobStatsPriority, 32)),
+		Age:      p.seconds(JobStatsAge),
+		Delay:    p.seconds(JobStatsDelay),
+		Ttr:      p.seconds(JobStatsTtr),
+		TimeLeft: p.seconds(JobStatsTimeLeft),
+		Reserves: p.int(JobStatsReserves),
+		Timeouts: p.int(JobStatsTimeouts),
+		Releases: p.int(JobStatsReleases),
+		Buries:   p.int(JobStatsBuries),
+		Kicks:    p.int(JobStatsKicks),
+	}
+
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return s, nil
+}
+
+//ParseTubeStats converts stats-tube response to TubeStats
+func ParseTubeStats(stats map[string]string) (*TubeStats, error) {
+	p := &statsParser{stats: stats, invalid: log.InvalidStatsError}
+
+	s := &TubeStats{
+		Name:          stats[TubeStatsName],
+		Urgent:        p.int(TubeStatsUrgent),
+		Ready:         p.int(TubeStatsReady),
+		Reserved:      p.int(TubeStatsReserved),
+		Delayed:       p.int(TubeStatsDelayed),
+		Buried:        p.int(TubeStatsBuried),
+		TotalJobs:     p.int(TubeStatsTotalJobs),
+		Using:         p.int(TubeStatsUsing),
+		Watching:      p.int(TubeStatsWatching),
+		Waiting:       p.int(TubeStatsWaiting),
+		Deletes:       p.int(TubeStatsDeletes),
+		Pauses:        p.int(TubeStatsPauses),
+		Pause:         p.seconds(TubeStatsPause),
+		PauseTimeLeft: p.seconds(TubeStatsPauseTimeLeft),
+	}
+
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return s, nil
+}
+
+//ParseServerStats converts stats response to ServerStats
+func ParseServerStats(stats map[string]string) (*ServerStats, error) {
+	p := &statsParser{stats: stats, invalid: log.InvalidStatsError}
+
+	s := &ServerStats{
+		Urgent:      p.int(StatsUrgent),
+		Ready:       p.int(StatsReady),
+		Reserved:    p.int(StatsReserved),
+		Delayed:     p.int(StatsDelayed),
+		Buried:      p.int(StatsBuried),
+		TotalJobs:   p.int(StatsTotalJobs),
+		Timeouts:    p.int(StatsTimeouts),
+		Tubes:       p.int(StatsTubes),
+		Connections: p.int(StatsConnections),
+		Producers:   p.int(StatsProducers),
+		Workers:     p.int(StatsWorkers),
+		Waiting:     p.int(StatsWaiting),
+		Pid:         p.int(StatsPid),
+		Version:     stats[StatsVersion],
+		Uptime:      p.seconds(StatsUptime),
+		Hostname:    stats[StatsHostname],
+	}
+
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return s, nil
+}
+
+//seconds marshals duration to JSON in whole seconds like beanstalkd reports it
+type seconds time.Duration
+
+func (s seconds) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatInt(int64(time.Duration(s)/time.Second), 10)), nil
+}
+
+//MarshalJSON writes durations in seconds
+func (s JobStats) MarshalJSON() ([]byte, error) {
+	type jobStats JobStats
+
+	return json.Marshal(struct {
+		jobStats
+		Age      seconds `json:"age"`
+		Delay    seconds `json:"delay"`
+		Ttr      seconds `json:"ttr"`
+		TimeLeft seconds `json:"time_left"`
+	}{jobStats(s), seconds(s.Age), seconds(s.Delay), seconds(s.Ttr), seconds(s.TimeLeft)})
+}
+
+//MarshalJSON writes durations in seconds
+func (s TubeStats) MarshalJSON() ([]byte, error) {
+	type tubeStats TubeStats
+
+	return json.Marshal(struct {
+		tubeStats
+		Pause         seconds `json:"pause"`
+		PauseTimeLeft seconds `json:"pause_time_left"`
+	}{tubeStats(s), seconds(s.Pause), seconds(s.PauseTimeLeft)})
+}
+
+//MarshalJSON writes durations in seconds
+func (s ServerStats) MarshalJSON() ([]byte, error) {
+	type serverStats ServerStats
+
+	return json.Marshal(struct {
+		serverStats
+		Uptime seconds `json:"uptime"`
+	}{serverStats(s), seconds(s.Uptime)})
+}
@@ -0,0 +1,62 @@
+package consumer_test
+
+import (
+	"encoding/json"
+	"github.com/mnikita/task-queue/pkg/consumer"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseJobStats(t *testing.T) {
+	stats, err := consumer.ParseJobStats(map[string]string{"id": "13", "tube": "mika", "state": "ready",
+		"pri": "10", "ttr": "60", "reserves": "2"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, &consumer.JobStats{Id: 13, Tube: "mika", State: "ready", Priority: 10,
+		Ttr: time.Minute, Reserves: 2}, stats)
+
+	_, err = consumer.ParseJobStats(map[string]string{"id": "13", "reserves": "many"})
+
+	assert.NotNil(t, err)
+}
+
+func TestParseTubeStats(t *testing.T) {
+	stats, err := consumer.ParseTubeStats(map[string]string{"name": "mika", "current-jobs-ready": "3",
+		"current-jobs-buried": "1", "pause": "10", "pause-time-left": "5"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, &consumer.TubeStats{Name: "mika", Ready: 3, Buried: 1, Pause: time.Second * 10,
+		PauseTimeLeft: time.Second * 5}, stats)
+
+	_, err = consumer.ParseTubeStats(map[string]string{"pause": "-"})
+
+	assert.EqualError(t, err, `Invalid stats field pause: strconv.ParseUint: parsing "-": invalid syntax`)
+}
+
+func TestParseServerStats(t *testing.T) {
+	stats, err := consumer.ParseServerStats(map[string]string{"current-tubes": "2", "version": "1.12",
+		"uptime": "3600"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, &consumer.ServerStats{Tubes: 2, Version: "1.12", Uptime: time.Hour}, stats)
+}
+
+func TestStatsJson(t *testing.T) {
+	data, err := json.Marshal(&consumer.JobStats{Id: 13, Ttr: time.Minute, TimeLeft: time.Second * 5})
+
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"ttr":60`)
+	assert.Contains(t, string(data), `"time_left":5`)
+	assert.Contains(t, string(data), `"id":13`)
+
+	data, err = json.Marshal(&consumer.TubeStats{Pause: time.Second * 10})
+
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"pause":10`)
+
+	data, err = json.Marshal(&consumer.ServerStats{Uptime: time.Hour})
+
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"uptime":3600`)
+}
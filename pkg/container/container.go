@@ -8,16 +8,23 @@ import (
 	"github.com/mnikita/task-queue/pkg/connection"
 	"github.com/mnikita/task-queue/pkg/connector"
 	"github.com/mnikita/task-queue/pkg/consumer"
+	"github.com/mnikita/task-queue/pkg/health"
 	"github.com/mnikita/task-queue/pkg/log"
+	"github.com/mnikita/task-queue/pkg/metrics"
+	"github.com/mnikita/task-queue/pkg/result"
+	"github.com/mnikita/task-queue/pkg/server"
 	"github.com/mnikita/task-queue/pkg/util"
 	"github.com/mnikita/task-queue/pkg/worker"
 	"io/ioutil"
 	"os"
+	"reflect"
+	"strings"
+	"sync"
 )
 
 var WireSet = wire.NewSet(NewContainer, NewConfiguration,
 	wire.Bind(new(Handler), new(*Container)), worker.WireSet, consumer.WireSet,
-	connector.WireSet, connection.WireSet)
+	connector.WireSet, connection.WireSet, result.WireSet, server.WireSet, health.WireSet)
 
 type Handler interface {
 	Init(configFile string) error
@@ -29,6 +36,23 @@ type Handler interface {
 	Consumer() consumer.Handler
 	Connector() connector.Handler
 
+	//ResultStore returns configured result store, nil if results are not stored
+	ResultStore() result.Store
+
+	//Metrics returns metrics recorded by container objects
+	Metrics() *metrics.Metrics
+
+	//Monitor returns health monitor of container objects
+	Monitor() *health.Monitor
+
+	//StartServer starts HTTP server exposing metrics and health endpoints, and admin server
+	//exposing watched tubes endpoint. Servers are not started if their address is not configured
+	StartServer() error
+
+	//OnConfigModified reloads configuration file and applies changes to running objects.
+	//Invalid configuration is rejected and previous configuration is kept
+	OnConfigModified()
+
 	Config() *Configuration
 }
 
@@ -37,6 +61,9 @@ type Configuration struct {
 	WorkerConfig     *worker.Configuration
 	ConsumerConfig   *consumer.Configuration
 	ConnectorConfig  *connector.Configuration
+	ResultConfig     *result.Configuration
+	ServerConfig     *server.Configuration
+	HealthConfig     *health.Configuration
 
 	ConfigFile string `json:"-"`
 
@@ -50,41 +77,133 @@ type Container struct {
 	worker     worker.Handler
 	consumer   consumer.Handler
 	connector  connector.Handler
+
+	resultStore result.Store
+
+	metrics     *metrics.Metrics
+	monitor     *health.Monitor
+	server      *server.Server
+	adminServer *server.Server
+
+	reloadMux sync.Mutex
 }
 
-func (c *Configuration) load() error {
+func (c *Configuration) load(eventHandler util.ConfigWatcherEventHandler) error {
 	if c.ConfigFile == "" {
 		//nothing to load
 		return nil
 	}
 
-	jsonFile, err := os.Open(c.ConfigFile)
+	err := c.read(c)
+
 	if err != nil {
 		return err
 	}
 
-	configData, err := ioutil.ReadAll(jsonFile)
+	log.Logger().ContainerConfigLoaded(c.ConfigFile)
 
+	err = c.initConfigWatcher(eventHandler)
 	if err != nil {
 		return err
 	}
 
-	err = json.Unmarshal(configData, c)
+	return nil
+}
 
+//read unmarshals configuration file over given configuration
+func (c *Configuration) read(config *Configuration) error {
+	jsonFile, err := os.Open(c.ConfigFile)
 	if err != nil {
 		return err
 	}
 
-	log.Logger().ContainerConfigLoaded(c.ConfigFile)
+	defer jsonFile.Close()
+
+	configData, err := ioutil.ReadAll(jsonFile)
 
-	err = c.initConfigWatcher()
 	if err != nil {
 		return err
 	}
 
+	return json.Unmarshal(configData, config)
+}
+
+//reload returns configuration file read over copy of current configuration.
+//Connection configuration is given as copy, as watched tubes change while connection runs
+func (c *Configuration) reload(connectionConfig *connection.Configuration) (*Configuration, error) {
+	copied := *c
+	copied.ConnectionConfig = connectionConfig
+
+	current, err := json.Marshal(&copied)
+
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Configuration{ConfigFile: c.ConfigFile}
+
+	if err = json.Unmarshal(current, config); err != nil {
+		return nil, err
+	}
+
+	if err = c.read(config); err != nil {
+		return nil, err
+	}
+
+	config.fetchJobStats()
+
+	if err = config.validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+//validate checks values which can be applied without restart
+func (c *Configuration) validate() error {
+	if c.WorkerConfig != nil && c.WorkerConfig.Concurrency < 1 {
+		return log.InvalidConfigurationError("WorkerConfig.Concurrency", "must be positive")
+	}
+
+	if c.ConsumerConfig != nil {
+		if c.ConsumerConfig.WaitForConsumerReserve <= 0 {
+			return log.InvalidConfigurationError("ConsumerConfig.WaitForConsumerReserve", "must be positive")
+		}
+
+		if c.ConsumerConfig.Heartbeat <= 0 {
+			return log.InvalidConfigurationError("ConsumerConfig.Heartbeat", "must be positive")
+		}
+	}
+
+	if c.ConnectorConfig != nil {
+		if c.ConnectorConfig.WaitToAcceptConsumerTask <= 0 {
+			return log.InvalidConfigurationError("ConnectorConfig.WaitToAcceptConsumerTask", "must be positive")
+		}
+
+		if c.ConnectorConfig.WaitToAcceptEvent <= 0 {
+			return log.InvalidConfigurationError("ConnectorConfig.WaitToAcceptEvent", "must be positive")
+		}
+	}
+
+	if c.ConnectionConfig != nil {
+		for _, tube := range c.ConnectionConfig.Tubes {
+			if strings.TrimSpace(tube) == "" {
+				return log.InvalidConfigurationError("ConnectionConfig.Tubes", "empty tube name")
+			}
+		}
+	}
+
 	return nil
 }
 
+//fetchJobStats enables reading job stats by consumer if worker needs job time to run,
+//which is not part of reserved job
+func (c *Configuration) fetchJobStats() {
+	if c.WorkerConfig != nil && c.ConsumerConfig != nil && c.WorkerConfig.UsesJobTtr() {
+		c.ConsumerConfig.FetchJobStats = true
+	}
+}
+
 func (c *Configuration) close() error {
 	if c.ConfigFile == "" {
 		//nothing to close
@@ -94,8 +213,8 @@ func (c *Configuration) close() error {
 	return c.closeConfigWatcher()
 }
 
-func (c *Configuration) initConfigWatcher() (err error) {
-	c.configWatcher, err = util.NewConfigWatcher(c)
+func (c *Configuration) initConfigWatcher(eventHandler util.ConfigWatcherEventHandler) (err error) {
+	c.configWatcher, err = util.NewConfigWatcher(eventHandler)
 
 	if err != nil {
 		return err
@@ -115,13 +234,18 @@ func (c *Configuration) closeConfigWatcher() (err error) {
 }
 
 func NewConfiguration(workerConfig *worker.Configuration, consumerConfig *consumer.Configuration,
-	connectorConfig *connector.Configuration, connectionConfig *connection.Configuration) *Configuration {
+	connectorConfig *connector.Configuration, connectionConfig *connection.Configuration,
+	resultConfig *result.Configuration, serverConfig *server.Configuration,
+	healthConfig *health.Configuration) *Configuration {
 
 	config := &Configuration{}
 	config.WorkerConfig = workerConfig
 	config.ConsumerConfig = consumerConfig
 	config.ConnectorConfig = connectorConfig
 	config.ConnectionConfig = connectionConfig
+	config.ResultConfig = resultConfig
+	config.ServerConfig = serverConfig
+	config.HealthConfig = healthConfig
 
 	return config
 }
@@ -139,6 +263,8 @@ func NewContainer(config *Configuration, connectionHandler connection.Handler,
 	c.worker = workerHandler
 	c.consumer = consumerHandler
 
+	c.metrics = metrics.NewMetrics()
+
 	return c
 }
 
@@ -146,10 +272,23 @@ func (c *Container) Init(configFile string) (err error) {
 	//Init Configuration
 	c.ConfigFile = configFile
 
-	if err = c.load(); err != nil {
+	if err = c.load(c); err != nil {
 		return err
 	}
 
+	c.fetchJobStats()
+
+	healthConfig := c.HealthConfig
+
+	if healthConfig == nil {
+		healthConfig = health.NewConfiguration()
+	}
+
+	c.monitor = health.NewMonitor(healthConfig)
+
+	//set before connection is established to report its first connect
+	c.Connection().SetEventHandler(c.monitor)
+
 	//Init Objects
 	if err = c.Connection().Init(); err != nil {
 		return err
@@ -164,11 +303,42 @@ func (c *Container) Init(configFile string) (err error) {
 		return err
 	}
 
+	if c.ResultConfig != nil {
+		if c.resultStore, err = result.NewStore(c.ResultConfig); err != nil {
+			return err
+		}
+
+		if c.resultStore != nil {
+			c.Consumer().SetResultStore(c.resultStore)
+		}
+	}
+
+	c.Consumer().SetMetrics(c.metrics)
+	c.Connector().SetMetrics(c.metrics)
+	c.Worker().SetMetrics(c.metrics)
+	c.Worker().Use(c.metrics.Middleware())
+	c.metrics.SetTaskQueue(c.Worker().TaskQueue())
+
+	c.Consumer().SetMonitor(c.monitor)
+	c.Worker().SetMonitor(c.monitor)
+
 	return nil
 }
 
 func (c *Container) Close() (err error) {
 	//Close Objects
+	if c.server != nil {
+		err = c.server.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if c.adminServer != nil {
+		err = c.adminServer.Close()
+		if err != nil {
+			return err
+		}
+	}
 	err = c.Connector().Close()
 	if err != nil {
 		return err
@@ -185,6 +355,12 @@ func (c *Container) Close() (err error) {
 	if err != nil {
 		return err
 	}
+	if c.resultStore != nil {
+		err = c.resultStore.Close()
+		if err != nil {
+			return err
+		}
+	}
 
 	//Close Configuration
 	return c.close()
@@ -210,10 +386,101 @@ func (c *Container) Connector() connector.Handler {
 	return c.connector
 }
 
+func (c *Container) ResultStore() result.Store {
+	return c.resultStore
+}
+
+func (c *Container) Metrics() *metrics.Metrics {
+	return c.metrics
+}
+
+func (c *Container) Monitor() *health.Monitor {
+	return c.monitor
+}
+
+func (c *Container) StartServer() error {
+	if c.ServerConfig == nil {
+		return nil
+	}
+
+	if c.ServerConfig.Addr != "" {
+		c.server = server.NewServer(c.ServerConfig)
+		c.server.Handle(metrics.Path, c.metrics.Handler())
+		c.server.Handle(health.PathHealth, c.monitor.HealthHandler())
+		c.server.Handle(health.PathReady, c.monitor.ReadyHandler())
+
+		if err := c.server.Start(); err != nil {
+			return err
+		}
+	}
+
+	if c.ServerConfig.AdminAddr != "" {
+		adminConfig := *c.ServerConfig
+		adminConfig.Addr = c.ServerConfig.AdminAddr
+
+		c.adminServer = server.NewServer(&adminConfig)
+		c.adminServer.Handle(connection.PathTubes, connection.NewTubesHandler(c.connection))
+
+		return c.adminServer.Start()
+	}
+
+	return nil
+}
+
 func (c *Container) Config() *Configuration {
 	return c.Configuration
 }
 
-func (c *Configuration) OnConfigModified() {
-	//TODO: Implement configuration modification logic
+func (c *Container) OnConfigModified() {
+	c.reloadMux.Lock()
+	defer c.reloadMux.Unlock()
+
+	var connectionConfig *connection.Configuration
+
+	if c.ConnectionConfig != nil {
+		connectionConfig = c.Connection().ConfigCopy()
+	}
+
+	config, err := c.reload(connectionConfig)
+
+	if err == nil {
+		err = c.apply(config, connectionConfig)
+	}
+
+	if err != nil {
+		log.Logger().ContainerConfigRejected(err)
+
+		return
+	}
+
+	log.Logger().ContainerConfigReloaded(c.ConfigFile)
+}
+
+//apply changes running objects to match configuration. Tubes are changed first
+//so rejected tubes reject whole configuration.
+//Remaining values are applied on restart
+func (c *Container) apply(config *Configuration, connectionConfig *connection.Configuration) error {
+	if connectionConfig != nil && config.ConnectionConfig != nil &&
+		!reflect.DeepEqual(connectionConfig.Tubes, config.ConnectionConfig.Tubes) {
+		if err := c.Connection().SetTubes(config.ConnectionConfig.Tubes); err != nil {
+			return err
+		}
+	}
+
+	if c.WorkerConfig != nil && config.WorkerConfig != nil &&
+		c.WorkerConfig.Concurrency != config.WorkerConfig.Concurrency {
+		c.Worker().SetConcurrency(config.WorkerConfig.Concurrency)
+	}
+
+	if c.ConsumerConfig != nil && config.ConsumerConfig != nil &&
+		!reflect.DeepEqual(c.ConsumerConfig, config.ConsumerConfig) {
+		c.Consumer().Reload(config.ConsumerConfig)
+	}
+
+	if c.ConnectorConfig != nil && config.ConnectorConfig != nil &&
+		!reflect.DeepEqual(c.ConnectorConfig, config.ConnectorConfig) {
+		c.Connector().Reload(config.ConnectorConfig)
+	}
+
+	return nil
 }
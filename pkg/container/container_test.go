@@ -1,13 +1,26 @@
 package container_test
 
 import (
+	"encoding/json"
+	"errors"
 	"github.com/golang/mock/gomock"
+	"github.com/mnikita/task-queue/pkg/connection"
 	bmocks "github.com/mnikita/task-queue/pkg/connection/mocks"
+	"github.com/mnikita/task-queue/pkg/connector"
 	connmocks "github.com/mnikita/task-queue/pkg/connector/mocks"
+	"github.com/mnikita/task-queue/pkg/consumer"
 	lmocks "github.com/mnikita/task-queue/pkg/consumer/mocks"
 	"github.com/mnikita/task-queue/pkg/container"
+	"github.com/mnikita/task-queue/pkg/health"
+	"github.com/mnikita/task-queue/pkg/result"
+	"github.com/mnikita/task-queue/pkg/server"
 	"github.com/mnikita/task-queue/pkg/util"
+	"github.com/mnikita/task-queue/pkg/worker"
 	wmocks "github.com/mnikita/task-queue/pkg/worker/mocks"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -23,6 +36,9 @@ type Mock struct {
 	workerH     *wmocks.MockHandler
 	connectorH  *connmocks.MockHandler
 
+	//event handler container sets to connection
+	connectionEh connection.EventHandler
+
 	container container.Handler
 }
 
@@ -44,21 +60,36 @@ func newMock(t *testing.T) *Mock {
 }
 
 func setupTest(m *Mock) func() {
+	return setupTestWithFile(m, "")
+}
+
+func setupTestWithFile(m *Mock, configFile string) func() {
 	if m == nil {
 		panic("Mock not initialized")
 	}
 
+	m.connectionH.EXPECT().SetEventHandler(gomock.Any()).Do(func(eh connection.EventHandler) {
+		m.connectionEh = eh
+	})
 	m.connectorH.EXPECT().Init()
 	m.workerH.EXPECT().Init()
 	m.consumerH.EXPECT().Init()
 	m.connectionH.EXPECT().Init()
 
+	m.consumerH.EXPECT().SetMetrics(gomock.Any())
+	m.connectorH.EXPECT().SetMetrics(gomock.Any())
+	m.workerH.EXPECT().SetMetrics(gomock.Any())
+	m.workerH.EXPECT().Use(gomock.Any())
+	m.workerH.EXPECT().TaskQueue()
+	m.consumerH.EXPECT().SetMonitor(gomock.Any())
+	m.workerH.EXPECT().SetMonitor(gomock.Any())
+
 	m.connectorH.EXPECT().Close()
 	m.workerH.EXPECT().Close()
 	m.consumerH.EXPECT().Close()
 	m.connectionH.EXPECT().Close()
 
-	if err := m.container.Init(""); err != nil {
+	if err := m.container.Init(configFile); err != nil {
 		panic(err)
 	}
 
@@ -81,3 +112,178 @@ func setupTest(m *Mock) func() {
 func TestStartContainer(t *testing.T) {
 	setupTest(newMock(t))
 }
+
+func TestConnectionHealth(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	monitor := m.container.Monitor()
+
+	assert.Equal(t, health.CheckOk, monitor.Ready().Checks[health.CheckConnection])
+
+	//lost connection is reported until it is re-established
+	m.connectionEh.OnDisconnect(errors.New("connection reset by peer"))
+
+	assert.Equal(t, "connection reset by peer", monitor.Ready().Checks[health.CheckConnection])
+
+	m.connectionEh.OnConnect()
+
+	assert.Equal(t, health.CheckOk, monitor.Ready().Checks[health.CheckConnection])
+	assert.Nil(t, m.container.Close())
+}
+
+func TestResultStore(t *testing.T) {
+	m := newMock(t)
+
+	config := &container.Configuration{ResultConfig: result.NewConfiguration()}
+	config.ResultConfig.Backend = result.BackendMemory
+
+	m.container = container.NewContainer(config, m.connectionH, m.connectorH, m.workerH, m.consumerH)
+
+	m.consumerH.EXPECT().SetResultStore(gomock.Any())
+
+	defer setupTest(m)()
+
+	assert.NotNil(t, m.container.ResultStore())
+	assert.Nil(t, m.container.Close())
+}
+
+func TestStartServer(t *testing.T) {
+	m := newMock(t)
+
+	config := &container.Configuration{ServerConfig: server.NewConfiguration()}
+	config.ServerConfig.Addr = "127.0.0.1:0"
+	config.ServerConfig.AdminAddr = "127.0.0.1:0"
+
+	m.container = container.NewContainer(config, m.connectionH, m.connectorH, m.workerH, m.consumerH)
+
+	defer setupTest(m)()
+
+	assert.NotNil(t, m.container.Metrics())
+	assert.NotNil(t, m.container.Monitor())
+	assert.Nil(t, m.container.StartServer())
+	assert.Nil(t, m.container.Close())
+}
+
+func newReloadConfiguration() *container.Configuration {
+	config := &container.Configuration{
+		ConnectionConfig: connection.NewConfiguration(),
+		WorkerConfig:     worker.NewConfiguration(),
+		ConsumerConfig:   consumer.NewConfiguration(),
+		ConnectorConfig:  connector.NewConfiguration(),
+	}
+
+	config.ConnectionConfig.Tubes = []string{"mika"}
+	config.WorkerConfig.Concurrency = 2
+
+	//enabled by container for default worker keep alive
+	config.ConsumerConfig.FetchJobStats = true
+
+	return config
+}
+
+func writeConfigFile(t *testing.T, path string, config interface{}) {
+	data, err := json.Marshal(config)
+	assert.Nil(t, err)
+
+	assert.Nil(t, ioutil.WriteFile(path, data, 0644))
+}
+
+//expectConfigCopy returns copy of connection configuration on every reload
+func (m *Mock) expectConfigCopy(config *connection.Configuration) {
+	m.connectionH.EXPECT().ConfigCopy().DoAndReturn(func() *connection.Configuration {
+		copied := *config
+
+		return &copied
+	}).AnyTimes()
+}
+
+func assertConfiguration(t *testing.T, expected *container.Configuration, actual *container.Configuration) {
+	assert.Equal(t, expected.ConnectionConfig, actual.ConnectionConfig)
+	assert.Equal(t, expected.WorkerConfig, actual.WorkerConfig)
+	assert.Equal(t, expected.ConsumerConfig, actual.ConsumerConfig)
+	assert.Equal(t, expected.ConnectorConfig, actual.ConnectorConfig)
+}
+
+func TestConfigReload(t *testing.T) {
+	m := newMock(t)
+
+	dir, err := ioutil.TempDir("", "container")
+	assert.Nil(t, err)
+
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "config.json")
+
+	config := newReloadConfiguration()
+	writeConfigFile(t, configFile, config)
+
+	m.container = container.NewContainer(config, m.connectionH, m.connectorH, m.workerH, m.consumerH)
+
+	defer setupTestWithFile(m, configFile)()
+
+	modified := newReloadConfiguration()
+	modified.ConnectionConfig.Tubes = []string{"mika", "pera"}
+	modified.WorkerConfig.Concurrency = 4
+	modified.ConsumerConfig.Heartbeat = time.Second
+	modified.ConnectorConfig.WaitToAcceptEvent = time.Second
+
+	m.expectConfigCopy(config.ConnectionConfig)
+	m.connectionH.EXPECT().SetTubes(modified.ConnectionConfig.Tubes).Do(func(tubes []string) {
+		config.ConnectionConfig.Tubes = tubes
+	})
+	m.workerH.EXPECT().SetConcurrency(4).Do(func(concurrency int) {
+		config.WorkerConfig.Concurrency = concurrency
+	})
+	m.consumerH.EXPECT().Reload(modified.ConsumerConfig).Do(func(c *consumer.Configuration) {
+		*config.ConsumerConfig = *c
+	})
+	m.connectorH.EXPECT().Reload(modified.ConnectorConfig).Do(func(c *connector.Configuration) {
+		*config.ConnectorConfig = *c
+	})
+
+	writeConfigFile(t, configFile, modified)
+
+	//applied changes are not applied again by watcher
+	m.container.OnConfigModified()
+	m.container.OnConfigModified()
+
+	assertConfiguration(t, modified, m.container.Config())
+	assert.Nil(t, m.container.Close())
+}
+
+func TestConfigReloadRejected(t *testing.T) {
+	m := newMock(t)
+
+	dir, err := ioutil.TempDir("", "container")
+	assert.Nil(t, err)
+
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "config.json")
+
+	config := newReloadConfiguration()
+	writeConfigFile(t, configFile, config)
+
+	m.container = container.NewContainer(config, m.connectionH, m.connectorH, m.workerH, m.consumerH)
+
+	defer setupTestWithFile(m, configFile)()
+
+	invalid := newReloadConfiguration()
+	invalid.WorkerConfig.Concurrency = 0
+	invalid.ConnectionConfig.Tubes = []string{"mika", "pera"}
+
+	m.expectConfigCopy(config.ConnectionConfig)
+
+	writeConfigFile(t, configFile, invalid)
+
+	m.container.OnConfigModified()
+
+	assert.Nil(t, ioutil.WriteFile(configFile, []byte("{"), 0644))
+
+	m.container.OnConfigModified()
+
+	//previous configuration is kept
+	assertConfiguration(t, newReloadConfiguration(), m.container.Config())
+	assert.Nil(t, m.container.Close())
+}
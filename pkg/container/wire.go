@@ -7,6 +7,7 @@ package container
 import (
 	"github.com/google/wire"
 	"github.com/mnikita/task-queue/pkg/beanstalkd"
+	"github.com/mnikita/task-queue/pkg/memory"
 )
 
 func InitializeContainer() *Container {
@@ -14,3 +15,10 @@ func InitializeContainer() *Container {
 
 	return &Container{}
 }
+
+//InitializeMemoryContainer creates container connected to in-process broker
+func InitializeMemoryContainer(broker *memory.Broker) *Container {
+	wire.Build(WireSet, memory.WireSet)
+
+	return &Container{}
+}
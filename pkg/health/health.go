@@ -0,0 +1,365 @@
+//Package health provides liveness and readiness checks of the worker process
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/wire"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var WireSet = wire.NewSet(NewConfiguration)
+
+//Paths of health HTTP endpoints
+const (
+	PathHealth = "/healthz"
+	PathReady  = "/readyz"
+)
+
+//Check names
+const (
+	CheckConsumer   = "consumer"
+	CheckThreads    = "threads"
+	CheckConnection = "connection"
+	CheckReserve    = "reserve"
+)
+
+//CheckOk is the result of passed check
+const CheckOk = "ok"
+
+//Configuration stores thresholds after which worker components are considered stuck
+type Configuration struct {
+	//Consumer loop is not alive if it shows no activity for this long
+	MaxConsumerIdle time.Duration
+
+	//Idle task thread is not alive if it does not heartbeat for this long. Busy threads are always alive
+	MaxThreadIdle time.Duration
+
+	//Worker is not ready if no reserve completed for this long
+	MaxReserveAge time.Duration
+}
+
+//Status is reported by health endpoints
+type Status struct {
+	Ok bool `json:"ok"`
+
+	//Check results by check name. Failed checks hold failure reason
+	Checks map[string]string `json:"checks"`
+}
+
+//Monitor tracks activity of consumer loop, connection and task threads.
+//Methods of nil Monitor do nothing, so components report activity without checking whether health is monitored
+type Monitor struct {
+	*Configuration
+
+	mux sync.Mutex
+
+	consumerRunning  bool
+	consumerDraining bool
+	consumerActive   time.Time
+
+	lastReserve     time.Time
+	connectionError error
+
+	workerRunning   bool
+	expectedThreads int
+	threads         map[int]*thread
+}
+
+type thread struct {
+	active time.Time
+	busy   bool
+}
+
+func NewConfiguration() *Configuration {
+	return &Configuration{
+		MaxConsumerIdle: time.Second * 30,
+		MaxThreadIdle:   time.Second * 30,
+		MaxReserveAge:   time.Second * 30,
+	}
+}
+
+func NewMonitor(config *Configuration) *Monitor {
+	return &Monitor{Configuration: config, threads: make(map[int]*thread)}
+}
+
+func (m *Monitor) ConsumerStarted() {
+	if m == nil {
+		return
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.consumerRunning = true
+	m.consumerDraining = false
+	m.consumerActive = time.Now()
+}
+
+func (m *Monitor) ConsumerStopped() {
+	if m == nil {
+		return
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.consumerRunning = false
+}
+
+//ConsumerDraining marks worker not ready since no new jobs are reserved
+func (m *Monitor) ConsumerDraining() {
+	if m == nil {
+		return
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.consumerDraining = true
+}
+
+//ConsumerActive records consumer loop iteration, e.g. heartbeat or handled task event
+func (m *Monitor) ConsumerActive() {
+	if m == nil {
+		return
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.consumerActive = time.Now()
+}
+
+//ReserveCompleted records reserve answered by the server, including reserve timeout
+func (m *Monitor) ReserveCompleted() {
+	if m == nil {
+		return
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.consumerActive = time.Now()
+	m.lastReserve = m.consumerActive
+	m.connectionError = nil
+}
+
+//OnConnect records established connection
+func (m *Monitor) OnConnect() {
+	if m == nil {
+		return
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.connectionError = nil
+}
+
+//OnDisconnect records lost connection. Connection is reported unhealthy until it is re-established
+func (m *Monitor) OnDisconnect(err error) {
+	if m == nil {
+		return
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.connectionError = err
+}
+
+//ReserveFailed records connection error of reserve
+func (m *Monitor) ReserveFailed(err error) {
+	if m == nil {
+		return
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.consumerActive = time.Now()
+	m.connectionError = err
+}
+
+func (m *Monitor) WorkerStarted(concurrency int) {
+	if m == nil {
+		return
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.workerRunning = true
+	m.expectedThreads = concurrency
+}
+
+//WorkerScaled changes number of task threads expected to be alive
+func (m *Monitor) WorkerScaled(concurrency int) {
+	if m == nil {
+		return
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.expectedThreads = concurrency
+}
+
+func (m *Monitor) WorkerStopped() {
+	if m == nil {
+		return
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.workerRunning = false
+}
+
+func (m *Monitor) ThreadStarted(threadId int) {
+	m.ThreadActive(threadId, false)
+}
+
+func (m *Monitor) ThreadEnded(threadId int) {
+	if m == nil {
+		return
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	delete(m.threads, threadId)
+}
+
+//ThreadActive records task thread activity. Busy thread is executing a task
+func (m *Monitor) ThreadActive(threadId int, busy bool) {
+	if m == nil {
+		return
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.threads[threadId] = &thread{active: time.Now(), busy: busy}
+}
+
+//Health reports whether consumer loop and task threads are alive
+func (m *Monitor) Health() *Status {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	status := &Status{Ok: true, Checks: make(map[string]string)}
+
+	m.check(status, CheckConsumer, m.checkConsumer())
+	m.check(status, CheckThreads, m.checkThreads())
+
+	return status
+}
+
+//Ready reports whether worker is alive, connected and reserving jobs
+func (m *Monitor) Ready() *Status {
+	status := m.Health()
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.check(status, CheckConnection, m.checkConnection())
+	m.check(status, CheckReserve, m.checkReserve())
+
+	return status
+}
+
+func (m *Monitor) check(status *Status, name string, reason string) {
+	if reason == "" {
+		status.Checks[name] = CheckOk
+	} else {
+		status.Checks[name] = reason
+		status.Ok = false
+	}
+}
+
+func (m *Monitor) checkConsumer() string {
+	if !m.consumerRunning {
+		return "consumer not running"
+	}
+
+	if idle := time.Since(m.consumerActive); idle > m.MaxConsumerIdle {
+		return fmt.Sprintf("consumer inactive for %s", idle.Round(time.Second))
+	}
+
+	return ""
+}
+
+func (m *Monitor) checkThreads() string {
+	if !m.workerRunning {
+		return "worker not running"
+	}
+
+	alive := 0
+
+	for _, t := range m.threads {
+		if t.busy || time.Since(t.active) <= m.MaxThreadIdle {
+			alive++
+		}
+	}
+
+	if alive < m.expectedThreads {
+		return fmt.Sprintf("%d of %d task threads alive", alive, m.expectedThreads)
+	}
+
+	return ""
+}
+
+func (m *Monitor) checkConnection() string {
+	if m.connectionError != nil {
+		return m.connectionError.Error()
+	}
+
+	return ""
+}
+
+func (m *Monitor) checkReserve() string {
+	if m.consumerDraining {
+		return "consumer draining"
+	}
+
+	if m.lastReserve.IsZero() {
+		return "no reserve completed"
+	}
+
+	if age := time.Since(m.lastReserve); age > m.MaxReserveAge {
+		return fmt.Sprintf("last reserve completed %s ago", age.Round(time.Second))
+	}
+
+	return ""
+}
+
+//HealthHandler returns HTTP handler of liveness endpoint
+func (m *Monitor) HealthHandler() http.Handler {
+	return statusHandler(m.Health)
+}
+
+//ReadyHandler returns HTTP handler of readiness endpoint
+func (m *Monitor) ReadyHandler() http.Handler {
+	return statusHandler(m.Ready)
+}
+
+//statusHandler writes status as JSON. Service unavailable is returned if any check fails
+func statusHandler(status func() *Status) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		s := status()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if s.Ok {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		_ = json.NewEncoder(w).Encode(s)
+	})
+}
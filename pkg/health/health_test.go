@@ -0,0 +1,138 @@
+package health_test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/mnikita/task-queue/pkg/health"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newMonitor() *health.Monitor {
+	config := health.NewConfiguration()
+	config.MaxConsumerIdle = time.Millisecond * 20
+	config.MaxThreadIdle = time.Millisecond * 20
+	config.MaxReserveAge = time.Millisecond * 20
+
+	return health.NewMonitor(config)
+}
+
+func TestNotStarted(t *testing.T) {
+	m := newMonitor()
+
+	status := m.Ready()
+
+	assert.False(t, status.Ok)
+	assert.Equal(t, "consumer not running", status.Checks[health.CheckConsumer])
+	assert.Equal(t, "worker not running", status.Checks[health.CheckThreads])
+	assert.Equal(t, health.CheckOk, status.Checks[health.CheckConnection])
+	assert.Equal(t, "no reserve completed", status.Checks[health.CheckReserve])
+}
+
+func TestReady(t *testing.T) {
+	m := newMonitor()
+
+	m.WorkerStarted(2)
+	m.ThreadStarted(1)
+	m.ThreadStarted(2)
+	m.ConsumerStarted()
+	m.ReserveCompleted()
+
+	assert.True(t, m.Health().Ok)
+	assert.True(t, m.Ready().Ok)
+
+	m.ReserveFailed(errors.New("connection refused"))
+
+	status := m.Ready()
+
+	assert.False(t, status.Ok)
+	assert.Equal(t, "connection refused", status.Checks[health.CheckConnection])
+	assert.True(t, m.Health().Ok)
+
+	m.ReserveCompleted()
+	m.ConsumerDraining()
+
+	assert.Equal(t, "consumer draining", m.Ready().Checks[health.CheckReserve])
+}
+
+func TestConnectionEvents(t *testing.T) {
+	m := newMonitor()
+
+	m.OnConnect()
+
+	assert.Equal(t, health.CheckOk, m.Ready().Checks[health.CheckConnection])
+
+	m.OnDisconnect(errors.New("connection reset by peer"))
+
+	assert.Equal(t, "connection reset by peer", m.Ready().Checks[health.CheckConnection])
+
+	m.OnConnect()
+
+	assert.Equal(t, health.CheckOk, m.Ready().Checks[health.CheckConnection])
+}
+
+func TestStale(t *testing.T) {
+	m := newMonitor()
+
+	m.WorkerStarted(2)
+	m.ThreadStarted(1)
+	m.ThreadActive(2, true)
+	m.ConsumerStarted()
+	m.ReserveCompleted()
+
+	time.Sleep(time.Millisecond * 30)
+
+	status := m.Ready()
+
+	assert.False(t, status.Ok)
+	assert.Contains(t, status.Checks[health.CheckConsumer], "consumer inactive")
+	assert.Equal(t, "1 of 2 task threads alive", status.Checks[health.CheckThreads])
+	assert.Contains(t, status.Checks[health.CheckReserve], "last reserve completed")
+
+	m.ThreadEnded(2)
+	m.ThreadActive(1, false)
+	m.ConsumerActive()
+
+	status = m.Health()
+
+	assert.Equal(t, health.CheckOk, status.Checks[health.CheckConsumer])
+	assert.Equal(t, "1 of 2 task threads alive", status.Checks[health.CheckThreads])
+}
+
+func TestHandlers(t *testing.T) {
+	m := newMonitor()
+
+	m.WorkerStarted(0)
+	m.ConsumerStarted()
+
+	recorder := httptest.NewRecorder()
+	m.HealthHandler().ServeHTTP(recorder, httptest.NewRequest("GET", health.PathHealth, nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	m.ReadyHandler().ServeHTTP(recorder, httptest.NewRequest("GET", health.PathReady, nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	status := &health.Status{}
+
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), status))
+	assert.False(t, status.Ok)
+	assert.Equal(t, "no reserve completed", status.Checks[health.CheckReserve])
+}
+
+func TestNilMonitor(t *testing.T) {
+	var m *health.Monitor
+
+	m.ConsumerStarted()
+	m.ReserveFailed(errors.New("test error"))
+	m.WorkerStarted(1)
+	m.ThreadActive(1, true)
+	m.ThreadEnded(1)
+	m.OnDisconnect(errors.New("test error"))
+	m.OnConnect()
+}
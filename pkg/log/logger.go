@@ -42,15 +42,49 @@ type MessageId int
 var (
 	missingCliUrl             = Event{"Connection URL not specified"}
 	missingChannel            = Event{"Channel not specified"}
+	connectionUnavailable     = Event{"Connection unavailable. Reconnecting ..."}
+	missingDeadLetterTube     = Event{"Dead-letter tube not specified"}
+	missingDeadLetterOrigin   = Event{"Dead letter(%d) origin tube unknown"}
+	invalidDeadLetter         = Event{"Invalid dead letter(%d) JSON format: %s"}
 	missingConsumerHandler    = Event{"ConsumerHandler not specified"}
 	missingTaskPayloadHandler = Event{"TaskPayloadHandler not specified"}
 	registeredTaskHandler     = Event{"RegisteredTaskHandler(%s): unknown task name"}
+	invalidTypedTask          = Event{"Typed task(%s) handler %s: %s"}
 	taskThread                = Event{"Task(%s) failed: %s"}
+	taskTimeout               = Event{"Task(%s) timed out after %d seconds"}
+	taskCanceled              = Event{"Task(%s) canceled"}
+	taskPanic                 = Event{"panic: %v"}
+	taskQuarantined           = Event{"Task(%s) quarantined after %d panics"}
 	workerWaitTimeout         = Event{"Timed out waiting for task threads to close after %d seconds"}
+	unauthorizedTask          = Event{"Task(%s) not authorized: %s"}
+	missingTaskHeader         = Event{"Task(%s) missing header: %s"}
+	invalidConfiguration      = Event{"Invalid configuration %s: %s"}
+	invalidTaskPool           = Event{"Pool(%s) requires name and positive concurrency"}
+	unknownTaskPool           = Event{"Task(%s) assigned to unknown pool %s"}
 
 	emptyReserveTaskPayload   = Event{"Task(%d) payload empty"}
 	invalidReserveTaskPayload = Event{"Invalid Reserved Task(%d) JSON format: %s"}
 	invalidTaskPayload        = Event{"Invalid Task(id: %d, name: %s) payload JSON format: %s"}
+	invalidJobStats           = Event{"Invalid Job(%d) stats field %s: %s"}
+	invalidStats              = Event{"Invalid stats field %s: %s"}
+	unknownPeekState          = Event{"Unknown peek job state %s, expected ready, delayed or buried"}
+	emptyBulkTasks            = Event{"No tasks to put"}
+	invalidBulkTask           = Event{"Invalid task(%d): %s"}
+	missingBulkTaskName       = Event{"Task(%d) name not specified"}
+	bulkPutFailed             = Event{"%d of %d tasks failed"}
+	invalidArchivedJob        = Event{"Invalid archived job at line %d: %s"}
+	unknownArchivedJobState   = Event{"Archived job at line %d has unknown state %s"}
+	missingArchivedJobTube    = Event{"Archived job at line %d has no tube"}
+	invalidTubeName           = Event{"Invalid tube name %q"}
+	lastWatchedTube           = Event{"Tube %s is the last watched tube and can not be ignored"}
+	workerRequest             = Event{"Worker request %s %s failed: %s"}
+
+	callTimeout          = Event{"Call of Task(%s) job(%d) timed out waiting for reply"}
+	remoteTask           = Event{"Remote Task(%s) failed: %s"}
+	missingResultStore   = Event{"Result store not configured"}
+	unknownResultBackend = Event{"Unknown result store backend: %s"}
+	resultNotFound       = Event{"Result(%d) not found"}
+	invalidResult        = Event{"Invalid Result(%d) JSON format: %s"}
 )
 
 //messages
@@ -63,24 +97,39 @@ var (
 	taskThreadWaitQuit  = Event{"Waiting on task thread to end after %d seconds"}
 	taskQueued          = Event{"Task(%s) queued"}
 	taskQueueTimeout    = Event{"Task(%s) queue timeout after %d seconds. Retrying ..."}
+	taskRelease         = Event{"Task(%s) released with delay %d seconds"}
 	taskThreadsStopping = Event{"Task threads (%d) stopping ..."}
 	threadHeartbeat     = Event{"Task thread (%d) heartbeat after %d seconds"}
+	taskPanicStack      = Event{"Task(%s) panic recovered: %s\n%s"}
+	taskStarted         = Event{"Task(%s) started"}
+	taskFinished        = Event{"Task(%s) finished in %s"}
+	taskSkipped         = Event{"Task(%s) skipped"}
 
 	workerStarted  = Event{"Worker started"}
 	workerStopping = Event{"Worker stopping"}
 	workerEnded    = Event{"Worker ended"}
 
+	workerConcurrency = Event{"Worker concurrency changed from %d to %d"}
+
+	taskLimitExceeded = Event{"Task(%s) exceeds limit of %d running tasks. Releasing ..."}
+	taskQueueFull     = Event{"Task(%s) queue is full. Releasing with delay %s"}
+
 	consumerStarted        = Event{"Consumer started"}
 	consumerStopping       = Event{"Consumer stopping"}
+	consumerDraining       = Event{"Consumer draining"}
+	consumerInFlight       = Event{"Task(%s) still in flight on consumer stop. Releasing ..."}
 	consumerEnded          = Event{"Consumer ended"}
 	consumerReserveTimeout = Event{"Reserve timeout after %d seconds"}
 	consumerHeartbeat      = Event{"Consumer heartbeat after %d seconds"}
+	consumerDeadlineSoon   = Event{"Reserved jobs time to run about to expire. Touching jobs in flight"}
 
 	taskProcessEvent        = Event{"Task event (%s) received: (%s)"}
 	taskResult              = Event{"Task (%s) result: (%s)"}
 	taskSuccess             = Event{"Task success received: (%s)"}
 	taskHeartbeat           = Event{"Task heartbeat received: (%s)"}
 	taskProcessEventTimeout = Event{"Task event (%s) timeout after (%s) seconds: (%s)"}
+	taskRetry               = Event{"Task (%s) failed on attempt %d. Retrying after %d seconds"}
+	taskRetryExhausted      = Event{"Task (%s) failed after %d attempts"}
 
 	consumerReserve = Event{"Reserve (timeout: %d seconds)"}
 	consumerRelease = Event{"Release (Id: %d, Priority: (%d), Delay: (%d seconds))"}
@@ -90,16 +139,35 @@ var (
 	consumerDelete  = Event{"Delete (Id: (%d))"}
 	consumerClose   = Event{"Close consumer connection"}
 
+	consumerDeadLetter = Event{"Dead letter (Id: (%d)) moved to tube %s"}
+	consumerReply      = Event{"Reply (Id: (%d)) put to tube %s"}
+	consumerReplyLate  = Event{"Reply (Id: (%d)) not put to tube %s, caller stopped waiting at %s"}
+
 	configWatchError    = Event{"Configuration watcher error: %s"}
 	configWatchModified = Event{"Configuration file modified: %s"}
 	configWatchStart    = Event{"Configuration watch started"}
 	configWatchStop     = Event{"Configuration watch stopped"}
 	configWatchFile     = Event{"Configuration watch added file: %s"}
 
-	containerConfigLoaded = Event{"Configuration loaded successfully: %s"}
+	containerConfigLoaded   = Event{"Configuration loaded successfully: %s"}
+	containerConfigReloaded = Event{"Configuration reloaded successfully: %s"}
+	containerConfigRejected = Event{"Configuration reload rejected, previous configuration kept: %s"}
+
+	serverStarted = Event{"HTTP server listening on %s"}
+	serverStopped = Event{"HTTP server stopped"}
+
+	cliJobExported = Event{"Job(%d) %s exported from tube %s"}
+	cliJobImported = Event{"Job(%d) %s imported as job(%d) to tube %s"}
+
+	cliDeadLettersStopped = Event{"Reading dead letters from tube %s stopped, reserved dead letter is about to expire"}
 
 	beanUrl                   = Event{"URL configured: %s"}
 	beanConnectionEstablished = Event{"Connection successfully established. Listen on tubes %s"}
+	beanConnectionLost        = Event{"Connection lost: %s. Reconnecting ..."}
+	beanReconnectFailed       = Event{"Reconnection failed: %s. Retrying in %s"}
+	beanTubesChanged          = Event{"Watched tubes changed to %s. Reconnecting ..."}
+	beanTubeWatched           = Event{"Tube %s watched"}
+	beanTubeIgnored           = Event{"Tube %s ignored"}
 
 	reservedTaskBody = Event{"Body of reserved task: (%s)"}
 )
@@ -143,6 +211,41 @@ func MissingChannel() error {
 	return &Error{missingChannel.message}
 }
 
+//Error message
+func ConnectionUnavailableError() error {
+	return &Error{connectionUnavailable.message}
+}
+
+//Error message
+func InvalidConfigurationError(field string, reason string) error {
+	return &Error{fmt.Sprintf(invalidConfiguration.message, field, reason)}
+}
+
+//Error message
+func InvalidTaskPoolError(pool string) error {
+	return &Error{fmt.Sprintf(invalidTaskPool.message, pool)}
+}
+
+//Error message
+func UnknownTaskPoolError(taskName string, pool string) error {
+	return &Error{fmt.Sprintf(unknownTaskPool.message, taskName, pool)}
+}
+
+//Error message
+func MissingDeadLetterTube() error {
+	return &Error{missingDeadLetterTube.message}
+}
+
+//Error message
+func MissingDeadLetterOriginError(id uint64) error {
+	return &Error{fmt.Sprintf(missingDeadLetterOrigin.message, id)}
+}
+
+//Error message
+func InvalidDeadLetterError(id uint64, err error) error {
+	return &Error{fmt.Sprintf(invalidDeadLetter.message, id, err)}
+}
+
 //Error message
 func MissingConsumerHandlerError() error {
 	return &Error{missingConsumerHandler.message}
@@ -158,6 +261,21 @@ func RegisteredTaskHandlerError(taskName string) error {
 	return &Error{fmt.Sprintf(registeredTaskHandler.message, taskName)}
 }
 
+//Error message
+func UnauthorizedTaskError(taskName string, err error) error {
+	return &Error{fmt.Sprintf(unauthorizedTask.message, taskName, err)}
+}
+
+//Error message
+func MissingTaskHeaderError(taskName string, key string) error {
+	return &Error{fmt.Sprintf(missingTaskHeader.message, taskName, key)}
+}
+
+//Error message
+func InvalidTypedTaskError(taskName string, handlerType string, reason string) error {
+	return &Error{fmt.Sprintf(invalidTypedTask.message, taskName, handlerType, reason)}
+}
+
 //Error message
 func EmptyReserveTaskPayloadError(id uint64) error {
 	return &Error{fmt.Sprintf(emptyReserveTaskPayload.message, id)}
@@ -173,11 +291,126 @@ func InvalidTaskPayloadError(id uint64, taskName string, err error) error {
 	return &Error{fmt.Sprintf(invalidTaskPayload.message, id, taskName, err)}
 }
 
+//Error message
+func InvalidStatsError(field string, err error) error {
+	return &Error{fmt.Sprintf(invalidStats.message, field, err)}
+}
+
+//Error message
+func UnknownPeekStateError(state string) error {
+	return &Error{fmt.Sprintf(unknownPeekState.message, state)}
+}
+
+//Error message
+func EmptyBulkTasksError() error {
+	return &Error{emptyBulkTasks.message}
+}
+
+//Error message
+func InvalidBulkTaskError(item int, err error) error {
+	return &Error{fmt.Sprintf(invalidBulkTask.message, item, err)}
+}
+
+//Error message
+func MissingBulkTaskNameError(item int) error {
+	return &Error{fmt.Sprintf(missingBulkTaskName.message, item)}
+}
+
+//Error message
+func BulkPutFailedError(failed int, total int) error {
+	return &Error{fmt.Sprintf(bulkPutFailed.message, failed, total)}
+}
+
+//Error message
+func InvalidArchivedJobError(line int, err error) error {
+	return &Error{fmt.Sprintf(invalidArchivedJob.message, line, err)}
+}
+
+//Error message
+func UnknownArchivedJobStateError(line int, state string) error {
+	return &Error{fmt.Sprintf(unknownArchivedJobState.message, line, state)}
+}
+
+//Error message
+func MissingArchivedJobTubeError(line int) error {
+	return &Error{fmt.Sprintf(missingArchivedJobTube.message, line)}
+}
+
+//Error message
+func InvalidTubeNameError(tube string) error {
+	return &Error{fmt.Sprintf(invalidTubeName.message, tube)}
+}
+
+//Error message
+func LastWatchedTubeError(tube string) error {
+	return &Error{fmt.Sprintf(lastWatchedTube.message, tube)}
+}
+
+//Error message
+func WorkerRequestError(method string, url string, reason string) error {
+	return &Error{fmt.Sprintf(workerRequest.message, method, url, reason)}
+}
+
+//Error message
+func InvalidJobStatsError(id uint64, field string, err error) error {
+	return &Error{fmt.Sprintf(invalidJobStats.message, id, field, err)}
+}
+
+//Error message
+func CallTimeoutError(taskName string, id uint64) error {
+	return &Error{fmt.Sprintf(callTimeout.message, taskName, id)}
+}
+
+//Error message
+func RemoteTaskError(taskName string, message string) error {
+	return &Error{fmt.Sprintf(remoteTask.message, taskName, message)}
+}
+
+//Error message
+func MissingResultStore() error {
+	return &Error{missingResultStore.message}
+}
+
+//Error message
+func UnknownResultBackendError(backend string) error {
+	return &Error{fmt.Sprintf(unknownResultBackend.message, backend)}
+}
+
+//Error message
+func ResultNotFoundError(id uint64) error {
+	return &Error{fmt.Sprintf(resultNotFound.message, id)}
+}
+
+//Error message
+func InvalidResultError(id uint64, err error) error {
+	return &Error{fmt.Sprintf(invalidResult.message, id, err)}
+}
+
 //Error message
 func TaskThreadError(taskName string, err error) error {
 	return &Error{fmt.Sprintf(taskThread.message, taskName, err)}
 }
 
+//Error message
+func TaskTimeoutError(taskName string, timeout time.Duration) error {
+	return &Error{fmt.Sprintf(taskTimeout.message, taskName, timeout/time.Second)}
+}
+
+//Error message
+func TaskCanceledError(taskName string) error {
+	return &Error{fmt.Sprintf(taskCanceled.message, taskName)}
+}
+
+//Error message
+func TaskPanicError(value interface{}) error {
+	return &Error{fmt.Sprintf(taskPanic.message, value)}
+}
+
+//Error message
+func TaskQuarantinedError(taskName string, panics int) error {
+	return &Error{fmt.Sprintf(taskQuarantined.message, taskName, panics)}
+}
+
 //Error message
 func WorkerWaitTimeoutError(secs time.Duration) error {
 	return &Error{fmt.Sprintf(workerWaitTimeout.message, secs/time.Second)}
@@ -223,11 +456,26 @@ func (l *StandardLogger) TaskProcessEventTimeout(eventType string, taskName stri
 	l.Infof(taskProcessEventTimeout.message, eventType, secs/time.Second, taskName)
 }
 
+//Log message
+func (l *StandardLogger) TaskRetry(taskName string, attempts int, delay time.Duration) {
+	l.Infof(taskRetry.message, taskName, attempts, delay/time.Second)
+}
+
+//Log message
+func (l *StandardLogger) TaskRetryExhausted(taskName string, attempts int) {
+	l.Infof(taskRetryExhausted.message, taskName, attempts)
+}
+
 //Log message
 func (l *StandardLogger) TaskThreadWaitQuit(secs time.Duration) {
 	l.Infof(taskThreadWaitQuit.message, secs/time.Second)
 }
 
+//Log message
+func (l *StandardLogger) TaskPanic(taskName string, err error, stack []byte) {
+	l.Errorf(taskPanicStack.message, taskName, err, stack)
+}
+
 //Log message
 func (l *StandardLogger) TaskThreadStarted(id int) {
 	l.Infof(taskThreadStarted.message, id)
@@ -253,6 +501,26 @@ func (l *StandardLogger) TaskQueueTimeout(name string, secs time.Duration) {
 	l.Infof(taskQueueTimeout.message, name, secs/time.Second)
 }
 
+//Log message
+func (l *StandardLogger) TaskRelease(name string, delay time.Duration) {
+	l.Infof(taskRelease.message, name, delay/time.Second)
+}
+
+//Log message
+func (l *StandardLogger) TaskStarted(name string) {
+	l.Infof(taskStarted.message, name)
+}
+
+//Log message
+func (l *StandardLogger) TaskFinished(name string, duration time.Duration) {
+	l.Infof(taskFinished.message, name, duration)
+}
+
+//Log message
+func (l *StandardLogger) TaskSkipped(name string) {
+	l.Infof(taskSkipped.message, name)
+}
+
 //Log message
 func (l *StandardLogger) WorkerStarted() {
 	l.Infof(workerStarted.message)
@@ -268,6 +536,21 @@ func (l *StandardLogger) WorkerEnded() {
 	l.Infof(workerEnded.message)
 }
 
+//Log message
+func (l *StandardLogger) TaskLimitExceeded(taskName string, limit int) {
+	l.Infof(taskLimitExceeded.message, taskName, limit)
+}
+
+//Log message
+func (l *StandardLogger) TaskQueueFull(taskName string, delay time.Duration) {
+	l.Infof(taskQueueFull.message, taskName, delay)
+}
+
+//Log message
+func (l *StandardLogger) WorkerConcurrency(previous int, concurrency int) {
+	l.Infof(workerConcurrency.message, previous, concurrency)
+}
+
 //Log message
 func (l *StandardLogger) ConsumerStarted() {
 	l.Infof(consumerStarted.message)
@@ -278,6 +561,16 @@ func (l *StandardLogger) ConsumerStopping() {
 	l.Infof(consumerStopping.message)
 }
 
+//Log message
+func (l *StandardLogger) ConsumerDraining() {
+	l.Infof(consumerDraining.message)
+}
+
+//Log message
+func (l *StandardLogger) ConsumerReleaseInFlight(taskName string) {
+	l.Infof(consumerInFlight.message, taskName)
+}
+
 //Log message
 func (l *StandardLogger) ConsumerEnded() {
 	l.Infof(consumerEnded.message)
@@ -293,6 +586,11 @@ func (l *StandardLogger) ConsumerHeartbeat(secs time.Duration) {
 	l.Infof(consumerHeartbeat.message, secs/time.Second)
 }
 
+//Log message
+func (l *StandardLogger) ConsumerDeadlineSoon() {
+	l.Infof(consumerDeadlineSoon.message)
+}
+
 //Log message
 func (l *StandardLogger) ThreadHeartbeat(threadId int, secs time.Duration) {
 	l.Infof(threadHeartbeat.message, threadId, secs/time.Second)
@@ -328,6 +626,21 @@ func (l *StandardLogger) ConsumerPut(tube string, pri uint32, delay time.Duratio
 	l.Infof(consumerPut.message, pri, delay/time.Second, ttr/time.Second, tube)
 }
 
+//Log message
+func (l *StandardLogger) ConsumerDeadLetter(id uint64, tube string) {
+	l.Infof(consumerDeadLetter.message, id, tube)
+}
+
+//Log message
+func (l *StandardLogger) ConsumerReply(id uint64, tube string) {
+	l.Infof(consumerReply.message, id, tube)
+}
+
+//Log message
+func (l *StandardLogger) ConsumerReplyLate(id uint64, tube string, deadline time.Time) {
+	l.Infof(consumerReplyLate.message, id, tube, deadline)
+}
+
 //Log message
 func (l *StandardLogger) ConsumerClose() {
 	l.Infof(consumerClose.message)
@@ -363,6 +676,26 @@ func (l *StandardLogger) ContainerConfigLoaded(path string) {
 	l.Infof(containerConfigLoaded.message, path)
 }
 
+//Log message
+func (l *StandardLogger) ContainerConfigReloaded(path string) {
+	l.Infof(containerConfigReloaded.message, path)
+}
+
+//Log message
+func (l *StandardLogger) ContainerConfigRejected(err error) {
+	l.Errorf(containerConfigRejected.message, err)
+}
+
+//Log message
+func (l *StandardLogger) ServerStarted(addr string) {
+	l.Infof(serverStarted.message, addr)
+}
+
+//Log message
+func (l *StandardLogger) ServerStopped() {
+	l.Infof(serverStopped.message)
+}
+
 //Log message
 func (l *StandardLogger) BeanUrl(url string) {
 	l.Infof(beanUrl.message, url)
@@ -373,6 +706,46 @@ func (l *StandardLogger) BeanConnectionEstablished(tubes []string) {
 	l.Infof(beanConnectionEstablished.message, tubes)
 }
 
+//Log message
+func (l *StandardLogger) BeanConnectionLost(err error) {
+	l.Errorf(beanConnectionLost.message, err)
+}
+
+//Log message
+func (l *StandardLogger) BeanReconnectFailed(err error, backoff time.Duration) {
+	l.Errorf(beanReconnectFailed.message, err, backoff)
+}
+
+//Log message
+func (l *StandardLogger) CliJobExported(id uint64, state string, tube string) {
+	l.Infof(cliJobExported.message, id, state, tube)
+}
+
+//Log message
+func (l *StandardLogger) CliDeadLettersStopped(tube string) {
+	l.Warnf(cliDeadLettersStopped.message, tube)
+}
+
+//Log message
+func (l *StandardLogger) CliJobImported(id uint64, state string, newId uint64, tube string) {
+	l.Infof(cliJobImported.message, id, state, newId, tube)
+}
+
+//Log message
+func (l *StandardLogger) BeanTubesChanged(tubes []string) {
+	l.Infof(beanTubesChanged.message, tubes)
+}
+
+//Log message
+func (l *StandardLogger) BeanTubeWatched(tube string) {
+	l.Infof(beanTubeWatched.message, tube)
+}
+
+//Log message
+func (l *StandardLogger) BeanTubeIgnored(tube string) {
+	l.Infof(beanTubeIgnored.message, tube)
+}
+
 //Log message
 func (l *StandardLogger) ReservedTaskBody(body string) {
 	l.Infof(reservedTaskBody.message, body)
@@ -0,0 +1,784 @@
+//Package memory provides in-process broker with beanstalkd semantics for tests and embedded use
+package memory
+
+import (
+	"container/heap"
+	gob "github.com/beanstalkd/go-beanstalk"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const DefaultTube = "default"
+
+//Job states reported by StatsJob
+const (
+	StateReady    = "ready"
+	StateDelayed  = "delayed"
+	StateReserved = "reserved"
+	StateBuried   = "buried"
+)
+
+//urgent ready jobs counted by stats
+const stateUrgent = "urgent"
+
+//Version reported by broker stats
+const Version = "memory"
+
+//Configuration stores broker timing, mirroring beanstalkd server constants
+type Configuration struct {
+	//Smallest time to run given to a job
+	MinTtr time.Duration
+
+	//Time before reserved job expires after which reserve reports deadline soon
+	SafetyMargin time.Duration
+}
+
+type job struct {
+	id    uint64
+	tube  string
+	pri   uint32
+	body  []byte
+	state string
+
+	delay   time.Duration
+	ttr     time.Duration
+	created time.Time
+
+	//time when delayed job becomes ready or reserved job expires
+	deadline time.Time
+
+	//connection holding reserved job
+	conn *Conn
+
+	//position in ready heap
+	index int
+
+	reserves int
+	timeouts int
+	releases int
+	buries   int
+	kicks    int
+}
+
+//jobHeap orders ready jobs by priority and then by id
+type jobHeap []*job
+
+type tube struct {
+	ready  jobHeap
+	buried []*job
+
+	//reserves from paused tube wait until pause ends
+	pause      time.Duration
+	pauseUntil time.Time
+
+	totalJobs int
+	deletes   int
+	pauses    int
+}
+
+//Broker stores jobs of all tubes shared by its connections
+type Broker struct {
+	*Configuration
+
+	mux    sync.Mutex
+	lastId uint64
+	jobs   map[uint64]*job
+	tubes  map[string]*tube
+
+	started     time.Time
+	connections int
+
+	//closed and replaced on every change to wake up waiting reserves
+	changed chan struct{}
+}
+
+func (h jobHeap) Len() int {
+	return len(h)
+}
+
+//before reports whether job a is reserved ahead of job b
+func before(a, b *job) bool {
+	if a.pri != b.pri {
+		return a.pri < b.pri
+	}
+
+	return a.id < b.id
+}
+
+func (h jobHeap) Less(i, j int) bool {
+	return before(h[i], h[j])
+}
+
+func (h jobHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *jobHeap) Push(x interface{}) {
+	j := x.(*job)
+	j.index = len(*h)
+	*h = append(*h, j)
+}
+
+func (h *jobHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	j := old[n-1]
+	old[n-1] = nil
+	j.index = -1
+	*h = old[:n-1]
+
+	return j
+}
+
+func NewConfiguration() *Configuration {
+	return &Configuration{
+		MinTtr:       time.Second,
+		SafetyMargin: time.Second,
+	}
+}
+
+//NewBroker creates empty broker with default tube
+func NewBroker(config *Configuration) *Broker {
+	b := &Broker{Configuration: config}
+
+	b.jobs = make(map[uint64]*job)
+	b.tubes = make(map[string]*tube)
+	b.changed = make(chan struct{})
+	b.started = time.Now()
+
+	b.tube(DefaultTube)
+
+	return b
+}
+
+//Connect opens new connection to the broker
+func (b *Broker) Connect() *Conn {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.connections++
+
+	return &Conn{broker: b}
+}
+
+func connError(op string, err error) error {
+	return gob.ConnError{Op: op, Err: err}
+}
+
+func (b *Broker) tube(name string) *tube {
+	t, ok := b.tubes[name]
+
+	if !ok {
+		t = &tube{}
+		b.tubes[name] = t
+	}
+
+	return t
+}
+
+//seconds formats duration in whole seconds like beanstalkd stats
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
+
+func (b *Broker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func (b *Broker) makeReady(j *job) {
+	j.state = StateReady
+	j.conn = nil
+	j.deadline = time.Time{}
+
+	heap.Push(&b.tube(j.tube).ready, j)
+}
+
+func (b *Broker) makeDelayed(j *job, now time.Time) {
+	j.state = StateDelayed
+	j.conn = nil
+	j.deadline = now.Add(j.delay)
+}
+
+func (b *Broker) schedule(j *job, now time.Time) {
+	if j.delay > 0 {
+		b.makeDelayed(j, now)
+	} else {
+		b.makeReady(j)
+	}
+}
+
+//remove takes job out of its current state
+func (b *Broker) remove(j *job) {
+	t := b.tube(j.tube)
+
+	switch j.state {
+	case StateReady:
+		heap.Remove(&t.ready, j.index)
+	case StateBuried:
+		for i, buried := range t.buried {
+			if buried == j {
+				t.buried = append(t.buried[:i], t.buried[i+1:]...)
+				break
+			}
+		}
+	}
+
+	j.conn = nil
+}
+
+//tick moves delayed jobs to ready state and returns expired reserved jobs to ready state
+func (b *Broker) tick(now time.Time) {
+	for _, j := range b.jobs {
+		if j.deadline.IsZero() || now.Before(j.deadline) {
+			continue
+		}
+
+		switch j.state {
+		case StateDelayed:
+			b.makeReady(j)
+		case StateReserved:
+			j.timeouts++
+			b.makeReady(j)
+		}
+	}
+}
+
+//next returns time until next delayed job, paused tube or time to run of connection jobs needs attention
+func (b *Broker) next(c *Conn, now time.Time) (d time.Duration, ok bool) {
+	for _, t := range b.tubes {
+		if now.Before(t.pauseUntil) && (!ok || t.pauseUntil.Sub(now) < d) {
+			d = t.pauseUntil.Sub(now)
+			ok = true
+		}
+	}
+
+	for _, j := range b.jobs {
+		if j.deadline.IsZero() {
+			continue
+		}
+
+		at := j.deadline
+
+		if j.conn == c {
+			at = at.Add(-b.SafetyMargin)
+		}
+
+		if !ok || at.Sub(now) < d {
+			d = at.Sub(now)
+			ok = true
+		}
+	}
+
+	return d, ok
+}
+
+func (b *Broker) deadlineSoon(c *Conn, now time.Time) bool {
+	for _, j := range b.jobs {
+		if j.state == StateReserved && j.conn == c && !now.Before(j.deadline.Add(-b.SafetyMargin)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b *Broker) nextReady(tubes []string, now time.Time) *job {
+	var next *job
+
+	for _, name := range tubes {
+		t := b.tube(name)
+
+		if len(t.ready) == 0 || now.Before(t.pauseUntil) {
+			continue
+		}
+
+		if next == nil || before(t.ready[0], next) {
+			next = t.ready[0]
+		}
+	}
+
+	return next
+}
+
+func (b *Broker) put(tubeName string, body []byte, pri uint32, delay, ttr time.Duration) uint64 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if ttr < b.MinTtr {
+		ttr = b.MinTtr
+	}
+
+	b.lastId++
+
+	now := time.Now()
+
+	j := &job{id: b.lastId, tube: tubeName, pri: pri, body: body,
+		delay: delay, ttr: ttr, created: now}
+
+	b.jobs[j.id] = j
+	b.tube(tubeName).totalJobs++
+	b.schedule(j, now)
+	b.notify()
+
+	return j.id
+}
+
+func (b *Broker) reserve(c *Conn, tubes []string, timeout time.Duration) (id uint64, body []byte, err error) {
+	end := time.Now().Add(timeout)
+
+	for {
+		b.mux.Lock()
+
+		if c.closed {
+			b.mux.Unlock()
+			return 0, nil, connError("reserve-with-timeout", ErrClosed)
+		}
+
+		now := time.Now()
+		b.tick(now)
+
+		if j := b.nextReady(tubes, now); j != nil {
+			heap.Remove(&b.tube(j.tube).ready, j.index)
+
+			j.state = StateReserved
+			j.conn = c
+			j.deadline = now.Add(j.ttr)
+			j.reserves++
+
+			b.mux.Unlock()
+			return j.id, j.body, nil
+		}
+
+		if b.deadlineSoon(c, now) {
+			b.mux.Unlock()
+			return 0, nil, connError("reserve-with-timeout", gob.ErrDeadline)
+		}
+
+		if !now.Before(end) {
+			b.mux.Unlock()
+			return 0, nil, connError("reserve-with-timeout", gob.ErrTimeout)
+		}
+
+		wait := end.Sub(now)
+
+		if d, ok := b.next(c, now); ok && d < wait {
+			wait = d
+		}
+
+		changed := b.changed
+		b.mux.Unlock()
+
+		select {
+		case <-changed:
+		case <-time.After(wait):
+		}
+	}
+}
+
+//reserved returns job reserved by connection
+func (b *Broker) reserved(c *Conn, id uint64) *job {
+	b.tick(time.Now())
+
+	j, ok := b.jobs[id]
+
+	if !ok || j.state != StateReserved || j.conn != c {
+		return nil
+	}
+
+	return j
+}
+
+func (b *Broker) release(c *Conn, id uint64, pri uint32, delay time.Duration) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	j := b.reserved(c, id)
+
+	if j == nil {
+		return connError("release", gob.ErrNotFound)
+	}
+
+	j.pri = pri
+	j.delay = delay
+	j.releases++
+
+	b.schedule(j, time.Now())
+	b.notify()
+
+	return nil
+}
+
+func (b *Broker) bury(c *Conn, id uint64, pri uint32) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	j := b.reserved(c, id)
+
+	if j == nil {
+		return connError("bury", gob.ErrNotFound)
+	}
+
+	j.pri = pri
+	j.state = StateBuried
+	j.conn = nil
+	j.deadline = time.Time{}
+	j.buries++
+
+	t := b.tube(j.tube)
+	t.buried = append(t.buried, j)
+
+	b.notify()
+
+	return nil
+}
+
+func (b *Broker) touch(c *Conn, id uint64) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	j := b.reserved(c, id)
+
+	if j == nil {
+		return connError("touch", gob.ErrNotFound)
+	}
+
+	j.deadline = time.Now().Add(j.ttr)
+
+	b.notify()
+
+	return nil
+}
+
+func (b *Broker) delete(c *Conn, id uint64) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.tick(time.Now())
+
+	j, ok := b.jobs[id]
+
+	//jobs reserved by other connections can not be deleted
+	if !ok || (j.state == StateReserved && j.conn != c) {
+		return connError("delete", gob.ErrNotFound)
+	}
+
+	b.remove(j)
+	delete(b.jobs, id)
+
+	b.tube(j.tube).deletes++
+
+	b.notify()
+
+	return nil
+}
+
+func (b *Broker) peek(id uint64) ([]byte, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	j, ok := b.jobs[id]
+
+	if !ok {
+		return nil, connError("peek", gob.ErrNotFound)
+	}
+
+	return j.body, nil
+}
+
+//peekState returns job of the tube in given state, which would be reserved or kicked next
+func (b *Broker) peekState(tubeName string, state string) (id uint64, body []byte, err error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.tick(time.Now())
+
+	t := b.tube(tubeName)
+
+	var next *job
+
+	switch state {
+	case StateReady:
+		if len(t.ready) > 0 {
+			next = t.ready[0]
+		}
+	case StateBuried:
+		if len(t.buried) > 0 {
+			next = t.buried[0]
+		}
+	case StateDelayed:
+		for _, j := range b.jobs {
+			if j.tube == tubeName && j.state == StateDelayed && (next == nil || j.deadline.Before(next.deadline)) {
+				next = j
+			}
+		}
+	}
+
+	if next == nil {
+		return 0, nil, connError("peek-"+state, gob.ErrNotFound)
+	}
+
+	return next.id, next.body, nil
+}
+
+func (b *Broker) kickJob(id uint64) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.tick(time.Now())
+
+	j, ok := b.jobs[id]
+
+	if !ok || (j.state != StateBuried && j.state != StateDelayed) {
+		return connError("kick-job", gob.ErrNotFound)
+	}
+
+	b.kick(j)
+	b.notify()
+
+	return nil
+}
+
+func (b *Broker) kick(j *job) {
+	b.remove(j)
+
+	j.kicks++
+
+	b.makeReady(j)
+}
+
+//kickTube kicks buried jobs of the tube or delayed jobs if there are no buried jobs
+func (b *Broker) kickTube(tubeName string, bound int) int {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	now := time.Now()
+	b.tick(now)
+
+	t := b.tube(tubeName)
+
+	var jobs []*job
+
+	if len(t.buried) > 0 {
+		jobs = append(jobs, t.buried...)
+	} else {
+		for _, j := range b.jobs {
+			if j.tube == tubeName && j.state == StateDelayed {
+				jobs = append(jobs, j)
+			}
+		}
+
+		sort.Slice(jobs, func(i, k int) bool {
+			return jobs[i].deadline.Before(jobs[k].deadline)
+		})
+	}
+
+	if len(jobs) > bound {
+		jobs = jobs[:bound]
+	}
+
+	for _, j := range jobs {
+		b.kick(j)
+	}
+
+	b.notify()
+
+	return len(jobs)
+}
+
+func (b *Broker) statsJob(id uint64) (map[string]string, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	now := time.Now()
+	b.tick(now)
+
+	j, ok := b.jobs[id]
+
+	if !ok {
+		return nil, connError("stats-job", gob.ErrNotFound)
+	}
+
+	var timeLeft time.Duration
+
+	if !j.deadline.IsZero() {
+		timeLeft = j.deadline.Sub(now)
+	}
+
+	return map[string]string{
+		"id":        strconv.FormatUint(j.id, 10),
+		"tube":      j.tube,
+		"state":     j.state,
+		"pri":       strconv.FormatUint(uint64(j.pri), 10),
+		"age":       seconds(now.Sub(j.created)),
+		"delay":     seconds(j.delay),
+		"ttr":       seconds(j.ttr),
+		"time-left": seconds(timeLeft),
+		"file":      "0",
+		"reserves":  strconv.Itoa(j.reserves),
+		"timeouts":  strconv.Itoa(j.timeouts),
+		"releases":  strconv.Itoa(j.releases),
+		"buries":    strconv.Itoa(j.buries),
+		"kicks":     strconv.Itoa(j.kicks),
+	}, nil
+}
+
+func (b *Broker) pauseTube(tubeName string, delay time.Duration) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	t, ok := b.tubes[tubeName]
+
+	if !ok {
+		return connError("pause-tube", gob.ErrNotFound)
+	}
+
+	t.pause = delay
+	t.pauseUntil = time.Now().Add(delay)
+	t.pauses++
+
+	b.notify()
+
+	return nil
+}
+
+//count returns number of jobs by state of jobs matching the filter
+func (b *Broker) count(match func(j *job) bool) map[string]int {
+	counts := make(map[string]int)
+
+	for _, j := range b.jobs {
+		if !match(j) {
+			continue
+		}
+
+		counts[j.state]++
+
+		//urgent jobs are ready jobs with priority below 1024
+		if j.state == StateReady && j.pri < 1024 {
+			counts[stateUrgent]++
+		}
+	}
+
+	return counts
+}
+
+func (b *Broker) statsTube(tubeName string) (map[string]string, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	now := time.Now()
+	b.tick(now)
+
+	t, ok := b.tubes[tubeName]
+
+	if !ok {
+		return nil, connError("stats-tube", gob.ErrNotFound)
+	}
+
+	counts := b.count(func(j *job) bool {
+		return j.tube == tubeName
+	})
+
+	var pauseLeft time.Duration
+
+	if now.Before(t.pauseUntil) {
+		pauseLeft = t.pauseUntil.Sub(now)
+	}
+
+	return map[string]string{
+		"name":                  tubeName,
+		"current-jobs-urgent":   strconv.Itoa(counts[stateUrgent]),
+		"current-jobs-ready":    strconv.Itoa(counts[StateReady]),
+		"current-jobs-reserved": strconv.Itoa(counts[StateReserved]),
+		"current-jobs-delayed":  strconv.Itoa(counts[StateDelayed]),
+		"current-jobs-buried":   strconv.Itoa(counts[StateBuried]),
+		"total-jobs":            strconv.Itoa(t.totalJobs),
+		"current-using":         "0",
+		"current-watching":      "0",
+		"current-waiting":       "0",
+		"cmd-delete":            strconv.Itoa(t.deletes),
+		"cmd-pause-tube":        strconv.Itoa(t.pauses),
+		"pause":                 seconds(t.pause),
+		"pause-time-left":       seconds(pauseLeft),
+	}, nil
+}
+
+func (b *Broker) stats() map[string]string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	now := time.Now()
+	b.tick(now)
+
+	counts := b.count(func(j *job) bool {
+		return true
+	})
+
+	totalJobs, timeouts := 0, 0
+
+	for _, t := range b.tubes {
+		totalJobs += t.totalJobs
+	}
+
+	for _, j := range b.jobs {
+		timeouts += j.timeouts
+	}
+
+	return map[string]string{
+		"current-jobs-urgent":   strconv.Itoa(counts[stateUrgent]),
+		"current-jobs-ready":    strconv.Itoa(counts[StateReady]),
+		"current-jobs-reserved": strconv.Itoa(counts[StateReserved]),
+		"current-jobs-delayed":  strconv.Itoa(counts[StateDelayed]),
+		"current-jobs-buried":   strconv.Itoa(counts[StateBuried]),
+		"total-jobs":            strconv.Itoa(totalJobs),
+		"job-timeouts":          strconv.Itoa(timeouts),
+		"current-tubes":         strconv.Itoa(len(b.tubes)),
+		"current-connections":   strconv.Itoa(b.connections),
+		"pid":                   strconv.Itoa(os.Getpid()),
+		"version":               Version,
+		"uptime":                seconds(now.Sub(b.started)),
+	}
+}
+
+func (b *Broker) listTubes() []string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	tubes := make([]string, 0, len(b.tubes))
+
+	for name := range b.tubes {
+		tubes = append(tubes, name)
+	}
+
+	sort.Strings(tubes)
+
+	return tubes
+}
+
+//closeConn returns jobs reserved by connection to ready state. Closing closed connection is no-op
+func (b *Broker) closeConn(c *Conn) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if c.closed {
+		return nil
+	}
+
+	c.closed = true
+	b.connections--
+
+	for _, j := range b.jobs {
+		if j.state == StateReserved && j.conn == c {
+			b.makeReady(j)
+		}
+	}
+
+	b.notify()
+
+	return nil
+}
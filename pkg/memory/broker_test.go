@@ -0,0 +1,302 @@
+package memory_test
+
+import (
+	"github.com/mnikita/task-queue/pkg/consumer"
+	"github.com/mnikita/task-queue/pkg/memory"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newConn() (*memory.Broker, *memory.Conn) {
+	config := memory.NewConfiguration()
+	config.MinTtr = time.Millisecond * 10
+	config.SafetyMargin = time.Millisecond * 5
+
+	b := memory.NewBroker(config)
+
+	return b, b.Connect()
+}
+
+func put(t *testing.T, c *memory.Conn, tube string, body string, pri uint32, delay, ttr time.Duration) uint64 {
+	id, err := c.PutTube(tube, []byte(body), pri, delay, ttr)
+
+	assert.Nil(t, err)
+
+	return id
+}
+
+func reserve(t *testing.T, c *memory.Conn, tube string, timeout time.Duration) (uint64, string) {
+	id, body, err := c.ReserveTube(tube, timeout)
+
+	assert.Nil(t, err)
+
+	return id, string(body)
+}
+
+func state(t *testing.T, c *memory.Conn, id uint64) string {
+	stats, err := c.StatsJob(id)
+
+	assert.Nil(t, err)
+
+	return stats.State
+}
+
+func TestPriority(t *testing.T) {
+	_, c := newConn()
+
+	put(t, c, "default", "low", 100, 0, time.Second)
+	put(t, c, "default", "high", 1, 0, time.Second)
+	put(t, c, "default", "low2", 100, 0, time.Second)
+
+	for _, expected := range []string{"high", "low", "low2"} {
+		_, body := reserve(t, c, "default", 0)
+
+		assert.Equal(t, expected, body)
+	}
+}
+
+func TestReserveTimeout(t *testing.T) {
+	_, c := newConn()
+
+	start := time.Now()
+
+	_, _, err := c.Reserve(time.Millisecond * 20)
+
+	assert.True(t, consumer.IsTimeout(err))
+	assert.True(t, time.Since(start) >= time.Millisecond*20)
+}
+
+func TestReserveWaitsForPut(t *testing.T) {
+	b, c := newConn()
+
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+
+		_, _ = b.Connect().Put([]byte("late"), 1, 0, time.Second)
+	}()
+
+	_, body := reserve(t, c, "default", time.Second)
+
+	assert.Equal(t, "late", body)
+}
+
+func TestDelay(t *testing.T) {
+	_, c := newConn()
+
+	id := put(t, c, "default", "delayed", 1, time.Millisecond*30, time.Second)
+
+	assert.Equal(t, memory.StateDelayed, state(t, c, id))
+
+	_, _, err := c.Reserve(0)
+	assert.True(t, consumer.IsTimeout(err))
+
+	reservedId, _ := reserve(t, c, "default", time.Second)
+	assert.Equal(t, id, reservedId)
+}
+
+func TestTubes(t *testing.T) {
+	_, c := newConn()
+
+	id := put(t, c, "other", "job", 1, 0, time.Second)
+
+	_, _, err := c.Reserve(0)
+	assert.True(t, consumer.IsTimeout(err))
+
+	reservedId, _, err := memory.NewTubeSet(c, "default", "other").Reserve(0)
+	assert.Nil(t, err)
+	assert.Equal(t, id, reservedId)
+
+	tubes, err := c.ListTubes()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"default", "other"}, tubes)
+}
+
+func TestTtrExpiry(t *testing.T) {
+	_, c := newConn()
+
+	id := put(t, c, "default", "job", 1, 0, time.Millisecond*20)
+
+	reserve(t, c, "default", 0)
+
+	//connection holding job is warned before time to run expires
+	_, _, err := c.Reserve(time.Second)
+	assert.True(t, consumer.IsDeadlineSoon(err))
+
+	time.Sleep(time.Millisecond * 20)
+
+	stats, _ := c.StatsJob(id)
+	assert.Equal(t, memory.StateReady, stats.State)
+	assert.Equal(t, 1, stats.Timeouts)
+
+	//expired job can not be released by previous owner
+	assert.EqualError(t, c.Release(id, 1, 0), "release: not found")
+}
+
+func TestTouch(t *testing.T) {
+	_, c := newConn()
+
+	id := put(t, c, "default", "job", 1, 0, time.Millisecond*40)
+
+	reserve(t, c, "default", 0)
+
+	time.Sleep(time.Millisecond * 25)
+	assert.Nil(t, c.Touch(id))
+	time.Sleep(time.Millisecond * 25)
+
+	assert.Equal(t, memory.StateReserved, state(t, c, id))
+}
+
+func TestReleaseOwnership(t *testing.T) {
+	b, c := newConn()
+	other := b.Connect()
+
+	id := put(t, c, "default", "job", 1, 0, time.Second)
+
+	reserve(t, c, "default", 0)
+
+	assert.EqualError(t, other.Release(id, 1, 0), "release: not found")
+	assert.EqualError(t, other.Delete(id), "delete: not found")
+
+	assert.Nil(t, c.Release(id, 5, 0))
+
+	stats, _ := c.StatsJob(id)
+	assert.Equal(t, memory.StateReady, stats.State)
+	assert.Equal(t, uint32(5), stats.Priority)
+	assert.Equal(t, 1, stats.Releases)
+}
+
+func TestBuryKick(t *testing.T) {
+	_, c := newConn()
+
+	buried := put(t, c, "default", "buried", 1, 0, time.Second)
+	delayed := put(t, c, "default", "delayed", 1, time.Hour, time.Second)
+
+	reserve(t, c, "default", 0)
+	assert.Nil(t, c.Bury(buried, 1))
+
+	assert.Equal(t, memory.StateBuried, state(t, c, buried))
+
+	tube := memory.NewTube(c, "default")
+
+	//buried jobs are kicked before delayed
+	n, err := tube.Kick(10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, memory.StateReady, state(t, c, buried))
+	assert.Equal(t, memory.StateDelayed, state(t, c, delayed))
+
+	n, _ = tube.Kick(10)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, memory.StateReady, state(t, c, delayed))
+
+	assert.EqualError(t, c.KickJob(delayed), "kick-job: not found")
+}
+
+func TestDelete(t *testing.T) {
+	_, c := newConn()
+
+	id := put(t, c, "default", "job", 1, 0, time.Second)
+
+	assert.Nil(t, c.Delete(id))
+
+	_, err := c.Peek(id)
+	assert.EqualError(t, err, "peek: not found")
+}
+
+func TestCloseReleasesJobs(t *testing.T) {
+	b, c := newConn()
+
+	id := put(t, c, "default", "job", 1, 0, time.Second)
+
+	reserve(t, c, "default", 0)
+
+	assert.Nil(t, c.Close())
+
+	other := b.Connect()
+	assert.Equal(t, memory.StateReady, state(t, other, id))
+
+	_, _, err := c.Reserve(0)
+	assert.EqualError(t, err, "reserve-with-timeout: connection closed")
+}
+
+func TestPeekState(t *testing.T) {
+	_, c := newConn()
+
+	ready := put(t, c, "default", "ready", 1, 0, time.Second)
+	delayed := put(t, c, "default", "delayed", 1, time.Hour, time.Second)
+	buried := put(t, c, "default", "buried", 0, 0, time.Second)
+
+	reserve(t, c, "default", 0)
+	assert.Nil(t, c.Bury(buried, 0))
+
+	id, body, err := c.PeekReady("default")
+	assert.Nil(t, err)
+	assert.Equal(t, ready, id)
+	assert.Equal(t, "ready", string(body))
+
+	id, _, _ = c.PeekDelayed("default")
+	assert.Equal(t, delayed, id)
+
+	id, _, _ = c.PeekBuried("default")
+	assert.Equal(t, buried, id)
+
+	_, _, err = c.PeekBuried("mika")
+	assert.EqualError(t, err, "peek-buried: not found")
+
+	n, err := c.Kick("default", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, memory.StateReady, state(t, c, buried))
+}
+
+func TestPauseTube(t *testing.T) {
+	_, c := newConn()
+
+	id := put(t, c, "default", "job", 1, 0, time.Second)
+
+	assert.Nil(t, c.PauseTube("default", time.Millisecond*50))
+
+	_, _, err := c.ReserveTube("default", 0)
+	assert.True(t, consumer.IsTimeout(err))
+
+	stats, err := c.StatsTube("default")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Pauses)
+
+	//reserve waits until tube pause ends
+	reserved, _ := reserve(t, c, "default", time.Second)
+	assert.Equal(t, id, reserved)
+
+	assert.EqualError(t, c.PauseTube("mika", time.Second), "pause-tube: not found")
+}
+
+func TestStats(t *testing.T) {
+	b, c := newConn()
+
+	put(t, c, "default", "urgent", 1, 0, time.Second)
+	put(t, c, "default", "delayed", 2000, time.Hour, time.Second)
+	id := put(t, c, "mika", "ready", 2000, 0, time.Second)
+
+	assert.Nil(t, c.Delete(id))
+
+	stats, err := c.StatsTube("default")
+	assert.Nil(t, err)
+	assert.Equal(t, &consumer.TubeStats{Name: "default", Urgent: 1, Ready: 1, Delayed: 1, TotalJobs: 2}, stats)
+
+	tubeStats, _ := c.StatsTube("mika")
+	assert.Equal(t, 1, tubeStats.Deletes)
+
+	_, err = c.StatsTube("pera")
+	assert.EqualError(t, err, "stats-tube: not found")
+
+	b.Connect()
+
+	server, err := c.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, server.Ready+server.Delayed)
+	assert.Equal(t, 3, server.TotalJobs)
+	assert.Equal(t, 2, server.Tubes)
+	assert.Equal(t, 2, server.Connections)
+	assert.Equal(t, memory.Version, server.Version)
+}
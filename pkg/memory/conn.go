@@ -0,0 +1,222 @@
+package memory
+
+import (
+	"errors"
+	"github.com/mnikita/task-queue/pkg/consumer"
+	"time"
+)
+
+var ErrClosed = errors.New("connection closed")
+
+//Conn is a connection to in-memory broker. Like beanstalkd connection it uses and watches default tube
+type Conn struct {
+	broker *Broker
+
+	//guarded by broker lock
+	closed bool
+}
+
+//Tube puts and kicks jobs of a named tube
+type Tube struct {
+	conn *Conn
+	name string
+}
+
+//TubeSet reserves jobs from several tubes
+type TubeSet struct {
+	conn  *Conn
+	names []string
+}
+
+func NewTube(conn *Conn, name string) *Tube {
+	return &Tube{conn: conn, name: name}
+}
+
+func NewTubeSet(conn *Conn, names ...string) *TubeSet {
+	return &TubeSet{conn: conn, names: names}
+}
+
+func (t *Tube) Name() string {
+	return t.name
+}
+
+func (t *Tube) Put(body []byte, pri uint32, delay, ttr time.Duration) (id uint64, err error) {
+	return t.conn.PutTube(t.name, body, pri, delay, ttr)
+}
+
+//Kick moves up to bound buried jobs, or delayed jobs if there are none buried, to ready state
+func (t *Tube) Kick(bound int) (n int, err error) {
+	if err = t.conn.check("kick"); err != nil {
+		return 0, err
+	}
+
+	return t.conn.broker.kickTube(t.name, bound), nil
+}
+
+func (ts *TubeSet) Reserve(timeout time.Duration) (id uint64, body []byte, err error) {
+	return ts.conn.broker.reserve(ts.conn, ts.names, timeout)
+}
+
+func (c *Conn) check(op string) error {
+	c.broker.mux.Lock()
+	defer c.broker.mux.Unlock()
+
+	if c.closed {
+		return connError(op, ErrClosed)
+	}
+
+	return nil
+}
+
+func (c *Conn) Reserve(timeout time.Duration) (id uint64, body []byte, err error) {
+	return c.ReserveTube(DefaultTube, timeout)
+}
+
+func (c *Conn) ReserveTube(tube string, timeout time.Duration) (id uint64, body []byte, err error) {
+	return c.broker.reserve(c, []string{tube}, timeout)
+}
+
+func (c *Conn) Put(body []byte, pri uint32, delay, ttr time.Duration) (id uint64, err error) {
+	return c.PutTube(DefaultTube, body, pri, delay, ttr)
+}
+
+func (c *Conn) PutTube(tube string, body []byte, pri uint32, delay, ttr time.Duration) (id uint64, err error) {
+	if err = c.check("put"); err != nil {
+		return 0, err
+	}
+
+	return c.broker.put(tube, body, pri, delay, ttr), nil
+}
+
+func (c *Conn) Release(id uint64, pri uint32, delay time.Duration) error {
+	if err := c.check("release"); err != nil {
+		return err
+	}
+
+	return c.broker.release(c, id, pri, delay)
+}
+
+func (c *Conn) Delete(id uint64) error {
+	if err := c.check("delete"); err != nil {
+		return err
+	}
+
+	return c.broker.delete(c, id)
+}
+
+func (c *Conn) Bury(id uint64, pri uint32) error {
+	if err := c.check("bury"); err != nil {
+		return err
+	}
+
+	return c.broker.bury(c, id, pri)
+}
+
+func (c *Conn) Touch(id uint64) error {
+	if err := c.check("touch"); err != nil {
+		return err
+	}
+
+	return c.broker.touch(c, id)
+}
+
+func (c *Conn) Peek(id uint64) (body []byte, err error) {
+	if err = c.check("peek"); err != nil {
+		return nil, err
+	}
+
+	return c.broker.peek(id)
+}
+
+func (c *Conn) KickJob(id uint64) error {
+	if err := c.check("kick-job"); err != nil {
+		return err
+	}
+
+	return c.broker.kickJob(id)
+}
+
+func (c *Conn) PeekReady(tube string) (id uint64, body []byte, err error) {
+	if err = c.check("peek-ready"); err != nil {
+		return 0, nil, err
+	}
+
+	return c.broker.peekState(tube, StateReady)
+}
+
+func (c *Conn) PeekDelayed(tube string) (id uint64, body []byte, err error) {
+	if err = c.check("peek-delayed"); err != nil {
+		return 0, nil, err
+	}
+
+	return c.broker.peekState(tube, StateDelayed)
+}
+
+func (c *Conn) PeekBuried(tube string) (id uint64, body []byte, err error) {
+	if err = c.check("peek-buried"); err != nil {
+		return 0, nil, err
+	}
+
+	return c.broker.peekState(tube, StateBuried)
+}
+
+func (c *Conn) Kick(tube string, bound int) (n int, err error) {
+	return NewTube(c, tube).Kick(bound)
+}
+
+func (c *Conn) PauseTube(tube string, delay time.Duration) error {
+	if err := c.check("pause-tube"); err != nil {
+		return err
+	}
+
+	return c.broker.pauseTube(tube, delay)
+}
+
+func (c *Conn) StatsJob(id uint64) (*consumer.JobStats, error) {
+	if err := c.check("stats-job"); err != nil {
+		return nil, err
+	}
+
+	stats, err := c.broker.statsJob(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return consumer.ParseJobStats(stats)
+}
+
+func (c *Conn) StatsTube(tube string) (*consumer.TubeStats, error) {
+	if err := c.check("stats-tube"); err != nil {
+		return nil, err
+	}
+
+	stats, err := c.broker.statsTube(tube)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return consumer.ParseTubeStats(stats)
+}
+
+func (c *Conn) Stats() (*consumer.ServerStats, error) {
+	if err := c.check("stats"); err != nil {
+		return nil, err
+	}
+
+	return consumer.ParseServerStats(c.broker.stats())
+}
+
+func (c *Conn) ListTubes() ([]string, error) {
+	if err := c.check("list-tubes"); err != nil {
+		return nil, err
+	}
+
+	return c.broker.listTubes(), nil
+}
+
+//Close returns reserved jobs of the connection to ready state
+func (c *Conn) Close() error {
+	return c.broker.closeConn(c)
+}
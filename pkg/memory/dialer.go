@@ -0,0 +1,30 @@
+package memory
+
+import (
+	"github.com/google/wire"
+	"github.com/mnikita/task-queue/pkg/connection"
+	"github.com/mnikita/task-queue/pkg/consumer"
+)
+
+var WireSet = wire.NewSet(NewDialer)
+
+//MemoryDialer connects to in-memory broker ignoring connection address
+type MemoryDialer struct {
+	broker *Broker
+}
+
+func NewDialer(broker *Broker) connection.Dialer {
+	return &MemoryDialer{broker: broker}
+}
+
+func (d *MemoryDialer) Dial(_ string, _ []string) (consumer.ConnectionHandler, error) {
+	return d.broker.Connect(), nil
+}
+
+func (d *MemoryDialer) CreateChannels(handler consumer.ConnectionHandler, tubes []string) connection.Channels {
+	return NewTubeSet(handler.(*Conn), tubes...)
+}
+
+func (d *MemoryDialer) CreateChannel(handler consumer.ConnectionHandler, tube string) connection.Channel {
+	return NewTube(handler.(*Conn), tube)
+}
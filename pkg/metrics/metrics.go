@@ -0,0 +1,255 @@
+//Package metrics provides task queue metrics exposed in Prometheus text format without client library
+package metrics
+
+import (
+	"context"
+	"github.com/mnikita/task-queue/pkg/common"
+	"github.com/mnikita/task-queue/pkg/middleware"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//Path of metrics HTTP endpoint
+const Path = "/metrics"
+
+//Label names
+const (
+	LabelTask      = "task"
+	LabelTube      = "tube"
+	LabelEvent     = "event"
+	LabelDirection = "direction"
+)
+
+//Directions of worker scaling
+const (
+	ScaleUp   = "up"
+	ScaleDown = "down"
+)
+
+//Metrics records task queue activity. Methods of nil Metrics do nothing,
+//so components record metrics without checking whether metrics are enabled
+type Metrics struct {
+	registry *Registry
+
+	reserved     *Counter
+	succeeded    *Counter
+	failed       *Counter
+	buried       *Counter
+	released     *Counter
+	touched      *Counter
+	deadLettered *Counter
+
+	acceptTimeouts *Counter
+	eventTimeouts  *Counter
+
+	workerScaled *Counter
+
+	taskDuration *Histogram
+	queueWait    *Histogram
+
+	mux       sync.Mutex
+	taskQueue chan<- *common.Task
+	threads   int
+}
+
+func NewMetrics() *Metrics {
+	r := NewRegistry()
+	m := &Metrics{registry: r}
+
+	m.reserved = r.NewCounter("task_queue_jobs_reserved_total",
+		"Jobs reserved by consumer.", LabelTask, LabelTube)
+	m.succeeded = r.NewCounter("task_queue_jobs_succeeded_total",
+		"Jobs deleted after successful task.", LabelTask, LabelTube)
+	m.failed = r.NewCounter("task_queue_jobs_failed_total",
+		"Jobs of failed tasks.", LabelTask, LabelTube)
+	m.buried = r.NewCounter("task_queue_jobs_buried_total",
+		"Jobs buried by consumer.", LabelTask, LabelTube)
+	m.released = r.NewCounter("task_queue_jobs_released_total",
+		"Jobs released by consumer.", LabelTask, LabelTube)
+	m.touched = r.NewCounter("task_queue_jobs_touched_total",
+		"Jobs touched by consumer.", LabelTask, LabelTube)
+	m.deadLettered = r.NewCounter("task_queue_jobs_dead_lettered_total",
+		"Jobs moved to dead-letter tube.", LabelTask, LabelTube)
+
+	m.acceptTimeouts = r.NewCounter("task_queue_accept_timeouts_total",
+		"Tasks not accepted by worker queue in time.", LabelTask)
+	m.eventTimeouts = r.NewCounter("task_queue_event_timeouts_total",
+		"Task events not accepted by consumer in time.", LabelEvent, LabelTask)
+
+	m.workerScaled = r.NewCounter("task_queue_worker_scaled_total",
+		"Task thread count changes of worker.", LabelDirection)
+
+	m.taskDuration = r.NewHistogram("task_queue_task_duration_seconds",
+		"Task execution time.", nil, LabelTask)
+	m.queueWait = r.NewHistogram("task_queue_queue_wait_seconds",
+		"Time from task hand over to worker until execution start.", nil, LabelTask)
+
+	r.NewGaugeFunc("task_queue_task_queue_length", "Tasks waiting in worker queue.",
+		func() float64 {
+			return float64(m.queueLength())
+		})
+	r.NewGaugeFunc("task_queue_task_queue_capacity", "Capacity of worker queue.",
+		func() float64 {
+			return float64(m.queueCapacity())
+		})
+	r.NewGaugeFunc("task_queue_worker_threads", "Task threads of worker.",
+		func() float64 {
+			return float64(m.workerThreads())
+		})
+
+	return m
+}
+
+//Registry returns registry of all task queue metrics
+func (m *Metrics) Registry() *Registry {
+	return m.registry
+}
+
+//Handler returns HTTP handler writing metrics in text exposition format
+func (m *Metrics) Handler() http.Handler {
+	return m.registry
+}
+
+//SetTaskQueue sets worker queue which occupancy is reported
+func (m *Metrics) SetTaskQueue(taskQueue chan<- *common.Task) {
+	if m == nil {
+		return
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.taskQueue = taskQueue
+}
+
+func (m *Metrics) queueLength() int {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	return len(m.taskQueue)
+}
+
+func (m *Metrics) queueCapacity() int {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	return cap(m.taskQueue)
+}
+
+func (m *Metrics) workerThreads() int {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	return m.threads
+}
+
+//WorkerThreads records worker task thread count without counting it as scaling
+func (m *Metrics) WorkerThreads(threads int) {
+	if m == nil {
+		return
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.threads = threads
+}
+
+//WorkerScaled records change of worker task thread count
+func (m *Metrics) WorkerScaled(previous int, threads int) {
+	if m == nil {
+		return
+	}
+
+	m.WorkerThreads(threads)
+
+	if threads > previous {
+		m.workerScaled.Inc(ScaleUp)
+	} else if threads < previous {
+		m.workerScaled.Inc(ScaleDown)
+	}
+}
+
+func (m *Metrics) JobReserved(task *common.Task) {
+	if m != nil {
+		m.reserved.Inc(task.Name, task.Tube)
+	}
+}
+
+func (m *Metrics) JobSucceeded(task *common.Task) {
+	if m != nil {
+		m.succeeded.Inc(task.Name, task.Tube)
+	}
+}
+
+func (m *Metrics) JobFailed(task *common.Task) {
+	if m != nil {
+		m.failed.Inc(task.Name, task.Tube)
+	}
+}
+
+func (m *Metrics) JobBuried(task *common.Task) {
+	if m != nil {
+		m.buried.Inc(task.Name, task.Tube)
+	}
+}
+
+func (m *Metrics) JobReleased(task *common.Task) {
+	if m != nil {
+		m.released.Inc(task.Name, task.Tube)
+	}
+}
+
+func (m *Metrics) JobTouched(task *common.Task) {
+	if m != nil {
+		m.touched.Inc(task.Name, task.Tube)
+	}
+}
+
+func (m *Metrics) JobDeadLettered(task *common.Task) {
+	if m != nil {
+		m.deadLettered.Inc(task.Name, task.Tube)
+	}
+}
+
+func (m *Metrics) AcceptTimeout(task *common.Task) {
+	if m != nil {
+		m.acceptTimeouts.Inc(task.Name)
+	}
+}
+
+func (m *Metrics) EventTimeout(eventType string, task *common.Task) {
+	if m != nil {
+		m.eventTimeouts.Inc(eventType, task.Name)
+	}
+}
+
+func (m *Metrics) TaskDuration(task *common.Task, duration time.Duration) {
+	if m != nil {
+		m.taskDuration.Observe(duration.Seconds(), task.Name)
+	}
+}
+
+//QueueWait records time since task was handed over to worker. Nothing is recorded if hand over time is unknown
+func (m *Metrics) QueueWait(task *common.Task) {
+	if m != nil && !task.ReceivedAt.IsZero() {
+		m.queueWait.Observe(time.Since(task.ReceivedAt).Seconds(), task.Name)
+	}
+}
+
+//Middleware records queue wait and execution time of tasks run by worker
+func (m *Metrics) Middleware() middleware.Middleware {
+	return func(next middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, task *common.Task) error {
+			m.QueueWait(task)
+
+			start := time.Now()
+			err := next(ctx, task)
+
+			m.TaskDuration(task, time.Since(start))
+
+			return err
+		}
+	}
+}
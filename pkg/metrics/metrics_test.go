@@ -0,0 +1,103 @@
+package metrics_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/mnikita/task-queue/pkg/common"
+	"github.com/mnikita/task-queue/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := metrics.NewRegistry()
+
+	c := r.NewCounter("jobs_total", "Jobs.", "task")
+	c.Inc("b")
+	c.Add(2, "a")
+	c.Inc(`q"uo\te`)
+
+	h := r.NewHistogram("duration_seconds", "Duration.", []float64{0.1, 1}, "task")
+	h.Observe(0.05, "a")
+	h.Observe(0.5, "a")
+	h.Observe(5, "a")
+
+	r.NewGaugeFunc("queue_length", "Queue\nlength.", func() float64 {
+		return 3
+	})
+
+	var buf bytes.Buffer
+
+	assert.Nil(t, r.Write(&buf))
+	assert.Equal(t, `# HELP jobs_total Jobs.
+# TYPE jobs_total counter
+jobs_total{task="a"} 2
+jobs_total{task="b"} 1
+jobs_total{task="q\"uo\\te"} 1
+# HELP duration_seconds Duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{task="a",le="0.1"} 1
+duration_seconds_bucket{task="a",le="1"} 2
+duration_seconds_bucket{task="a",le="+Inf"} 3
+duration_seconds_sum{task="a"} 5.55
+duration_seconds_count{task="a"} 3
+# HELP queue_length Queue\nlength.
+# TYPE queue_length gauge
+queue_length 3
+`, buf.String())
+
+	assert.Equal(t, float64(2), c.Value("a"))
+	assert.Equal(t, uint64(3), h.Count("a"))
+	assert.Equal(t, uint64(0), h.Count("b"))
+}
+
+func TestMetrics(t *testing.T) {
+	m := metrics.NewMetrics()
+
+	task := &common.Task{Name: "add", Tube: "math", ReceivedAt: time.Now()}
+
+	m.JobReserved(task)
+	m.JobSucceeded(task)
+	m.EventTimeout("Success", task)
+	m.SetTaskQueue(make(chan *common.Task, 4))
+	m.WorkerThreads(2)
+	m.WorkerScaled(2, 3)
+
+	handler := m.Middleware()(func(_ context.Context, _ *common.Task) error {
+		return nil
+	})
+
+	assert.Nil(t, handler(context.Background(), task))
+
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", metrics.Path, nil))
+
+	body := recorder.Body.String()
+
+	assert.Equal(t, metrics.ContentType, recorder.Header().Get("Content-Type"))
+	assert.True(t, strings.Contains(body, `task_queue_jobs_reserved_total{task="add",tube="math"} 1`))
+	assert.True(t, strings.Contains(body, `task_queue_jobs_succeeded_total{task="add",tube="math"} 1`))
+	assert.True(t, strings.Contains(body, `task_queue_event_timeouts_total{event="Success",task="add"} 1`))
+	assert.True(t, strings.Contains(body, `task_queue_task_duration_seconds_count{task="add"} 1`))
+	assert.True(t, strings.Contains(body, `task_queue_queue_wait_seconds_count{task="add"} 1`))
+	assert.True(t, strings.Contains(body, "task_queue_task_queue_length 0\n"))
+	assert.True(t, strings.Contains(body, "task_queue_task_queue_capacity 4\n"))
+	assert.True(t, strings.Contains(body, "task_queue_worker_threads 3\n"))
+	assert.True(t, strings.Contains(body, `task_queue_worker_scaled_total{direction="up"} 1`))
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *metrics.Metrics
+
+	task := &common.Task{Name: "add"}
+
+	m.JobReserved(task)
+	m.JobBuried(task)
+	m.AcceptTimeout(task)
+	m.QueueWait(task)
+	m.SetTaskQueue(nil)
+	m.WorkerScaled(1, 2)
+}
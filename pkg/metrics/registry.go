@@ -0,0 +1,316 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//ContentType of Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+//Metric types
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+//DefaultBuckets are upper bounds of histogram buckets in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+//labelSeparator joins label values into series key. It cannot appear in valid UTF-8 text
+const labelSeparator = "\xff"
+
+//collector writes metric family in text exposition format
+type collector interface {
+	write(buf *bytes.Buffer)
+}
+
+//Registry keeps metrics and writes them in Prometheus text exposition format
+type Registry struct {
+	mux        sync.Mutex
+	collectors []collector
+}
+
+//family stores metric name, help and label names shared by all series
+type family struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+//Counter is monotonically increasing value partitioned by labels
+type Counter struct {
+	family
+
+	mux    sync.Mutex
+	series map[string]float64
+}
+
+//GaugeFunc is value read from function when metrics are written
+type GaugeFunc struct {
+	family
+
+	fn func() float64
+}
+
+//Histogram counts observations in buckets partitioned by labels
+type Histogram struct {
+	family
+
+	buckets []float64
+
+	mux    sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.collectors = append(r.collectors, c)
+}
+
+func (r *Registry) NewCounter(name string, help string, labels ...string) *Counter {
+	c := &Counter{family: family{name, help, TypeCounter, labels}, series: make(map[string]float64)}
+
+	r.register(c)
+
+	return c
+}
+
+func (r *Registry) NewGaugeFunc(name string, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{family: family{name, help, TypeGauge, nil}, fn: fn}
+
+	r.register(g)
+
+	return g
+}
+
+//NewHistogram creates histogram with given bucket upper bounds. DefaultBuckets are used if not set
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	h := &Histogram{family: family{name, help, TypeHistogram, labels}, buckets: buckets,
+		series: make(map[string]*histogramSeries)}
+
+	r.register(h)
+
+	return h
+}
+
+//Write writes all metrics in text exposition format
+func (r *Registry) Write(w io.Writer) error {
+	r.mux.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mux.Unlock()
+
+	var buf bytes.Buffer
+
+	for _, c := range collectors {
+		c.write(&buf)
+	}
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+
+	_ = r.Write(w)
+}
+
+//Inc increments counter of series with given label values
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *Counter) Add(v float64, values ...string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.series[seriesKey(values)] += v
+}
+
+//Value returns counter of series with given label values
+func (c *Counter) Value(values ...string) float64 {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.series[seriesKey(values)]
+}
+
+func (c *Counter) write(buf *bytes.Buffer) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.header(buf)
+
+	for _, key := range sortedKeys(c.series) {
+		c.sample(buf, c.name, key, "", c.series[key])
+	}
+}
+
+func (g *GaugeFunc) write(buf *bytes.Buffer) {
+	g.header(buf)
+	g.sample(buf, g.name, "", "", g.fn())
+}
+
+//Observe adds observation to series with given label values
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	key := seriesKey(values)
+	s, ok := h.series[key]
+
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+
+	s.count++
+	s.sum += v
+}
+
+//Count returns number of observations of series with given label values
+func (h *Histogram) Count(values ...string) uint64 {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if s, ok := h.series[seriesKey(values)]; ok {
+		return s.count
+	}
+
+	return 0
+}
+
+func (h *Histogram) write(buf *bytes.Buffer) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	h.header(buf)
+
+	keys := make([]string, 0, len(h.series))
+
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := h.series[key]
+
+		for i, upper := range h.buckets {
+			h.sample(buf, h.name+"_bucket", key, formatFloat(upper), float64(s.counts[i]))
+		}
+
+		h.sample(buf, h.name+"_bucket", key, "+Inf", float64(s.count))
+		h.sample(buf, h.name+"_sum", key, "", s.sum)
+		h.sample(buf, h.name+"_count", key, "", float64(s.count))
+	}
+}
+
+func (f *family) header(buf *bytes.Buffer) {
+	_, _ = fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.typ)
+}
+
+//sample writes one series line. Histogram bucket bound is added as le label if set
+func (f *family) sample(buf *bytes.Buffer, name string, key string, le string, v float64) {
+	var pairs []string
+
+	if len(f.labels) > 0 {
+		values := strings.Split(key, labelSeparator)
+
+		for i, label := range f.labels {
+			value := ""
+
+			if i < len(values) {
+				value = values[i]
+			}
+
+			pairs = append(pairs, label+`="`+escapeLabel(value)+`"`)
+		}
+	}
+
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+
+	buf.WriteString(name)
+
+	if len(pairs) > 0 {
+		buf.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+
+	buf.WriteString(" " + formatFloat(v) + "\n")
+}
+
+func seriesKey(values []string) string {
+	return strings.Join(values, labelSeparator)
+}
+
+func sortedKeys(series map[string]float64) []string {
+	keys := make([]string, 0, len(series))
+
+	for key := range series {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
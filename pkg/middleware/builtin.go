@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mnikita/task-queue/pkg/common"
+	"github.com/mnikita/task-queue/pkg/log"
+	"runtime/debug"
+	"time"
+)
+
+//Logging logs task start and execution time
+func Logging() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, task *common.Task) error {
+			log.Logger().TaskStarted(task.Name)
+
+			start := time.Now()
+			err := next(ctx, task)
+
+			log.Logger().TaskFinished(task.Name, time.Since(start))
+
+			return err
+		}
+	}
+}
+
+//Timing reports task execution time and outcome to observe function
+func Timing(observe func(task *common.Task, duration time.Duration, err error)) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, task *common.Task) error {
+			start := time.Now()
+			err := next(ctx, task)
+
+			observe(task, time.Since(start), err)
+
+			return err
+		}
+	}
+}
+
+//Recovery converts panics of inner middlewares into task panic errors.
+//Worker recovers panics too, Recovery is useful to let outer middlewares observe them
+func Recovery() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, task *common.Task) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = common.NewTaskPanicError(task, r, debug.Stack())
+				}
+			}()
+
+			return next(ctx, task)
+		}
+	}
+}
+
+//Authorize fails task rejected by check function without executing it
+func Authorize(check func(ctx context.Context, task *common.Task) error) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, task *common.Task) error {
+			if err := check(ctx, task); err != nil {
+				return log.UnauthorizedTaskError(task.Name, err)
+			}
+
+			return next(ctx, task)
+		}
+	}
+}
+
+//RequireHeaders fails task missing any of the headers without executing it
+func RequireHeaders(keys ...string) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, task *common.Task) error {
+			for _, key := range keys {
+				if _, ok := task.Headers[key]; !ok {
+					return log.MissingTaskHeaderError(task.Name, key)
+				}
+			}
+
+			return next(ctx, task)
+		}
+	}
+}
+
+//TransformPayload replaces task payload before it is unmarshalled by task handler
+func TransformPayload(transform func(task *common.Task, payload json.RawMessage) (json.RawMessage, error)) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, task *common.Task) error {
+			payload, err := transform(task, task.Payload)
+
+			if err != nil {
+				return err
+			}
+
+			task.Payload = payload
+
+			return next(ctx, task)
+		}
+	}
+}
+
+//SkipIf completes task successfully without executing it if predicate matches
+func SkipIf(predicate func(ctx context.Context, task *common.Task) bool) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, task *common.Task) error {
+			if predicate(ctx, task) {
+				log.Logger().TaskSkipped(task.Name)
+
+				return nil
+			}
+
+			return next(ctx, task)
+		}
+	}
+}
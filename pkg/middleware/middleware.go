@@ -0,0 +1,25 @@
+//Package middleware provides primitives for decorating task execution on worker
+package middleware
+
+import (
+	"context"
+	"github.com/mnikita/task-queue/pkg/common"
+)
+
+//Handler executes task. Returned error is reported as task error, nil as task success
+type Handler func(ctx context.Context, task *common.Task) error
+
+//Middleware decorates handler. Middleware may alter the task, observe the outcome
+//or short-circuit execution by not calling next handler
+type Middleware func(next Handler) Handler
+
+//Chain composes middlewares into one. First middleware is the outermost
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next Handler) Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+
+		return next
+	}
+}
@@ -0,0 +1,150 @@
+package middleware_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/mnikita/task-queue/pkg/common"
+	"github.com/mnikita/task-queue/pkg/log"
+	"github.com/mnikita/task-queue/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+//recordHandler returns handler recording executed tasks
+func recordHandler(executed *[]*common.Task) middleware.Handler {
+	return func(_ context.Context, task *common.Task) error {
+		*executed = append(*executed, task)
+
+		return nil
+	}
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+
+	record := func(name string) middleware.Middleware {
+		return func(next middleware.Handler) middleware.Handler {
+			return func(ctx context.Context, task *common.Task) error {
+				calls = append(calls, name+" before")
+				err := next(ctx, task)
+				calls = append(calls, name+" after")
+
+				return err
+			}
+		}
+	}
+
+	var executed []*common.Task
+
+	handler := middleware.Chain(record("outer"), record("inner"))(recordHandler(&executed))
+
+	assert.Nil(t, handler(context.Background(), &common.Task{Name: "add"}))
+	assert.Len(t, executed, 1)
+	assert.Equal(t, []string{"outer before", "inner before", "inner after", "outer after"}, calls)
+
+	assert.Nil(t, middleware.Chain()(recordHandler(&executed))(context.Background(), &common.Task{}))
+	assert.Len(t, executed, 2)
+}
+
+func TestTiming(t *testing.T) {
+	testErr := errors.New("test error")
+
+	var observed error
+
+	handler := middleware.Chain(middleware.Logging(), middleware.Timing(
+		func(task *common.Task, duration time.Duration, err error) {
+			assert.True(t, duration >= time.Millisecond*5)
+
+			observed = err
+		}))(func(_ context.Context, _ *common.Task) error {
+		time.Sleep(time.Millisecond * 5)
+
+		return testErr
+	})
+
+	assert.Equal(t, testErr, handler(context.Background(), &common.Task{Name: "add"}))
+	assert.Equal(t, testErr, observed)
+}
+
+func TestRecovery(t *testing.T) {
+	task := &common.Task{Name: "add"}
+
+	handler := middleware.Recovery()(func(_ context.Context, _ *common.Task) error {
+		panic("test panic")
+	})
+
+	err := handler(context.Background(), task)
+
+	panicErr, ok := err.(*common.TaskThreadError)
+
+	assert.True(t, ok)
+	assert.NotNil(t, panicErr.Stack)
+	assert.Equal(t, task, panicErr.Task)
+}
+
+func TestAuthorize(t *testing.T) {
+	var executed []*common.Task
+
+	denied := errors.New("denied")
+
+	handler := middleware.Authorize(func(_ context.Context, task *common.Task) error {
+		if task.Header("role") != "admin" {
+			return denied
+		}
+
+		return nil
+	})(recordHandler(&executed))
+
+	task := &common.Task{Name: "add"}
+
+	assert.Equal(t, log.UnauthorizedTaskError("add", denied), handler(context.Background(), task))
+	assert.Empty(t, executed)
+
+	task.SetHeader("role", "admin")
+
+	assert.Nil(t, handler(context.Background(), task))
+	assert.Len(t, executed, 1)
+}
+
+func TestRequireHeaders(t *testing.T) {
+	var executed []*common.Task
+
+	handler := middleware.RequireHeaders("tenant", "user")(recordHandler(&executed))
+
+	task := &common.Task{Name: "add", Headers: map[string]string{"tenant": "acme"}}
+
+	assert.Equal(t, log.MissingTaskHeaderError("add", "user"), handler(context.Background(), task))
+	assert.Empty(t, executed)
+
+	task.SetHeader("user", "")
+
+	assert.Nil(t, handler(context.Background(), task))
+	assert.Len(t, executed, 1)
+}
+
+func TestTransformPayload(t *testing.T) {
+	var executed []*common.Task
+
+	handler := middleware.TransformPayload(func(_ *common.Task, payload json.RawMessage) (json.RawMessage, error) {
+		return json.RawMessage(`{"wrapped": ` + string(payload) + `}`), nil
+	})(recordHandler(&executed))
+
+	assert.Nil(t, handler(context.Background(), &common.Task{Name: "add", Payload: json.RawMessage(`1`)}))
+	assert.JSONEq(t, `{"wrapped": 1}`, string(executed[0].Payload))
+}
+
+func TestSkipIf(t *testing.T) {
+	var executed []*common.Task
+
+	handler := middleware.SkipIf(func(_ context.Context, task *common.Task) bool {
+		return task.Name == "skip"
+	})(recordHandler(&executed))
+
+	assert.Nil(t, handler(context.Background(), &common.Task{Name: "skip"}))
+	assert.Empty(t, executed)
+
+	assert.Nil(t, handler(context.Background(), &common.Task{Name: "add"}))
+	assert.Len(t, executed, 1)
+}
@@ -0,0 +1,334 @@
+//go:generate mockgen -destination=./mocks/mock_producer.go -package=mocks . Handler
+//Package producer provides primitives for enqueuing tasks from application code without running workers
+package producer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/google/wire"
+	"github.com/mnikita/task-queue/pkg/common"
+	"github.com/mnikita/task-queue/pkg/connection"
+	"github.com/mnikita/task-queue/pkg/consumer"
+	"github.com/mnikita/task-queue/pkg/log"
+	"os"
+	"time"
+)
+
+var WireSet = wire.NewSet(NewProducer, wire.Bind(new(Handler), new(*Producer)))
+
+type Handler interface {
+	Init() error
+	Close() error
+
+	Config() *Configuration
+
+	//Put enqueues task with payload marshalled to JSON and returns job id
+	Put(taskName string, payload interface{}, options ...PutOption) (id uint64, err error)
+
+	//Call enqueues task and waits for its outcome until context is done.
+	//Task error is returned together with the reply. Context deadline is passed to the worker,
+	//which does not reply after it. Reply to call without deadline which stopped waiting
+	//stays in its reply tube, so calls should be given a deadline
+	Call(ctx context.Context, taskName string, payload interface{}, options ...PutOption) (*common.Reply, error)
+}
+
+const (
+	//Reserve timeout of reply wait loop. Context is checked between reserves
+	CallReserveTimeout = time.Second
+
+	//Length of generated correlation id in bytes
+	correlationIdSize = 16
+)
+
+//Configuration stores producer connection and default put options
+type Configuration struct {
+	Url string
+
+	//Tube, priority, delay and time to run used when not set by put options
+	Tube     string
+	Priority uint32
+	Delay    time.Duration
+	Ttr      time.Duration
+
+	//Rejects task names which are not registered with common.RegisterTask
+	ValidateTaskName bool
+
+	//Prefix of reply tubes created for each call
+	ReplyTubePrefix string
+
+	//Origin host set on put tasks. Defaults to host name
+	Origin string
+}
+
+//PutOption overrides default put options for one call
+type PutOption func(options *putOptions)
+
+type putOptions struct {
+	tube     string
+	priority uint32
+	delay    time.Duration
+	ttr      time.Duration
+
+	headers map[string]string
+	traceId string
+}
+
+type Producer struct {
+	*Configuration
+
+	connection        connection.Handler
+	connectionHandler consumer.ConnectionHandler
+}
+
+func WithTube(tube string) PutOption {
+	return func(options *putOptions) {
+		options.tube = tube
+	}
+}
+
+func WithPriority(priority uint32) PutOption {
+	return func(options *putOptions) {
+		options.priority = priority
+	}
+}
+
+func WithDelay(delay time.Duration) PutOption {
+	return func(options *putOptions) {
+		options.delay = delay
+	}
+}
+
+func WithTtr(ttr time.Duration) PutOption {
+	return func(options *putOptions) {
+		options.ttr = ttr
+	}
+}
+
+//WithHeader sets task header
+func WithHeader(key string, value string) PutOption {
+	return func(options *putOptions) {
+		if options.headers == nil {
+			options.headers = make(map[string]string)
+		}
+
+		options.headers[key] = value
+	}
+}
+
+func WithTraceId(traceId string) PutOption {
+	return func(options *putOptions) {
+		options.traceId = traceId
+	}
+}
+
+func NewConfiguration() *Configuration {
+	origin, _ := os.Hostname()
+
+	return &Configuration{
+		Tube:     "default",
+		Priority: 1024,
+		Ttr:      time.Second * 10,
+
+		ReplyTubePrefix: "reply-",
+		Origin:          origin,
+	}
+}
+
+func NewProducer(config *Configuration, connection connection.Handler,
+	connectionHandler consumer.ConnectionHandler) *Producer {
+	p := &Producer{Configuration: config}
+
+	p.connection = connection
+	p.connectionHandler = connectionHandler
+
+	return p
+}
+
+func (p *Producer) Init() error {
+	if p.Url == "" {
+		return log.MissingCliUrl()
+	}
+
+	p.connection.Config().Url = p.Url
+
+	return p.connection.Init()
+}
+
+func (p *Producer) Close() error {
+	return p.connection.Close()
+}
+
+func (p *Producer) Config() *Configuration {
+	return p.Configuration
+}
+
+func (p *Producer) Put(taskName string, payload interface{}, options ...PutOption) (id uint64, err error) {
+	return p.put(&common.Task{Name: taskName}, payload, options)
+}
+
+func (p *Producer) Call(ctx context.Context, taskName string, payload interface{},
+	options ...PutOption) (*common.Reply, error) {
+	correlationId, err := newCorrelationId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	replyTube := p.ReplyTubePrefix + correlationId
+
+	//reply tube is watched before put so reply is never missed
+	channels, handler, err := p.dialReply(replyTube)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = handler.Close()
+	}()
+
+	task := &common.Task{Name: taskName, ReplyTo: replyTube, CorrelationId: correlationId}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		deadline = deadline.UTC()
+		task.ReplyDeadline = &deadline
+	}
+
+	id, err := p.put(task, payload, options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		reply, err := p.waitReply(ctx, channels, handler, correlationId)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if reply != nil {
+			if reply.Error != "" {
+				return reply, log.RemoteTaskError(taskName, reply.Error)
+			}
+
+			return reply, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, log.CallTimeoutError(taskName, id)
+		default:
+		}
+	}
+}
+
+//put enqueues task with payload marshalled to JSON
+func (p *Producer) put(task *common.Task, payload interface{}, options []PutOption) (id uint64, err error) {
+	if p.ValidateTaskName && !common.IsTaskRegistered(task.Name) {
+		return 0, log.RegisteredTaskHandlerError(task.Name)
+	}
+
+	task.Payload, err = json.Marshal(payload)
+
+	if err != nil {
+		return 0, log.InvalidTaskPayloadError(0, task.Name, err)
+	}
+
+	o := &putOptions{tube: p.Tube, priority: p.Priority, delay: p.Delay, ttr: p.Ttr}
+
+	for _, option := range options {
+		option(o)
+	}
+
+	now := time.Now().UTC()
+
+	task.Headers = o.headers
+	task.TraceId = o.traceId
+	task.EnqueuedAt = &now
+	task.Origin = p.Origin
+	task.Version = common.TaskSchemaVersion
+
+	body, err := json.Marshal(task)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return p.connectionHandler.PutTube(o.tube, body, o.priority, o.delay, o.ttr)
+}
+
+//dialReply opens dedicated connection watching the reply tube.
+//Blocking reserve on shared connection would delay other producer calls
+func (p *Producer) dialReply(replyTube string) (connection.Channels, consumer.ConnectionHandler, error) {
+	addr, err := connection.ParseUrl(p.Url)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dialer := p.connection.Dialer()
+
+	handler, err := dialer.Dial(addr, []string{replyTube})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return dialer.CreateChannels(handler, []string{replyTube}), handler, nil
+}
+
+//waitReply reserves reply once. Nil reply is returned on reserve timeout or reply of other call
+func (p *Producer) waitReply(ctx context.Context, channels connection.Channels, handler consumer.ConnectionHandler,
+	correlationId string) (*common.Reply, error) {
+	timeout := CallReserveTimeout
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining < timeout {
+			timeout = remaining
+		}
+	}
+
+	if timeout < 0 {
+		timeout = 0
+	}
+
+	id, body, err := channels.Reserve(timeout)
+
+	if err != nil {
+		if consumer.IsTimeout(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if err = handler.Delete(id); err != nil {
+		log.Logger().Error(err)
+	}
+
+	reply := &common.Reply{}
+
+	if err = json.Unmarshal(body, reply); err != nil {
+		return nil, err
+	}
+
+	if reply.CorrelationId != correlationId {
+		return nil, nil
+	}
+
+	return reply, nil
+}
+
+//newCorrelationId generates random hex id
+func newCorrelationId() (string, error) {
+	b := make([]byte, correlationIdSize)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
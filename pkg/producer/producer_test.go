@@ -0,0 +1,229 @@
+package producer_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mnikita/task-queue/pkg/common"
+	"github.com/mnikita/task-queue/pkg/consumer"
+	"github.com/mnikita/task-queue/pkg/log"
+	"github.com/mnikita/task-queue/pkg/memory"
+	"github.com/mnikita/task-queue/pkg/producer"
+	"github.com/mnikita/task-queue/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type Mock struct {
+	t *testing.T
+
+	config *producer.Configuration
+	broker *memory.Broker
+	conn   *memory.Conn
+
+	producer producer.Handler
+}
+
+type addPayload struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+func newMock(t *testing.T) *Mock {
+	m := &Mock{}
+	m.t = t
+
+	m.config = producer.NewConfiguration()
+	m.config.Url = "memory://"
+
+	m.broker = memory.NewBroker(memory.NewConfiguration())
+	m.conn = m.broker.Connect()
+
+	m.producer = producer.InitializeMemoryProducer(m.config, m.broker)
+
+	return m
+}
+
+func setupTest(m *Mock) func() {
+	if m == nil {
+		panic("Mock not initialized")
+	}
+
+	assert.Nil(m.t, m.producer.Init())
+
+	// Test teardown - return a closure for use by 'defer'
+	return func() {
+		defer util.AssertPanic(m.t)
+
+		assert.Nil(m.t, m.producer.Close())
+	}
+}
+
+func (m *Mock) reserveTask(tube string) (*common.Task, *consumer.JobStats) {
+	id, body, err := m.conn.ReserveTube(tube, 0)
+
+	assert.Nil(m.t, err)
+
+	task := &common.Task{}
+	assert.Nil(m.t, json.Unmarshal(body, task))
+
+	stats, err := m.conn.StatsJob(id)
+	assert.Nil(m.t, err)
+
+	return task, stats
+}
+
+func TestPut(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	id, err := m.producer.Put("add", &addPayload{A: 1, B: 2})
+
+	assert.Nil(t, err)
+	assert.True(t, id > 0)
+
+	task, stats := m.reserveTask("default")
+
+	assert.Equal(t, "add", task.Name)
+	assert.JSONEq(t, `{"a": 1, "b": 2}`, string(task.Payload))
+	assert.Equal(t, uint32(1024), stats.Priority)
+	assert.Equal(t, 10*time.Second, stats.Ttr)
+	assert.Equal(t, common.TaskSchemaVersion, task.Version)
+	assert.Equal(t, m.config.Origin, task.Origin)
+	assert.NotNil(t, task.EnqueuedAt)
+	assert.Nil(t, task.Headers)
+}
+
+func TestPutHeaders(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	_, err := m.producer.Put("add", nil, producer.WithTraceId("trace-1"),
+		producer.WithHeader("tenant", "acme"), producer.WithHeader("source", "test"))
+
+	assert.Nil(t, err)
+
+	task, _ := m.reserveTask("default")
+
+	assert.Equal(t, "trace-1", task.TraceId)
+	assert.Equal(t, map[string]string{"tenant": "acme", "source": "test"}, task.Headers)
+	assert.Equal(t, "acme", task.Header("tenant"))
+}
+
+func TestPutOptions(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	_, err := m.producer.Put("add", nil, producer.WithTube("math"), producer.WithPriority(5),
+		producer.WithTtr(time.Minute), producer.WithDelay(time.Hour))
+
+	assert.Nil(t, err)
+
+	_, _, err = m.conn.ReserveTube("math", 0)
+	assert.NotNil(t, err, "delayed task reserved")
+
+	n, err := memory.NewTube(m.conn, "math").Kick(1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	task, stats := m.reserveTask("math")
+
+	assert.Equal(t, "null", string(task.Payload))
+	assert.Equal(t, uint32(5), stats.Priority)
+	assert.Equal(t, 60*time.Second, stats.Ttr)
+	assert.Equal(t, time.Hour, stats.Delay)
+}
+
+func TestPutValidateTaskName(t *testing.T) {
+	m := newMock(t)
+	m.config.ValidateTaskName = true
+
+	defer setupTest(m)()
+
+	_, err := m.producer.Put("unknown", nil)
+
+	assert.Equal(t, log.RegisteredTaskHandlerError("unknown"), err)
+}
+
+//serveReply reserves one task and replies to it like a worker would
+func (m *Mock) serveReply(results []interface{}, taskError string) {
+	go func() {
+		id, body, err := m.conn.ReserveTube("default", time.Second)
+
+		if err != nil {
+			return
+		}
+
+		task := &common.Task{}
+		_ = json.Unmarshal(body, task)
+
+		reply := &common.Reply{CorrelationId: task.CorrelationId, JobId: id, Error: taskError}
+
+		for _, r := range results {
+			data, _ := json.Marshal(r)
+			reply.Results = append(reply.Results, data)
+		}
+
+		data, _ := json.Marshal(reply)
+
+		_, _ = m.conn.PutTube(task.ReplyTo, data, 0, 0, time.Minute)
+		_ = m.conn.Delete(id)
+	}()
+}
+
+func TestCall(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	m.serveReply([]interface{}{3}, "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+
+	reply, err := m.producer.Call(ctx, "add", &addPayload{A: 1, B: 2})
+
+	assert.Nil(t, err)
+	assert.NotEmpty(t, reply.CorrelationId)
+	assert.Len(t, reply.Results, 1)
+
+	var sum int
+	assert.Nil(t, json.Unmarshal(reply.Results[0], &sum))
+	assert.Equal(t, 3, sum)
+}
+
+func TestCallRemoteError(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	m.serveReply(nil, "test error")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+
+	reply, err := m.producer.Call(ctx, "add", nil)
+
+	assert.Equal(t, log.RemoteTaskError("add", "test error"), err)
+	assert.Equal(t, "test error", reply.Error)
+}
+
+func TestCallTimeout(t *testing.T) {
+	m := newMock(t)
+	defer setupTest(m)()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	_, err := m.producer.Call(ctx, "add", nil)
+
+	assert.Equal(t, log.CallTimeoutError("add", 1), err)
+
+	//worker is told when caller stops waiting for the reply
+	_, body, err := m.conn.PeekReady("default")
+	assert.Nil(t, err)
+
+	task := &common.Task{}
+	assert.Nil(t, json.Unmarshal(body, task))
+
+	deadline, _ := ctx.Deadline()
+	assert.True(t, deadline.Equal(*task.ReplyDeadline))
+}
@@ -0,0 +1,25 @@
+//Something
+
+//+build wireinject
+
+package producer
+
+import (
+	"github.com/google/wire"
+	"github.com/mnikita/task-queue/pkg/beanstalkd"
+	"github.com/mnikita/task-queue/pkg/connection"
+	"github.com/mnikita/task-queue/pkg/memory"
+)
+
+func InitializeProducer(config *Configuration) *Producer {
+	wire.Build(WireSet, connection.WireSet, beanstalkd.WireSet)
+
+	return &Producer{}
+}
+
+//InitializeMemoryProducer creates producer putting tasks to in-process broker
+func InitializeMemoryProducer(config *Configuration, broker *memory.Broker) *Producer {
+	wire.Build(WireSet, connection.WireSet, memory.WireSet)
+
+	return &Producer{}
+}
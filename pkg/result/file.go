@@ -0,0 +1,145 @@
+package result
+
+import (
+	"encoding/json"
+	"github.com/mnikita/task-queue/pkg/log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const fileExtension = ".json"
+
+//FileStore keeps one JSON file per record in a directory. Records are shared by processes using the directory
+type FileStore struct {
+	mux    sync.Mutex
+	dir    string
+	expiry time.Duration
+}
+
+func NewFileStore(dir string, expiry time.Duration) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &FileStore{dir: dir, expiry: expiry}, nil
+}
+
+func (s *FileStore) path(id uint64) string {
+	return filepath.Join(s.dir, strconv.FormatUint(id, 10)+fileExtension)
+}
+
+func (s *FileStore) read(id uint64) (*Record, error) {
+	data, err := ioutil.ReadFile(s.path(id))
+
+	if os.IsNotExist(err) {
+		return nil, log.ResultNotFoundError(id)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	record := &Record{}
+
+	if err = json.Unmarshal(data, record); err != nil {
+		return nil, log.InvalidResultError(id, err)
+	}
+
+	if record.Expired(time.Now()) {
+		_ = os.Remove(s.path(id))
+
+		return nil, log.ResultNotFoundError(id)
+	}
+
+	return record, nil
+}
+
+func (s *FileStore) Save(record *Record) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	r := *record
+	r.expire(s.expiry)
+
+	data, err := json.Marshal(&r)
+
+	if err != nil {
+		return err
+	}
+
+	//write to temporary file first so readers never see partial record
+	tmp := s.path(record.JobId) + ".tmp"
+
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path(record.JobId))
+}
+
+func (s *FileStore) Get(id uint64) (*Record, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.read(id)
+}
+
+func (s *FileStore) Delete(id uint64) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	err := os.Remove(s.path(id))
+
+	if os.IsNotExist(err) {
+		return log.ResultNotFoundError(id)
+	}
+
+	return err
+}
+
+func (s *FileStore) Query(query *Query) ([]*Record, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	files, err := ioutil.ReadDir(s.dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*Record
+
+	for _, file := range files {
+		name := file.Name()
+
+		if !strings.HasSuffix(name, fileExtension) {
+			continue
+		}
+
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, fileExtension), 10, 64)
+
+		if err != nil {
+			continue
+		}
+
+		record, err := s.read(id)
+
+		if err != nil {
+			//skipping expired and unreadable records
+			continue
+		}
+
+		records = append(records, record)
+	}
+
+	return filter(records, query), nil
+}
+
+func (s *FileStore) Close() error {
+	return nil
+}
@@ -0,0 +1,89 @@
+package result
+
+import (
+	"github.com/mnikita/task-queue/pkg/log"
+	"sync"
+	"time"
+)
+
+//MemoryStore keeps records in process memory
+type MemoryStore struct {
+	mux     sync.Mutex
+	records map[uint64]*Record
+	expiry  time.Duration
+}
+
+func NewMemoryStore(expiry time.Duration) *MemoryStore {
+	return &MemoryStore{records: make(map[uint64]*Record), expiry: expiry}
+}
+
+//purge removes expired records
+func (s *MemoryStore) purge(now time.Time) {
+	for id, r := range s.records {
+		if r.Expired(now) {
+			delete(s.records, id)
+		}
+	}
+}
+
+func (s *MemoryStore) Save(record *Record) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.purge(time.Now())
+
+	r := *record
+	r.expire(s.expiry)
+
+	s.records[record.JobId] = &r
+
+	return nil
+}
+
+func (s *MemoryStore) Get(id uint64) (*Record, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	r, ok := s.records[id]
+
+	if !ok || r.Expired(time.Now()) {
+		return nil, log.ResultNotFoundError(id)
+	}
+
+	record := *r
+
+	return &record, nil
+}
+
+func (s *MemoryStore) Delete(id uint64) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if _, ok := s.records[id]; !ok {
+		return log.ResultNotFoundError(id)
+	}
+
+	delete(s.records, id)
+
+	return nil
+}
+
+func (s *MemoryStore) Query(query *Query) ([]*Record, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.purge(time.Now())
+
+	records := make([]*Record, 0, len(s.records))
+
+	for _, r := range s.records {
+		record := *r
+		records = append(records, &record)
+	}
+
+	return filter(records, query), nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
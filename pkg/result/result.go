@@ -0,0 +1,154 @@
+//go:generate mockgen -destination=./mocks/mock_result.go -package=mocks . Store
+//Package result provides primitives for storing task outcomes reported by workers
+package result
+
+import (
+	"github.com/google/wire"
+	"github.com/mnikita/task-queue/pkg/log"
+	"sort"
+	"time"
+)
+
+var WireSet = wire.NewSet(NewConfiguration)
+
+//Status of the task execution
+type Status string
+
+const (
+	StatusRunning  Status = "running"
+	StatusSuccess  Status = "success"
+	StatusError    Status = "error"
+	StatusReleased Status = "released"
+)
+
+//Store backends
+const (
+	BackendMemory = "memory"
+	BackendFile   = "file"
+)
+
+//Store keeps task results keyed by job id
+type Store interface {
+	//Save creates or replaces record
+	Save(record *Record) error
+	Get(id uint64) (*Record, error)
+	Delete(id uint64) error
+
+	//Query returns unexpired records matching the query ordered by job id
+	Query(query *Query) ([]*Record, error)
+
+	Close() error
+}
+
+//Record stores outcome of a task
+type Record struct {
+	JobId    uint64        `json:"job_id"`
+	TaskName string        `json:"task_name"`
+	Status   Status        `json:"status"`
+	Results  []interface{} `json:"results,omitempty"`
+	Error    string        `json:"error,omitempty"`
+
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+
+	//Record is removed after expiry, set by store on save. Kept until deleted if zero
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+//Query filters records. Empty fields match all records
+type Query struct {
+	Status   Status
+	TaskName string
+
+	//Maximum number of records returned. Unlimited if not set
+	Limit int
+}
+
+//Configuration stores result store backend selection
+type Configuration struct {
+	//Store backend, memory or file. Results are not stored if not set
+	Backend string
+
+	//Directory of file backend
+	Dir string
+
+	//Time records are kept for after task finishes. Kept until deleted if not set
+	Expiry time.Duration
+}
+
+func NewConfiguration() *Configuration {
+	return &Configuration{
+		Dir:    "results",
+		Expiry: time.Hour * 24,
+	}
+}
+
+//NewStore creates store of configured backend. Nil store is returned if backend is not set
+func NewStore(config *Configuration) (Store, error) {
+	switch config.Backend {
+	case "":
+		return nil, nil
+	case BackendMemory:
+		return NewMemoryStore(config.Expiry), nil
+	case BackendFile:
+		store, err := NewFileStore(config.Dir, config.Expiry)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return store, nil
+	}
+
+	return nil, log.UnknownResultBackendError(config.Backend)
+}
+
+//Expired reports whether record expired at given time
+func (r *Record) Expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt)
+}
+
+//expire sets record expiry counting from now
+func (r *Record) expire(expiry time.Duration) {
+	if expiry > 0 {
+		r.ExpiresAt = time.Now().Add(expiry)
+	}
+}
+
+//Duration of the task execution. Zero if task is not finished
+func (r *Record) Duration() time.Duration {
+	if r.FinishedAt.IsZero() {
+		return 0
+	}
+
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+func (q *Query) match(r *Record) bool {
+	if q == nil {
+		return true
+	}
+
+	return (q.Status == "" || q.Status == r.Status) && (q.TaskName == "" || q.TaskName == r.TaskName)
+}
+
+//filter applies query to records and orders them by job id
+func filter(records []*Record, query *Query) []*Record {
+	var matched []*Record
+
+	for _, r := range records {
+		if query.match(r) {
+			matched = append(matched, r)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].JobId < matched[j].JobId
+	})
+
+	if query != nil && query.Limit > 0 && len(matched) > query.Limit {
+		matched = matched[:query.Limit]
+	}
+
+	return matched
+}
@@ -0,0 +1,122 @@
+package result_test
+
+import (
+	"github.com/mnikita/task-queue/pkg/log"
+	"github.com/mnikita/task-queue/pkg/result"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+//newStores creates every store backend with given expiry
+func newStores(t *testing.T, expiry time.Duration) (map[string]result.Store, func()) {
+	dir, err := ioutil.TempDir("", "results")
+	assert.Nil(t, err)
+
+	fileStore, err := result.NewFileStore(dir, expiry)
+	assert.Nil(t, err)
+
+	stores := map[string]result.Store{
+		result.BackendMemory: result.NewMemoryStore(expiry),
+		result.BackendFile:   fileStore,
+	}
+
+	return stores, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestSaveGet(t *testing.T) {
+	stores, cleanup := newStores(t, 0)
+	defer cleanup()
+
+	started := time.Now().UTC().Truncate(time.Second)
+
+	record := &result.Record{JobId: 7, TaskName: "add", Status: result.StatusSuccess,
+		Results: []interface{}{"3"}, StartedAt: started, FinishedAt: started.Add(time.Second)}
+
+	for name, store := range stores {
+		assert.Nil(t, store.Save(record), name)
+
+		r, err := store.Get(7)
+
+		assert.Nil(t, err, name)
+		assert.Equal(t, record, r, name)
+		assert.Equal(t, time.Second, r.Duration(), name)
+
+		assert.Nil(t, store.Delete(7), name)
+
+		_, err = store.Get(7)
+		assert.Equal(t, log.ResultNotFoundError(7), err, name)
+
+		assert.Nil(t, store.Close(), name)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	stores, cleanup := newStores(t, 0)
+	defer cleanup()
+
+	for name, store := range stores {
+		_ = store.Save(&result.Record{JobId: 3, TaskName: "add", Status: result.StatusError})
+		_ = store.Save(&result.Record{JobId: 1, TaskName: "add", Status: result.StatusSuccess})
+		_ = store.Save(&result.Record{JobId: 2, TaskName: "mul", Status: result.StatusSuccess})
+
+		records, err := store.Query(&result.Query{TaskName: "add"})
+		assert.Nil(t, err, name)
+		assert.Len(t, records, 2, name)
+		assert.Equal(t, uint64(1), records[0].JobId, name)
+		assert.Equal(t, uint64(3), records[1].JobId, name)
+
+		records, _ = store.Query(&result.Query{Status: result.StatusSuccess, Limit: 1})
+		assert.Len(t, records, 1, name)
+		assert.Equal(t, uint64(1), records[0].JobId, name)
+
+		records, _ = store.Query(nil)
+		assert.Len(t, records, 3, name)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	stores, cleanup := newStores(t, time.Millisecond*20)
+	defer cleanup()
+
+	for name, store := range stores {
+		assert.Nil(t, store.Save(&result.Record{JobId: 1, Status: result.StatusSuccess}), name)
+
+		r, err := store.Get(1)
+		assert.Nil(t, err, name)
+		assert.False(t, r.ExpiresAt.IsZero(), name)
+	}
+
+	time.Sleep(time.Millisecond * 30)
+
+	for name, store := range stores {
+		_, err := store.Get(1)
+		assert.Equal(t, log.ResultNotFoundError(1), err, name)
+
+		records, _ := store.Query(nil)
+		assert.Empty(t, records, name)
+	}
+}
+
+func TestNewStore(t *testing.T) {
+	config := result.NewConfiguration()
+
+	store, err := result.NewStore(config)
+	assert.Nil(t, err)
+	assert.Nil(t, store)
+
+	config.Backend = result.BackendMemory
+
+	store, err = result.NewStore(config)
+	assert.Nil(t, err)
+	assert.NotNil(t, store)
+
+	config.Backend = "unknown"
+
+	_, err = result.NewStore(config)
+	assert.Equal(t, log.UnknownResultBackendError("unknown"), err)
+}
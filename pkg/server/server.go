@@ -0,0 +1,98 @@
+//Package server provides HTTP server exposing worker endpoints like metrics
+package server
+
+import (
+	"context"
+	"github.com/google/wire"
+	"github.com/mnikita/task-queue/pkg/log"
+	"net"
+	"net/http"
+	"time"
+)
+
+var WireSet = wire.NewSet(NewConfiguration)
+
+//Configuration stores HTTP server listen addresses
+type Configuration struct {
+	//Listen address, e.g. :9090. Server is not started if not set
+	Addr string
+
+	//Listen address of admin server exposing unauthenticated endpoints changing worker state,
+	//e.g. 127.0.0.1:9091. Admin server is not started if not set
+	AdminAddr string
+
+	//Waiting time for requests to complete on close
+	ShutdownTimeout time.Duration
+}
+
+//Server serves registered handlers in background
+type Server struct {
+	*Configuration
+
+	mux      *http.ServeMux
+	server   *http.Server
+	listener net.Listener
+}
+
+func NewConfiguration() *Configuration {
+	return &Configuration{ShutdownTimeout: time.Second * 5}
+}
+
+func NewServer(config *Configuration) *Server {
+	return &Server{Configuration: config, mux: http.NewServeMux()}
+}
+
+//Handle registers handler for the pattern
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+//Start listens on configured address and serves requests in background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.Addr)
+
+	if err != nil {
+		return err
+	}
+
+	s.listener = listener
+	s.server = &http.Server{Handler: s.mux}
+
+	log.Logger().ServerStarted(listener.Addr().String())
+
+	go func(server *http.Server) {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Logger().Error(err)
+		}
+	}(s.server)
+
+	return nil
+}
+
+//ListenAddr returns address server listens on. Empty if server is not started
+func (s *Server) ListenAddr() string {
+	if s.listener == nil {
+		return ""
+	}
+
+	return s.listener.Addr().String()
+}
+
+//Close stops the server waiting for requests in progress to complete
+func (s *Server) Close() error {
+	if s.server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+	defer cancel()
+
+	err := s.server.Shutdown(ctx)
+
+	s.server = nil
+	s.listener = nil
+
+	log.Logger().ServerStopped()
+
+	return err
+}
@@ -0,0 +1,37 @@
+package server_test
+
+import (
+	"github.com/mnikita/task-queue/pkg/server"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	config := server.NewConfiguration()
+	config.Addr = "127.0.0.1:0"
+
+	s := server.NewServer(config)
+	s.Handle("/ping", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("pong"))
+	}))
+
+	assert.Empty(t, s.ListenAddr())
+	assert.Nil(t, s.Start())
+
+	resp, err := http.Get("http://" + s.ListenAddr() + "/ping")
+	assert.Nil(t, err)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "pong", string(body))
+
+	assert.Nil(t, s.Close())
+	assert.Nil(t, s.Close())
+
+	_, err = http.Get("http://127.0.0.1:0/ping")
+	assert.NotNil(t, err)
+}
@@ -1,6 +1,7 @@
 package mocks
 
 import (
+	"context"
 	"errors"
 	"github.com/mnikita/task-queue/pkg/common"
 	"github.com/mnikita/task-queue/pkg/log"
@@ -14,9 +15,13 @@ const (
 	Error
 	Heartbeat
 	Payload
+	Context
+	Panic
 )
 
-var Tasks = []string{"Short", "ShortResult", "Long", "Error", "Heartbeat", "Payload"}
+var Tasks = []string{"Short", "ShortResult", "Long", "Error", "Heartbeat", "Payload", "Context", "Panic"}
+
+var PanicTaskValue = "PanicTask test panic"
 
 var ErrorTaskErr = errors.New("ErrorTask test error")
 
@@ -28,12 +33,12 @@ type TestPayload struct {
 	Laza string `json:"laza"`
 }
 
-func HandleShortTest(_ interface{}, _ *common.Task, _ common.TaskProcessEventHandler) error {
+func HandleShortTest(_ context.Context, _ interface{}, _ *common.Task, _ common.TaskProcessEventHandler) error {
 	time.Sleep(time.Millisecond * 20)
 	return nil
 }
 
-func HandleShortTestWithResult(_ interface{}, task *common.Task,
+func HandleShortTestWithResult(_ context.Context, _ interface{}, task *common.Task,
 	handler common.TaskProcessEventHandler) error {
 	time.Sleep(time.Millisecond * 20)
 
@@ -42,13 +47,13 @@ func HandleShortTestWithResult(_ interface{}, task *common.Task,
 	return nil
 }
 
-func HandleLongTask(_ interface{}, _ *common.Task, _ common.TaskProcessEventHandler) error {
+func HandleLongTask(_ context.Context, _ interface{}, _ *common.Task, _ common.TaskProcessEventHandler) error {
 	time.Sleep(time.Millisecond * 500)
 
 	return nil
 }
 
-func HandleHeartbeatTask(_ interface{}, task *common.Task, eventHandler common.TaskProcessEventHandler) error {
+func HandleHeartbeatTask(_ context.Context, _ interface{}, task *common.Task, eventHandler common.TaskProcessEventHandler) error {
 	time.Sleep(time.Millisecond * 100)
 
 	eventHandler.OnTaskHeartbeat(task)
@@ -58,13 +63,13 @@ func HandleHeartbeatTask(_ interface{}, task *common.Task, eventHandler common.T
 	return nil
 }
 
-func HandleErrorTask(_ interface{}, _ *common.Task, _ common.TaskProcessEventHandler) error {
+func HandleErrorTask(_ context.Context, _ interface{}, _ *common.Task, _ common.TaskProcessEventHandler) error {
 	time.Sleep(time.Millisecond * 10)
 
 	return ErrorTaskErr
 }
 
-func HandlePayloadTask(payload interface{}, _ *common.Task, _ common.TaskProcessEventHandler) error {
+func HandlePayloadTask(_ context.Context, payload interface{}, _ *common.Task, _ common.TaskProcessEventHandler) error {
 	time.Sleep(time.Millisecond * 20)
 
 	log.Logger().Infof("Task with Payload %+v", payload)
@@ -72,6 +77,21 @@ func HandlePayloadTask(payload interface{}, _ *common.Task, _ common.TaskProcess
 	return nil
 }
 
+func HandleContextTask(ctx context.Context, _ interface{}, _ *common.Task, _ common.TaskProcessEventHandler) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Second * 5):
+		return nil
+	}
+}
+
+func HandlePanicTask(_ context.Context, _ interface{}, _ *common.Task, _ common.TaskProcessEventHandler) error {
+	time.Sleep(time.Millisecond * 10)
+
+	panic(PanicTaskValue)
+}
+
 func RegisterTasks() {
 	common.RegisterTask(Tasks[Short], func() common.TaskHandler {
 		return common.NewBaseTaskHandler(HandleShortTest)
@@ -98,4 +118,12 @@ func RegisterTasks() {
 
 		return common.NewBaseTaskHandlerWithPayload(HandlePayloadTask, payload)
 	})
+
+	common.RegisterTask(Tasks[Context], func() common.TaskHandler {
+		return common.NewBaseTaskHandler(HandleContextTask)
+	})
+
+	common.RegisterTask(Tasks[Panic], func() common.TaskHandler {
+		return common.NewBaseTaskHandler(HandlePanicTask)
+	})
 }
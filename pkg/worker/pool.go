@@ -0,0 +1,127 @@
+package worker
+
+import (
+	"github.com/mnikita/task-queue/pkg/common"
+	"github.com/mnikita/task-queue/pkg/log"
+	"sync"
+	"time"
+)
+
+//pool runs tasks assigned to it on own task threads, so they are not starved by other tasks
+type pool struct {
+	name        string
+	concurrency int
+
+	queue chan *common.Task
+	quit  chan bool
+}
+
+func newPool(name string, concurrency int) *pool {
+	return &pool{
+		name:        name,
+		concurrency: concurrency,
+		queue:       make(chan *common.Task, concurrency),
+		quit:        make(chan bool, concurrency),
+	}
+}
+
+//initPools creates configured pools. Error is returned if task is assigned to unknown pool
+func (w *Worker) initPools() error {
+	w.pools = make(map[string]*pool)
+	w.inFlight = make(map[string]int)
+
+	for name, concurrency := range w.Pools {
+		if name == "" || concurrency < 1 {
+			return log.InvalidTaskPoolError(name)
+		}
+
+		w.pools[name] = newPool(name, concurrency)
+	}
+
+	for taskName, name := range w.TaskPools {
+		if _, ok := w.pools[name]; !ok {
+			return log.UnknownTaskPoolError(taskName, name)
+		}
+	}
+
+	return nil
+}
+
+func (w *Worker) closePools() {
+	for _, p := range w.pools {
+		close(p.queue)
+	}
+}
+
+//poolThreads returns number of task threads of all pools
+func (w *Worker) poolThreads() (threads int) {
+	for _, p := range w.pools {
+		threads += p.concurrency
+	}
+
+	return threads
+}
+
+func (w *Worker) startPoolThreads(waitGroup *sync.WaitGroup) {
+	for _, p := range w.pools {
+		for i := 0; i < p.concurrency; i++ {
+			waitGroup.Add(1)
+			go w.handle(waitGroup, p)
+		}
+	}
+}
+
+func (w *Worker) stopPoolThreads() {
+	for _, p := range w.pools {
+		w.releaseQueuedTasks(p.queue)
+
+		for i := 0; i < p.concurrency; i++ {
+			p.quit <- true
+		}
+	}
+}
+
+//RouteTask returns queue of the pool task is assigned to. Tasks of full pool are
+//released with limit release delay instead of blocking the connector
+func (w *Worker) RouteTask(task *common.Task) (queue chan<- *common.Task, releaseDelay time.Duration) {
+	if name, ok := w.TaskPools[task.Name]; ok {
+		if p, ok := w.pools[name]; ok {
+			return p.queue, w.LimitReleaseDelay
+		}
+	}
+
+	return nil, 0
+}
+
+//acquireLimit reports whether task can run without exceeding max in flight limit of its name
+func (w *Worker) acquireLimit(task *common.Task) bool {
+	limit := w.MaxInFlight[task.Name]
+
+	if limit <= 0 {
+		return true
+	}
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.inFlight[task.Name] >= limit {
+		log.Logger().TaskLimitExceeded(task.Name, limit)
+
+		return false
+	}
+
+	w.inFlight[task.Name]++
+
+	return true
+}
+
+func (w *Worker) releaseLimit(task *common.Task) {
+	if w.MaxInFlight[task.Name] <= 0 {
+		return
+	}
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.inFlight[task.Name]--
+}
@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"github.com/mnikita/task-queue/pkg/common"
+	"github.com/mnikita/task-queue/pkg/log"
+	"sort"
+	"time"
+)
+
+//panics counts consecutive panics of task name
+type panics struct {
+	count int
+	last  time.Time
+}
+
+//onTaskPanic counts recovered task panic and reports it as task error
+func (w *Worker) onTaskPanic(task *common.Task, err *common.TaskThreadError) {
+	log.Logger().TaskPanic(task.Name, err, err.Stack)
+
+	w.mux.Lock()
+	p, ok := w.panics[task.Name]
+
+	if !ok {
+		p = &panics{}
+		w.panics[task.Name] = p
+	}
+
+	p.count++
+	p.last = time.Now()
+	w.mux.Unlock()
+
+	w.OnTaskError(task, err)
+}
+
+func (w *Worker) resetPanics(task *common.Task) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	delete(w.panics, task.Name)
+}
+
+//isQuarantined reports whether task name panicked too many times in a row. Expired quarantine
+//lets next task run, and its panic quarantines task name again. Called with mux locked
+func (w *Worker) isQuarantined(taskName string) bool {
+	p, ok := w.panics[taskName]
+
+	if !ok || w.QuarantineAfterPanics <= 0 || p.count < w.QuarantineAfterPanics {
+		return false
+	}
+
+	if w.QuarantineDuration > 0 && time.Since(p.last) >= w.QuarantineDuration {
+		p.count = w.QuarantineAfterPanics - 1
+
+		return false
+	}
+
+	return true
+}
+
+//checkQuarantine returns error if task name panicked too many times in a row
+func (w *Worker) checkQuarantine(task *common.Task) error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.isQuarantined(task.Name) {
+		return log.TaskQuarantinedError(task.Name, w.panics[task.Name].count)
+	}
+
+	return nil
+}
+
+//Quarantined returns task names which are not processed due to repeated panics
+func (w *Worker) Quarantined() []string {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	var names []string
+
+	for name := range w.panics {
+		if w.isQuarantined(name) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+//Unquarantine resumes processing of quarantined task name
+func (w *Worker) Unquarantine(taskName string) {
+	w.resetPanics(&common.Task{Name: taskName})
+}
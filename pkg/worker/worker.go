@@ -1,14 +1,20 @@
-//go:generate mockgen -destination=./mocks/mock_worker.go -package=mocks . Handler,EventHandler
+//go:generate mockgen -destination=./mocks/mock_worker.go -package=mocks . Handler,EventHandler,ScaleEventHandler
 //Package workers provides primitives for configuration and starting worker queues
 package worker
 
 import (
+	"context"
 	"github.com/google/wire"
 	"github.com/mnikita/task-queue/pkg/common"
 	"github.com/mnikita/task-queue/pkg/connector"
+	"github.com/mnikita/task-queue/pkg/health"
 	"github.com/mnikita/task-queue/pkg/log"
+	"github.com/mnikita/task-queue/pkg/metrics"
+	"github.com/mnikita/task-queue/pkg/middleware"
 	"github.com/mnikita/task-queue/pkg/util"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,12 +26,18 @@ type EventHandler interface {
 	OnStartWorker()
 	OnEndWorker()
 
-	//TODO: Remove Pre and Post handlers. It can be solved with decorator
+	//Pre and Post handlers only observe task execution. Use middleware to alter it
 	OnPreTask(task *common.Task)
 	OnPostTask(task *common.Task)
 	OnThreadHeartbeat(threadId int)
 }
 
+//ScaleEventHandler is optionally implemented by EventHandler to be notified of task thread count changes
+type ScaleEventHandler interface {
+	//OnScaleWorker is called after number of task threads is changed
+	OnScaleWorker(threads int)
+}
+
 type Handler interface {
 	Init() error
 	Close() error
@@ -37,6 +49,27 @@ type Handler interface {
 	SetTaskEventHandler(eventHandler common.TaskProcessEventHandler)
 	StartWorker()
 	StopWorker()
+
+	Quarantined() []string
+	Unquarantine(taskName string)
+
+	//Use adds middlewares wrapping execution of all tasks
+	Use(middlewares ...middleware.Middleware)
+
+	//UseForTask adds middlewares wrapping execution of tasks with given name.
+	//Task middlewares run inside global middlewares
+	UseForTask(taskName string, middlewares ...middleware.Middleware)
+
+	//SetMonitor sets health monitor task thread activity is reported to
+	SetMonitor(monitor *health.Monitor)
+
+	//SetMetrics sets metrics thread count changes are recorded to. Metrics are not recorded if not set
+	SetMetrics(metrics *metrics.Metrics)
+
+	//SetConcurrency changes number of task threads. Threads of running worker are
+	//started or stopped, stopped threads finish running task first.
+	//Thread count is left to autoscaling if enabled
+	SetConcurrency(concurrency int)
 }
 
 //TODO: Benchmark tests
@@ -55,6 +88,35 @@ type Worker struct {
 
 	taskQueueCounter int
 	mux              sync.Mutex
+
+	//task threads of running worker, not counting threads asked to quit
+	running   bool
+	threads   int
+	waitGroup sync.WaitGroup
+
+	//quit signals of stopped task threads not sent yet, as quit channel was full
+	pendingQuits int
+
+	//cancelled on worker shutdown to abort running tasks
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	//consecutive panics by task name
+	panics map[string]*panics
+
+	//set on worker shutdown to release tasks which are not started yet
+	draining int32
+
+	middlewares     []middleware.Middleware
+	taskMiddlewares map[string][]middleware.Middleware
+
+	monitor *health.Monitor
+	metrics *metrics.Metrics
+
+	pools map[string]*pool
+
+	//running tasks by name with max in flight limit
+	inFlight map[string]int
 }
 
 //Configuration stores initialization data for worker server
@@ -67,11 +129,64 @@ type Configuration struct {
 
 	//Waiting time to issue heartbeat
 	Heartbeat time.Duration
+
+	//Default task timeout. Job time to run is used if not set and keep alive is disabled
+	TaskTimeout time.Duration
+
+	//Task timeouts by task name
+	TaskTimeouts map[string]time.Duration
+
+	//Fraction of job time to run after which running job is touched. Disabled if not set
+	KeepAlive float64
+
+	//Number of consecutive panics after which task name is quarantined. Disabled if not set
+	QuarantineAfterPanics int
+
+	//Time after last panic quarantine ends. Next task is run then, and quarantine starts
+	//again if it panics. Quarantine lasts until Unquarantine is called if not set
+	QuarantineDuration time.Duration
+
+	//Maximum number of task threads. Enables autoscaling between MinConcurrency and
+	//MaxConcurrency threads instead of fixed Concurrency if set
+	MaxConcurrency int
+
+	//Number of task threads autoscaling starts with and shrinks to. One if not set
+	MinConcurrency int
+
+	//Interval of checking task queue load when autoscaling
+	ScaleInterval time.Duration
+
+	//Number of consecutive idle heartbeats after which task thread is stopped when autoscaling
+	ScaleDownHeartbeats int
+
+	//Number of task threads by pool name. Pools run only tasks assigned to them
+	Pools map[string]int
+
+	//Pool name by task name. Tasks not assigned to a pool run on worker task threads
+	TaskPools map[string]string
+
+	//Maximum number of running tasks by task name. Not limited if not set
+	MaxInFlight map[string]int
+
+	//Delay of releasing job which exceeds max in flight limit or finds its pool full
+	LimitReleaseDelay time.Duration
+}
+
+//UsesJobTtr reports whether running jobs are touched or timed out by job time to run
+func (c *Configuration) UsesJobTtr() bool {
+	return c.KeepAlive > 0 || c.TaskTimeout <= 0
 }
 
-func (w *Worker) handle(wg *sync.WaitGroup) {
+//handle runs tasks of given pool, or of worker task queue if pool is nil
+func (w *Worker) handle(wg *sync.WaitGroup, p *pool) {
 	defer wg.Done()
 
+	queue, quit := w.taskQueue, w.taskQueueQuit
+
+	if p != nil {
+		queue, quit = p.queue, p.quit
+	}
+
 	w.mux.Lock()
 	w.taskQueueCounter++
 	id := w.taskQueueCounter
@@ -80,63 +195,455 @@ func (w *Worker) handle(wg *sync.WaitGroup) {
 	log.Logger().TaskThreadStarted(id)
 	defer log.Logger().TaskThreadEnded(id)
 
+	w.monitor.ThreadStarted(id)
+	defer w.monitor.ThreadEnded(id)
+
+	//consecutive heartbeats without task
+	idle := 0
+
 	for {
 		select {
-		case <-w.taskQueueQuit:
+		case <-quit:
+			if p == nil {
+				w.mux.Lock()
+				w.sendQuits()
+				w.mux.Unlock()
+			}
+
 			return
-		case task := <-w.taskQueue:
-			if task != nil {
-				w.handleTask(id, task)
-			} else {
+		case task := <-queue:
+			if task == nil {
 				return
 			}
+
+			idle = 0
+
+			if w.isDraining() {
+				w.OnTaskRelease(task, 0)
+			} else if !w.acquireLimit(task) {
+				w.OnTaskRelease(task, w.LimitReleaseDelay)
+			} else {
+				w.monitor.ThreadActive(id, true)
+				w.handleTask(id, task)
+				w.monitor.ThreadActive(id, false)
+
+				w.releaseLimit(task)
+			}
 		case <-time.After(w.Heartbeat):
+			w.monitor.ThreadActive(id, false)
+
 			w.OnThreadHeartbeat(id)
+
+			idle++
+
+			if p == nil && w.autoscaling() && idle >= w.ScaleDownHeartbeats && w.shrink() {
+				return
+			}
+		}
+	}
+}
+
+func (w *Worker) isDraining() bool {
+	return atomic.LoadInt32(&w.draining) == 1
+}
+
+//releaseQueuedTasks releases tasks accepted by worker that are not picked by task threads
+func (w *Worker) releaseQueuedTasks(queue chan *common.Task) {
+	for {
+		select {
+		case task := <-queue:
+			if task != nil {
+				w.OnTaskRelease(task, 0)
+			}
+		default:
+			return
 		}
 	}
 }
 
 func (w *Worker) handleTask(threadId int, task *common.Task) {
-	taskHandler, err := common.GetRegisteredTaskHandler(task)
+	//recover panics raised outside of task handler, e.g. in task constructor
+	defer func() {
+		if r := recover(); r != nil {
+			w.onTaskPanic(task, common.NewTaskPanicError(task, r, debug.Stack()))
+		}
+	}()
 
-	if err != nil {
+	if err := w.checkQuarantine(task); err != nil {
+		w.OnTaskError(task, common.NewTaskThreadError(task, err))
+
+		return
+	}
+
+	ctx := common.ContextWithTask(w.ctx, task)
+
+	err := w.chain(task.Name)(w.run(threadId))(ctx, task)
+
+	if panicErr, ok := err.(*common.TaskThreadError); ok && panicErr.Stack != nil {
+		w.onTaskPanic(task, panicErr)
+	} else if err != nil {
 		w.OnTaskError(task, common.NewTaskThreadError(task, err))
 	} else {
+		w.resetPanics(task)
+
+		w.OnTaskSuccess(task)
+	}
+}
+
+//chain returns global and task middlewares composed
+func (w *Worker) chain(taskName string) middleware.Middleware {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	middlewares := make([]middleware.Middleware, 0, len(w.middlewares)+len(w.taskMiddlewares[taskName]))
+	middlewares = append(middlewares, w.middlewares...)
+	middlewares = append(middlewares, w.taskMiddlewares[taskName]...)
+
+	return middleware.Chain(middlewares...)
+}
+
+//run returns innermost handler executing registered task handler.
+//Task handler is created inside middlewares so they can transform the payload
+func (w *Worker) run(threadId int) middleware.Handler {
+	return func(ctx context.Context, task *common.Task) error {
+		taskHandler, err := common.GetRegisteredTaskHandler(task)
+
+		if err != nil {
+			return err
+		}
+
 		w.OnPreTask(task, threadId)
 
-		taskHandler.SetTaskProcessEventHandler(w)
+		events := &execution{worker: w}
+
+		taskHandler.SetTaskProcessEventHandler(events)
 		taskHandler.SetTask(task)
 
-		err = taskHandler.Handle()
+		err = w.execute(ctx, task, taskHandler)
+
+		events.finish()
 
 		if err != nil {
-			w.OnTaskError(task, common.NewTaskThreadError(task, err))
+			return err
+		}
+
+		w.OnPostTask(task, threadId)
+
+		return nil
+	}
+}
+
+//taskTimeout returns task timeout configured by task name, default timeout or job time to run
+func (w *Worker) taskTimeout(task *common.Task) time.Duration {
+	if timeout, ok := w.TaskTimeouts[task.Name]; ok {
+		return timeout
+	}
+
+	if w.TaskTimeout > 0 {
+		return w.TaskTimeout
+	}
+
+	//touched jobs may run longer than time to run
+	if w.KeepAlive > 0 {
+		return 0
+	}
+
+	return task.Ttr
+}
+
+//keepAliveInterval returns interval of touching running job. Zero if job should not be touched
+func (w *Worker) keepAliveInterval(task *common.Task) time.Duration {
+	if w.KeepAlive <= 0 || task.Ttr <= 0 {
+		return 0
+	}
+
+	return time.Duration(float64(task.Ttr) * w.KeepAlive)
+}
+
+//execution forwards task events of one task handler run. Events sent by handler
+//abandoned on timeout or cancellation are dropped once execute returns
+type execution struct {
+	mux  sync.Mutex
+	done bool
+
+	worker *Worker
+}
+
+//finish drops events sent after it returns
+func (e *execution) finish() {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	e.done = true
+}
+
+//forward runs event handler unless execution is finished
+func (e *execution) forward(event func()) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	if !e.done {
+		event()
+	}
+}
+
+func (e *execution) OnTaskSuccess(task *common.Task) {
+	e.forward(func() { e.worker.OnTaskSuccess(task) })
+}
+
+func (e *execution) OnTaskHeartbeat(task *common.Task) {
+	e.forward(func() { e.worker.OnTaskHeartbeat(task) })
+}
+
+func (e *execution) OnTaskError(task *common.Task, err error) {
+	e.forward(func() { e.worker.OnTaskError(task, err) })
+}
+
+func (e *execution) OnTaskRelease(task *common.Task, delay time.Duration) {
+	e.forward(func() { e.worker.OnTaskRelease(task, delay) })
+}
+
+func (e *execution) OnTaskResult(task *common.Task, a ...interface{}) {
+	e.forward(func() { e.worker.OnTaskResult(task, a...) })
+}
+
+//execute runs task handler with context cancelled on timeout or worker shutdown.
+//Task thread is released on cancellation even if task handler ignores the context.
+//Such handler keeps running in leaked goroutine until it returns, its events are dropped
+func (w *Worker) execute(ctx context.Context, task *common.Task, taskHandler common.TaskHandler) error {
+	timeout := w.taskTimeout(task)
+
+	var cancel context.CancelFunc
+
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	defer cancel()
+
+	done := make(chan error, 1)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- common.NewTaskPanicError(task, r, debug.Stack())
+			}
+		}()
+
+		if h, ok := taskHandler.(common.ContextTaskHandler); ok {
+			done <- h.HandleContext(ctx)
 		} else {
-			w.OnPostTask(task, threadId)
+			done <- taskHandler.Handle()
+		}
+	}()
+
+	var keepAlive <-chan time.Time
 
-			w.OnTaskSuccess(task)
+	if interval := w.keepAliveInterval(task); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		keepAlive = ticker.C
+	}
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil && ctx.Err() != nil {
+				return w.contextError(task, ctx, timeout)
+			}
+
+			return err
+		case <-ctx.Done():
+			return w.contextError(task, ctx, timeout)
+		case <-keepAlive:
+			w.OnTaskHeartbeat(task)
 		}
 	}
 }
 
-func (w *Worker) startTaskThreads(waitGroup *sync.WaitGroup) {
-	for i := 0; i < w.Concurrency; i++ {
+func (w *Worker) contextError(task *common.Task, ctx context.Context, timeout time.Duration) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return log.TaskTimeoutError(task.Name, timeout)
+	}
+
+	return log.TaskCanceledError(task.Name)
+}
+
+//startTaskThreads starts task threads. Called with mux locked
+func (w *Worker) startTaskThreads(waitGroup *sync.WaitGroup, count int) {
+	w.threads += count
+
+	for i := 0; i < count; i++ {
 		waitGroup.Add(1)
-		go w.handle(waitGroup)
+		go w.handle(waitGroup, nil)
+	}
+}
+
+//resize starts or stops task threads to match count. Called with mux locked
+func (w *Worker) resize(count int) {
+	if count < w.threads {
+		w.pendingQuits += w.threads - count
+		w.threads = count
+
+		w.sendQuits()
+
+		return
+	}
+
+	n := count - w.threads
+
+	//threads asked to quit are kept instead of starting new ones
+	for ; n > 0; n-- {
+		if w.pendingQuits > 0 {
+			w.pendingQuits--
+		} else if !w.takeQuit() {
+			break
+		}
+
+		w.threads++
+	}
+
+	w.startTaskThreads(&w.waitGroup, n)
+}
+
+//takeQuit takes back quit signal not picked up by any thread yet
+func (w *Worker) takeQuit() bool {
+	select {
+	case <-w.taskQueueQuit:
+		return true
+	default:
+		return false
+	}
+}
+
+//sendQuits sends pending quit signals while quit channel has room. Busy threads pick them up
+//after running task, and rest of signals is sent when they do. Called with mux locked
+func (w *Worker) sendQuits() {
+	for ; w.pendingQuits > 0; w.pendingQuits-- {
+		select {
+		case w.taskQueueQuit <- true:
+		default:
+			return
+		}
+	}
+}
+
+func (w *Worker) autoscaling() bool {
+	return w.MaxConcurrency > 0
+}
+
+func (w *Worker) minConcurrency() int {
+	if w.MinConcurrency < 1 {
+		return 1
+	}
+
+	return w.MinConcurrency
+}
+
+//autoscale adds task thread when task queue stays full or tasks are not accepted in time
+func (w *Worker) autoscale(ctx context.Context) {
+	ticker := time.NewTicker(w.ScaleInterval)
+	defer ticker.Stop()
+
+	full := false
+	timeouts := w.connectorHandler.AcceptTimeouts()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		wasFull := full
+		full = len(w.taskQueue) == cap(w.taskQueue)
+
+		acceptTimeouts := w.connectorHandler.AcceptTimeouts()
+
+		if (full && wasFull) || acceptTimeouts > timeouts {
+			w.grow()
+		}
+
+		timeouts = acceptTimeouts
+	}
+}
+
+//grow adds task thread unless maximum is reached
+func (w *Worker) grow() {
+	w.mux.Lock()
+
+	previous := w.threads
+	grow := w.running && previous < w.MaxConcurrency
+
+	if grow {
+		w.resize(previous + 1)
+	}
+
+	w.mux.Unlock()
+
+	if grow {
+		w.OnScaleWorker(previous, previous+1)
 	}
 }
 
+//shrink reports whether idle task thread should stop. Thread count is kept at minimum
+func (w *Worker) shrink() bool {
+	w.mux.Lock()
+
+	previous := w.threads
+	shrink := w.running && previous > w.minConcurrency()
+
+	if shrink {
+		w.threads--
+	}
+
+	w.mux.Unlock()
+
+	if shrink {
+		w.OnScaleWorker(previous, previous-1)
+	}
+
+	return shrink
+}
+
 func (w *Worker) stopTaskThreads(waitGroup *sync.WaitGroup) {
-	log.Logger().TaskThreadsStopping(w.Concurrency)
+	w.mux.Lock()
+	w.running = false
+	concurrency := w.threads
+	quits := concurrency + w.pendingQuits
+	w.pendingQuits = 0
+	w.mux.Unlock()
+
+	log.Logger().TaskThreadsStopping(concurrency)
+
+	defer w.cancel()
 
-	for i := 0; i < w.Concurrency; i++ {
+	//tasks not started yet are released back to the queue, running tasks are left to finish
+	atomic.StoreInt32(&w.draining, 1)
+	w.releaseQueuedTasks(w.taskQueue)
+
+	for i := 0; i < quits; i++ {
 		w.taskQueueQuit <- true
 	}
 
+	w.stopPoolThreads()
+
 	err := util.WaitTimeout(waitGroup, w.WaitTaskThreadsToClose)
 
 	if err != nil {
 		log.Logger().Error(err)
+
+		//abort running tasks and wait for task threads to report cancellation
+		w.cancel()
+
+		err = util.WaitTimeout(waitGroup, w.WaitTaskThreadsToClose)
+
+		if err != nil {
+			log.Logger().Error(err)
+		}
 	}
 }
 
@@ -146,6 +653,11 @@ func NewConfiguration() *Configuration {
 		Concurrency:            util.GetSystemConcurrency(),
 		Heartbeat:              time.Second * 5,
 		WaitTaskThreadsToClose: time.Second * 30,
+		KeepAlive:              0.5,
+		ScaleInterval:          time.Second,
+		ScaleDownHeartbeats:    3,
+		LimitReleaseDelay:      time.Second,
+		QuarantineDuration:     time.Minute * 5,
 	}
 }
 
@@ -154,6 +666,8 @@ func NewWorker(config *Configuration, connectorHandler connector.Handler) *Worke
 	w := &Worker{Configuration: config}
 
 	w.connectorHandler = connectorHandler
+	w.panics = make(map[string]*panics)
+	w.taskMiddlewares = make(map[string][]middleware.Middleware)
 
 	w.SetTaskEventHandler(connectorHandler.(common.TaskProcessEventHandler))
 
@@ -166,13 +680,19 @@ func (w *Worker) Init() error {
 	w.taskQueueQuit = make(chan bool, w.Concurrency)
 	w.taskQueue = make(chan *common.Task, w.Concurrency)
 
+	if err := w.initPools(); err != nil {
+		return err
+	}
+
 	w.connectorHandler.SetTaskQueueChannel(w.taskQueue)
+	w.connectorHandler.SetTaskRouter(w)
 
 	return nil
 }
 
 func (w *Worker) Close() error {
 	close(w.taskQueue)
+	w.closePools()
 	close(w.quit)
 
 	return nil
@@ -196,16 +716,75 @@ func (w *Worker) SetTaskEventHandler(eventHandler common.TaskProcessEventHandler
 	w.taskEventHandler = eventHandler
 }
 
+func (w *Worker) Use(middlewares ...middleware.Middleware) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.middlewares = append(w.middlewares, middlewares...)
+}
+
+func (w *Worker) UseForTask(taskName string, middlewares ...middleware.Middleware) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.taskMiddlewares[taskName] = append(w.taskMiddlewares[taskName], middlewares...)
+}
+
+func (w *Worker) SetMonitor(monitor *health.Monitor) {
+	w.monitor = monitor
+}
+
+func (w *Worker) SetMetrics(metrics *metrics.Metrics) {
+	w.metrics = metrics
+}
+
+func (w *Worker) SetConcurrency(concurrency int) {
+	w.mux.Lock()
+
+	previous := w.threads
+	w.Concurrency = concurrency
+
+	resize := w.running && !w.autoscaling() && previous != concurrency
+
+	if resize {
+		w.resize(concurrency)
+	}
+
+	w.mux.Unlock()
+
+	if resize {
+		w.OnScaleWorker(previous, concurrency)
+	}
+}
+
 //StartWorker starts workers server
 func (w *Worker) StartWorker() {
 	w.OnStartWorker()
 
-	var waitGroup sync.WaitGroup
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	atomic.StoreInt32(&w.draining, 0)
+
+	concurrency := w.Concurrency
 
-	w.startTaskThreads(&waitGroup)
+	if w.autoscaling() {
+		concurrency = w.minConcurrency()
+
+		go w.autoscale(w.ctx)
+	}
+
+	w.mux.Lock()
+	w.running = true
+	w.threads = 0
+	w.monitor.WorkerStarted(concurrency + w.poolThreads())
+	w.metrics.WorkerThreads(concurrency)
+	w.startTaskThreads(&w.waitGroup, concurrency)
+	w.startPoolThreads(&w.waitGroup)
+	w.mux.Unlock()
 
 	go func(wg *sync.WaitGroup) {
 		<-w.quit
+		w.monitor.WorkerStopped()
+		w.metrics.WorkerThreads(0)
 		w.stopTaskThreads(wg)
 
 		w.quit <- true
@@ -213,7 +792,7 @@ func (w *Worker) StartWorker() {
 		w.OnEndWorker()
 
 		return
-	}(&waitGroup)
+	}(&w.waitGroup)
 }
 
 //StopWorker stops workers server
@@ -267,11 +846,25 @@ func (w *Worker) OnThreadHeartbeat(threadId int) {
 	}
 }
 
+func (w *Worker) OnScaleWorker(previous int, threads int) {
+	log.Logger().WorkerConcurrency(previous, threads)
+
+	w.monitor.WorkerScaled(threads + w.poolThreads())
+	w.metrics.WorkerScaled(previous, threads)
+
+	if h, ok := w.eventHandler.(ScaleEventHandler); ok && !util.IsNil(h) {
+		h.OnScaleWorker(threads)
+	}
+}
+
 func (w *Worker) OnTaskResult(task *common.Task, a ...interface{}) {
 	log.Logger().TaskResult(task.Name, a)
 
+	//collected for reply to the caller
+	task.Results = append(task.Results, a...)
+
 	if !util.IsNil(w.taskEventHandler) {
-		w.taskEventHandler.OnTaskResult(task, a)
+		w.taskEventHandler.OnTaskResult(task, a...)
 	}
 }
 
@@ -291,6 +884,14 @@ func (w *Worker) OnTaskHeartbeat(task *common.Task) {
 	}
 }
 
+func (w *Worker) OnTaskRelease(task *common.Task, delay time.Duration) {
+	log.Logger().TaskRelease(task.Name, delay)
+
+	if !util.IsNil(w.taskEventHandler) {
+		w.taskEventHandler.OnTaskRelease(task, delay)
+	}
+}
+
 func (w *Worker) OnTaskError(task *common.Task, err error) {
 	log.Logger().Error(err)
 
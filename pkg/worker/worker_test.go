@@ -1,20 +1,29 @@
 package worker_test
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/golang/mock/gomock"
 	"github.com/mnikita/task-queue/pkg/common"
 	cmocks "github.com/mnikita/task-queue/pkg/common/mocks"
 	"github.com/mnikita/task-queue/pkg/connector"
 	"github.com/mnikita/task-queue/pkg/log"
+	"github.com/mnikita/task-queue/pkg/middleware"
 	"github.com/mnikita/task-queue/pkg/util"
 	"github.com/mnikita/task-queue/pkg/worker"
 	wmocks "github.com/mnikita/task-queue/pkg/worker/mocks"
+	"github.com/stretchr/testify/assert"
 	"os"
 	"testing"
 	"time"
 )
 
+//workerEventHandler is worker event handler notified of scaling
+type workerEventHandler struct {
+	*wmocks.MockEventHandler
+	*wmocks.MockScaleEventHandler
+}
+
 type Mock struct {
 	t *testing.T
 
@@ -23,6 +32,7 @@ type Mock struct {
 	ctrl *gomock.Controller
 
 	workerEh      *wmocks.MockEventHandler
+	scaleEh       *wmocks.MockScaleEventHandler
 	taskQueueEh   *cmocks.MockTaskQueueEventHandler
 	taskProcessEh *cmocks.MockTaskProcessEventHandler
 
@@ -47,6 +57,7 @@ func newMock(t *testing.T) *Mock {
 	m.ctrl = gomock.NewController(t)
 
 	m.workerEh = wmocks.NewMockEventHandler(m.ctrl)
+	m.scaleEh = wmocks.NewMockScaleEventHandler(m.ctrl)
 	m.taskQueueEh = cmocks.NewMockTaskQueueEventHandler(m.ctrl)
 	m.taskProcessEh = cmocks.NewMockTaskProcessEventHandler(m.ctrl)
 
@@ -60,7 +71,7 @@ func newMock(t *testing.T) *Mock {
 
 	m.connector.SetEventHandler(m.taskQueueEh)
 
-	m.worker.SetEventHandler(m.workerEh)
+	m.worker.SetEventHandler(&workerEventHandler{m.workerEh, m.scaleEh})
 	m.worker.SetTaskEventHandler(m.taskProcessEh)
 
 	m.TaskPayloadHandler = m.connector.(common.TaskPayloadHandler)
@@ -93,6 +104,9 @@ func setupTest(m *Mock) func() {
 		defer m.ctrl.Finish()
 		defer util.AssertPanic(m.t)
 
+		//wait for queued tasks to be picked by task threads, worker stop releases the rest
+		time.Sleep(time.Millisecond * 10)
+
 		m.worker.StopWorker()
 
 		//wait for threads to clean up
@@ -127,27 +141,45 @@ func TestHandleTask(t *testing.T) {
 	m.HandlePayload(shortTask)
 }
 
+type taskNameMatcher string
+
+//taskNamed matches task by name. Connector stamps every handed over task,
+//so each payload is given its own task instead of sharing expected one
+func taskNamed(name string) gomock.Matcher {
+	return taskNameMatcher(name)
+}
+
+func (n taskNameMatcher) Matches(x interface{}) bool {
+	task, ok := x.(*common.Task)
+
+	return ok && task.Name == string(n)
+}
+
+func (n taskNameMatcher) String() string {
+	return "is task named " + string(n)
+}
+
 func TestHandleMultipleTask(t *testing.T) {
 	m := newMock(t)
 	defer setupTest(m)()
 
-	shortTask := &common.Task{Name: wmocks.Tasks[wmocks.Short]}
-	longTask := &common.Task{Name: wmocks.Tasks[wmocks.Long]}
+	short := wmocks.Tasks[wmocks.Short]
+	long := wmocks.Tasks[wmocks.Long]
 
-	m.workerEh.EXPECT().OnPreTask(shortTask).Times(5)
-	m.workerEh.EXPECT().OnPreTask(longTask).Times(5)
-	m.workerEh.EXPECT().OnPostTask(shortTask).Times(5)
-	m.workerEh.EXPECT().OnPostTask(longTask).Times(5)
+	m.workerEh.EXPECT().OnPreTask(taskNamed(short)).Times(5)
+	m.workerEh.EXPECT().OnPreTask(taskNamed(long)).Times(5)
+	m.workerEh.EXPECT().OnPostTask(taskNamed(short)).Times(5)
+	m.workerEh.EXPECT().OnPostTask(taskNamed(long)).Times(5)
 
-	m.taskQueueEh.EXPECT().OnTaskQueued(shortTask).Times(5)
-	m.taskQueueEh.EXPECT().OnTaskQueued(longTask).Times(5)
+	m.taskQueueEh.EXPECT().OnTaskQueued(taskNamed(short)).Times(5)
+	m.taskQueueEh.EXPECT().OnTaskQueued(taskNamed(long)).Times(5)
 
-	m.taskProcessEh.EXPECT().OnTaskSuccess(shortTask).Times(5)
-	m.taskProcessEh.EXPECT().OnTaskSuccess(longTask).Times(5)
+	m.taskProcessEh.EXPECT().OnTaskSuccess(taskNamed(short)).Times(5)
+	m.taskProcessEh.EXPECT().OnTaskSuccess(taskNamed(long)).Times(5)
 
 	for i := 0; i < 5; i++ {
-		m.HandlePayload(shortTask)
-		m.HandlePayload(longTask)
+		m.HandlePayload(&common.Task{Name: short})
+		m.HandlePayload(&common.Task{Name: long})
 	}
 
 	time.Sleep(time.Second)
@@ -221,28 +253,28 @@ func TestTaskThreadError(t *testing.T) {
 
 	defer setupTest(m)()
 
-	shortTask := &common.Task{Name: wmocks.Tasks[wmocks.Short]}
-	longTask := &common.Task{Name: wmocks.Tasks[wmocks.Long]}
-	errorTask := &common.Task{Name: wmocks.Tasks[wmocks.Error]}
+	short := wmocks.Tasks[wmocks.Short]
+	long := wmocks.Tasks[wmocks.Long]
+	errorName := wmocks.Tasks[wmocks.Error]
 
-	m.workerEh.EXPECT().OnPreTask(shortTask).Times(1)
-	m.workerEh.EXPECT().OnPreTask(longTask).Times(1)
-	m.workerEh.EXPECT().OnPreTask(errorTask).Times(1)
-	m.workerEh.EXPECT().OnPostTask(shortTask).Times(1)
-	m.workerEh.EXPECT().OnPostTask(longTask).Times(1)
+	m.workerEh.EXPECT().OnPreTask(taskNamed(short)).Times(1)
+	m.workerEh.EXPECT().OnPreTask(taskNamed(long)).Times(1)
+	m.workerEh.EXPECT().OnPreTask(taskNamed(errorName)).Times(1)
+	m.workerEh.EXPECT().OnPostTask(taskNamed(short)).Times(1)
+	m.workerEh.EXPECT().OnPostTask(taskNamed(long)).Times(1)
 
-	m.taskQueueEh.EXPECT().OnTaskQueued(shortTask).Times(1)
-	m.taskQueueEh.EXPECT().OnTaskQueued(longTask).Times(1)
-	m.taskQueueEh.EXPECT().OnTaskQueued(errorTask).Times(1)
+	m.taskQueueEh.EXPECT().OnTaskQueued(taskNamed(short)).Times(1)
+	m.taskQueueEh.EXPECT().OnTaskQueued(taskNamed(long)).Times(1)
+	m.taskQueueEh.EXPECT().OnTaskQueued(taskNamed(errorName)).Times(1)
 
-	m.taskProcessEh.EXPECT().OnTaskSuccess(shortTask).Times(1)
-	m.taskProcessEh.EXPECT().OnTaskSuccess(longTask).Times(1)
-	m.taskProcessEh.EXPECT().OnTaskError(errorTask, util.ErrEq(
-		log.TaskThreadError(errorTask.Name, wmocks.ErrorTaskErr))).Times(1)
+	m.taskProcessEh.EXPECT().OnTaskSuccess(taskNamed(short)).Times(1)
+	m.taskProcessEh.EXPECT().OnTaskSuccess(taskNamed(long)).Times(1)
+	m.taskProcessEh.EXPECT().OnTaskError(taskNamed(errorName), util.ErrEq(
+		log.TaskThreadError(errorName, wmocks.ErrorTaskErr))).Times(1)
 
-	m.HandlePayload(longTask)
-	m.HandlePayload(errorTask)
-	m.HandlePayload(shortTask)
+	m.HandlePayload(&common.Task{Name: long})
+	m.HandlePayload(&common.Task{Name: errorName})
+	m.HandlePayload(&common.Task{Name: short})
 
 	time.Sleep(time.Millisecond * 200)
 }
@@ -274,8 +306,7 @@ func TestTaskResult(t *testing.T) {
 	m.taskQueueEh.EXPECT().OnTaskQueued(shortTask)
 
 	m.taskProcessEh.EXPECT().OnTaskSuccess(shortTask)
-	m.taskProcessEh.EXPECT().OnTaskResult(shortTask,
-		gomock.Eq([]interface{}{wmocks.ShortTaskResult}))
+	m.taskProcessEh.EXPECT().OnTaskResult(shortTask, wmocks.ShortTaskResult)
 
 	m.HandlePayload(shortTask)
 }
@@ -313,3 +344,480 @@ func TestHandleTaskWithPayload(t *testing.T) {
 
 	m.HandlePayload(shortTask)
 }
+
+func TestTaskTimeout(t *testing.T) {
+	m := newMock(t)
+	m.wc.TaskTimeouts = map[string]time.Duration{wmocks.Tasks[wmocks.Long]: time.Millisecond * 50}
+
+	defer setupTest(m)()
+
+	longTask := &common.Task{Name: wmocks.Tasks[wmocks.Long]}
+
+	m.workerEh.EXPECT().OnPreTask(longTask)
+
+	m.taskQueueEh.EXPECT().OnTaskQueued(longTask)
+
+	m.taskProcessEh.EXPECT().OnTaskError(longTask, util.ErrEq(
+		log.TaskThreadError(longTask.Name, log.TaskTimeoutError(longTask.Name, time.Millisecond*50))))
+
+	m.HandlePayload(longTask)
+
+	time.Sleep(time.Millisecond * 100)
+}
+
+func TestTaskEventsDroppedAfterTimeout(t *testing.T) {
+	m := newMock(t)
+	m.wc.TaskTimeouts = map[string]time.Duration{wmocks.Tasks[wmocks.Heartbeat]: time.Millisecond * 50}
+
+	defer setupTest(m)()
+
+	heartbeatTask := &common.Task{Name: wmocks.Tasks[wmocks.Heartbeat]}
+
+	m.workerEh.EXPECT().OnPreTask(heartbeatTask)
+
+	m.taskQueueEh.EXPECT().OnTaskQueued(heartbeatTask)
+
+	//heartbeat sent by abandoned task handler is not forwarded
+	m.taskProcessEh.EXPECT().OnTaskError(heartbeatTask, util.ErrEq(
+		log.TaskThreadError(heartbeatTask.Name, log.TaskTimeoutError(heartbeatTask.Name, time.Millisecond*50))))
+
+	m.HandlePayload(heartbeatTask)
+
+	time.Sleep(time.Millisecond * 250)
+}
+
+func TestTaskTtrTimeout(t *testing.T) {
+	m := newMock(t)
+	m.wc.KeepAlive = 0
+
+	defer setupTest(m)()
+
+	contextTask := &common.Task{Name: wmocks.Tasks[wmocks.Context], Ttr: time.Millisecond * 20}
+
+	m.workerEh.EXPECT().OnPreTask(contextTask)
+
+	m.taskQueueEh.EXPECT().OnTaskQueued(contextTask)
+
+	m.taskProcessEh.EXPECT().OnTaskError(contextTask, util.ErrEq(
+		log.TaskThreadError(contextTask.Name, log.TaskTimeoutError(contextTask.Name, contextTask.Ttr))))
+
+	m.HandlePayload(contextTask)
+
+	time.Sleep(time.Millisecond * 50)
+}
+
+func TestTaskCanceledOnStop(t *testing.T) {
+	m := newMock(t)
+	m.wc.WaitTaskThreadsToClose = time.Millisecond * 50
+
+	defer setupTest(m)()
+
+	contextTask := &common.Task{Name: wmocks.Tasks[wmocks.Context]}
+
+	m.workerEh.EXPECT().OnPreTask(contextTask)
+
+	m.taskQueueEh.EXPECT().OnTaskQueued(contextTask)
+
+	//context task runs until worker stop times out
+	m.taskProcessEh.EXPECT().OnTaskError(contextTask, util.ErrEq(
+		log.TaskThreadError(contextTask.Name, log.TaskCanceledError(contextTask.Name))))
+
+	m.HandlePayload(contextTask)
+
+	time.Sleep(time.Millisecond * 20)
+}
+
+func TestReleaseQueuedTasksOnStop(t *testing.T) {
+	m := newMock(t)
+	m.wc.Concurrency = 1
+
+	defer setupTest(m)()
+
+	longTask := &common.Task{Name: wmocks.Tasks[wmocks.Long]}
+	shortTask := &common.Task{Name: wmocks.Tasks[wmocks.Short]}
+
+	m.workerEh.EXPECT().OnPreTask(longTask)
+	m.workerEh.EXPECT().OnPostTask(longTask)
+
+	m.taskQueueEh.EXPECT().OnTaskQueued(longTask)
+	m.taskQueueEh.EXPECT().OnTaskQueued(shortTask)
+
+	//running task finishes while queued task is released back without running
+	m.taskProcessEh.EXPECT().OnTaskSuccess(longTask)
+	m.taskProcessEh.EXPECT().OnTaskRelease(shortTask, time.Duration(0))
+
+	m.HandlePayload(longTask)
+
+	time.Sleep(time.Millisecond * 5)
+
+	m.HandlePayload(shortTask)
+}
+
+func TestTaskKeepAlive(t *testing.T) {
+	m := newMock(t)
+	m.wc.KeepAlive = 0.5
+
+	defer setupTest(m)()
+
+	longTask := &common.Task{Name: wmocks.Tasks[wmocks.Long], Ttr: time.Millisecond * 200}
+
+	m.workerEh.EXPECT().OnPreTask(longTask)
+	m.workerEh.EXPECT().OnPostTask(longTask)
+
+	m.taskQueueEh.EXPECT().OnTaskQueued(longTask)
+
+	//long task runs longer than its time to run and keeps being touched
+	m.taskProcessEh.EXPECT().OnTaskHeartbeat(longTask).MinTimes(3).MaxTimes(5)
+	m.taskProcessEh.EXPECT().OnTaskSuccess(longTask)
+
+	m.HandlePayload(longTask)
+
+	time.Sleep(time.Millisecond * 600)
+}
+
+func TestTaskPanic(t *testing.T) {
+	m := newMock(t)
+
+	defer setupTest(m)()
+
+	shortTask := &common.Task{Name: wmocks.Tasks[wmocks.Short]}
+	panicTask := &common.Task{Name: wmocks.Tasks[wmocks.Panic]}
+
+	m.workerEh.EXPECT().OnPreTask(shortTask)
+	m.workerEh.EXPECT().OnPreTask(panicTask)
+	m.workerEh.EXPECT().OnPostTask(shortTask)
+
+	m.taskQueueEh.EXPECT().OnTaskQueued(shortTask)
+	m.taskQueueEh.EXPECT().OnTaskQueued(panicTask)
+
+	m.taskProcessEh.EXPECT().OnTaskSuccess(shortTask)
+	m.taskProcessEh.EXPECT().OnTaskError(panicTask, util.ErrEq(
+		log.TaskThreadError(panicTask.Name, log.TaskPanicError(wmocks.PanicTaskValue)))).Do(
+		func(_ *common.Task, err error) {
+			assert.NotEmpty(t, err.(*common.TaskThreadError).Stack)
+		})
+
+	m.HandlePayload(panicTask)
+	m.HandlePayload(shortTask)
+
+	time.Sleep(time.Millisecond * 50)
+}
+
+func TestTaskQuarantine(t *testing.T) {
+	m := newMock(t)
+	m.wc.Concurrency = 1
+	m.wc.QuarantineAfterPanics = 2
+
+	defer setupTest(m)()
+
+	panicTask := &common.Task{Name: wmocks.Tasks[wmocks.Panic]}
+
+	m.workerEh.EXPECT().OnPreTask(panicTask).Times(2)
+
+	m.taskQueueEh.EXPECT().OnTaskQueued(panicTask).Times(3)
+
+	m.taskProcessEh.EXPECT().OnTaskError(panicTask, util.ErrEq(
+		log.TaskThreadError(panicTask.Name, log.TaskPanicError(wmocks.PanicTaskValue)))).Times(2)
+	m.taskProcessEh.EXPECT().OnTaskError(panicTask, util.ErrEq(
+		log.TaskThreadError(panicTask.Name, log.TaskQuarantinedError(panicTask.Name, 2))))
+
+	for i := 0; i < 3; i++ {
+		m.HandlePayload(panicTask)
+	}
+
+	time.Sleep(time.Millisecond * 50)
+
+	assert.Equal(t, []string{panicTask.Name}, m.worker.Quarantined())
+
+	m.worker.Unquarantine(panicTask.Name)
+
+	assert.Empty(t, m.worker.Quarantined())
+}
+
+func TestTaskQuarantineExpired(t *testing.T) {
+	m := newMock(t)
+	m.wc.Concurrency = 1
+	m.wc.QuarantineAfterPanics = 2
+	m.wc.QuarantineDuration = time.Millisecond * 100
+
+	defer setupTest(m)()
+
+	panicTask := &common.Task{Name: wmocks.Tasks[wmocks.Panic]}
+
+	m.workerEh.EXPECT().OnPreTask(panicTask).Times(3)
+
+	m.taskQueueEh.EXPECT().OnTaskQueued(panicTask).Times(4)
+
+	m.taskProcessEh.EXPECT().OnTaskError(panicTask, util.ErrEq(
+		log.TaskThreadError(panicTask.Name, log.TaskPanicError(wmocks.PanicTaskValue)))).Times(3)
+	m.taskProcessEh.EXPECT().OnTaskError(panicTask, util.ErrEq(
+		log.TaskThreadError(panicTask.Name, log.TaskQuarantinedError(panicTask.Name, 2))))
+
+	for i := 0; i < 2; i++ {
+		m.HandlePayload(panicTask)
+	}
+
+	time.Sleep(time.Millisecond * 50)
+
+	assert.Equal(t, []string{panicTask.Name}, m.worker.Quarantined())
+
+	time.Sleep(time.Millisecond * 100)
+
+	//task runs after quarantine expired, and its panic quarantines task name again
+	assert.Empty(t, m.worker.Quarantined())
+
+	m.HandlePayload(panicTask)
+
+	time.Sleep(time.Millisecond * 50)
+
+	assert.Equal(t, []string{panicTask.Name}, m.worker.Quarantined())
+
+	m.HandlePayload(panicTask)
+}
+
+func TestMiddleware(t *testing.T) {
+	m := newMock(t)
+
+	var calls []string
+
+	record := func(name string) middleware.Middleware {
+		return func(next middleware.Handler) middleware.Handler {
+			return func(ctx context.Context, task *common.Task) error {
+				calls = append(calls, name)
+
+				actual, ok := common.TaskFromContext(ctx)
+				assert.True(t, ok)
+				assert.Equal(t, task, actual)
+
+				return next(ctx, task)
+			}
+		}
+	}
+
+	m.worker.Use(record("global"))
+	m.worker.UseForTask(wmocks.Tasks[wmocks.Short], record("task"))
+
+	defer setupTest(m)()
+
+	shortTask := &common.Task{Name: wmocks.Tasks[wmocks.Short]}
+
+	m.workerEh.EXPECT().OnPreTask(shortTask)
+	m.workerEh.EXPECT().OnPostTask(shortTask)
+
+	m.taskQueueEh.EXPECT().OnTaskQueued(shortTask)
+
+	m.taskProcessEh.EXPECT().OnTaskSuccess(shortTask).Do(func(_ *common.Task) {
+		assert.Equal(t, []string{"global", "task"}, calls)
+	})
+
+	m.HandlePayload(shortTask)
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	m := newMock(t)
+
+	m.worker.UseForTask(wmocks.Tasks[wmocks.Long], middleware.SkipIf(
+		func(_ context.Context, _ *common.Task) bool {
+			return true
+		}))
+	m.worker.UseForTask(wmocks.Tasks[wmocks.Short], middleware.RequireHeaders("tenant"))
+
+	defer setupTest(m)()
+
+	longTask := &common.Task{Name: wmocks.Tasks[wmocks.Long]}
+	shortTask := &common.Task{Name: wmocks.Tasks[wmocks.Short]}
+
+	m.taskQueueEh.EXPECT().OnTaskQueued(longTask)
+	m.taskQueueEh.EXPECT().OnTaskQueued(shortTask)
+
+	m.taskProcessEh.EXPECT().OnTaskSuccess(longTask)
+	m.taskProcessEh.EXPECT().OnTaskError(shortTask, util.ErrEq(
+		log.TaskThreadError(shortTask.Name, log.MissingTaskHeaderError(shortTask.Name, "tenant"))))
+
+	m.HandlePayload(longTask)
+	m.HandlePayload(shortTask)
+}
+
+func TestSetConcurrency(t *testing.T) {
+	m := newMock(t)
+	m.wc.Concurrency = 1
+
+	defer setupTest(m)()
+
+	m.scaleEh.EXPECT().OnScaleWorker(3).Times(2)
+	m.scaleEh.EXPECT().OnScaleWorker(1).Times(2)
+
+	m.worker.SetConcurrency(3)
+
+	longTask := &common.Task{Name: wmocks.Tasks[wmocks.Long]}
+
+	done := make(chan bool, 3)
+
+	m.workerEh.EXPECT().OnPreTask(longTask).Times(6)
+	m.workerEh.EXPECT().OnPostTask(longTask).Times(6)
+
+	m.taskQueueEh.EXPECT().OnTaskQueued(longTask).Times(6)
+
+	m.taskProcessEh.EXPECT().OnTaskSuccess(longTask).Times(6).Do(func(_ *common.Task) {
+		done <- true
+	})
+
+	runParallel := func() {
+		start := time.Now()
+
+		for i := 0; i < 3; i++ {
+			m.HandlePayload(longTask)
+		}
+
+		for i := 0; i < 3; i++ {
+			<-done
+		}
+
+		//tasks run in parallel on added threads
+		assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	}
+
+	runParallel()
+
+	assert.Equal(t, 3, m.worker.Config().Concurrency)
+
+	//threads asked to quit are kept by following grow, so tasks still run in parallel
+	m.worker.SetConcurrency(1)
+	m.worker.SetConcurrency(3)
+
+	runParallel()
+
+	m.worker.SetConcurrency(1)
+
+	assert.Equal(t, 1, m.worker.Config().Concurrency)
+}
+
+func TestAutoscale(t *testing.T) {
+	m := newMock(t)
+	m.wc.Concurrency = 1
+	m.wc.MinConcurrency = 1
+	m.wc.MaxConcurrency = 3
+	m.wc.ScaleInterval = time.Millisecond * 10
+	m.wc.ScaleDownHeartbeats = 1
+	m.wc.Heartbeat = time.Millisecond * 30
+
+	defer setupTest(m)()
+
+	longTask := &common.Task{Name: wmocks.Tasks[wmocks.Long]}
+
+	m.workerEh.EXPECT().OnPreTask(longTask).Times(4)
+	m.workerEh.EXPECT().OnPostTask(longTask).Times(4)
+	m.workerEh.EXPECT().OnThreadHeartbeat(gomock.Any()).AnyTimes()
+
+	m.taskQueueEh.EXPECT().OnTaskQueued(longTask).Times(4)
+
+	m.taskProcessEh.EXPECT().OnTaskSuccess(longTask).Times(4)
+
+	//grows to maximum while queue stays full, shrinks to minimum when idle
+	m.scaleEh.EXPECT().OnScaleWorker(2).Times(2)
+	m.scaleEh.EXPECT().OnScaleWorker(3)
+	m.scaleEh.EXPECT().OnScaleWorker(1)
+
+	start := time.Now()
+
+	for i := 0; i < 4; i++ {
+		m.HandlePayload(longTask)
+	}
+
+	//fourth task waits for one of three threads
+	assert.Less(t, int64(time.Since(start)), int64(time.Millisecond*700))
+
+	time.Sleep(time.Millisecond * 1200)
+}
+
+//queueEventHandler is task queue event handler notified of full queues
+type queueEventHandler struct {
+	*cmocks.MockTaskQueueEventHandler
+	*cmocks.MockTaskQueueFullHandler
+}
+
+func TestTaskPool(t *testing.T) {
+	m := newMock(t)
+	m.wc.Concurrency = 1
+	m.wc.Pools = map[string]int{"slow": 1}
+	m.wc.TaskPools = map[string]string{wmocks.Tasks[wmocks.Long]: "slow"}
+	m.wc.LimitReleaseDelay = time.Millisecond * 100
+
+	defer setupTest(m)()
+
+	longTask := &common.Task{Name: wmocks.Tasks[wmocks.Long]}
+	shortTask := &common.Task{Name: wmocks.Tasks[wmocks.Short]}
+
+	done := make(chan bool, 1)
+
+	m.workerEh.EXPECT().OnPreTask(longTask).Times(2)
+	m.workerEh.EXPECT().OnPostTask(longTask).Times(2)
+	m.workerEh.EXPECT().OnPreTask(shortTask)
+	m.workerEh.EXPECT().OnPostTask(shortTask)
+
+	m.taskQueueEh.EXPECT().OnTaskQueued(longTask).Times(2)
+	m.taskQueueEh.EXPECT().OnTaskQueued(shortTask)
+
+	//third long task finds its pool full and is released by connector without blocking
+	queueFullEh := cmocks.NewMockTaskQueueFullHandler(m.ctrl)
+	queueFullEh.EXPECT().OnTaskQueueFull(longTask, m.wc.LimitReleaseDelay)
+
+	m.connector.SetEventHandler(&queueEventHandler{m.taskQueueEh, queueFullEh})
+
+	m.taskProcessEh.EXPECT().OnTaskSuccess(longTask).Times(2)
+	m.taskProcessEh.EXPECT().OnTaskSuccess(shortTask).Do(func(_ *common.Task) {
+		done <- true
+	})
+
+	start := time.Now()
+
+	m.HandlePayload(longTask)
+
+	time.Sleep(time.Millisecond * 5)
+
+	m.HandlePayload(longTask)
+	m.HandlePayload(longTask)
+	m.HandlePayload(shortTask)
+
+	<-done
+
+	//short task is not starved by long tasks
+	assert.Less(t, int64(time.Since(start)), int64(time.Millisecond*100))
+
+	time.Sleep(time.Millisecond * 1100)
+}
+
+func TestMaxInFlight(t *testing.T) {
+	m := newMock(t)
+	m.wc.Concurrency = 2
+	m.wc.MaxInFlight = map[string]int{wmocks.Tasks[wmocks.Long]: 1}
+	m.wc.LimitReleaseDelay = time.Millisecond * 100
+
+	defer setupTest(m)()
+
+	longTask := &common.Task{Name: wmocks.Tasks[wmocks.Long]}
+
+	m.workerEh.EXPECT().OnPreTask(longTask)
+	m.workerEh.EXPECT().OnPostTask(longTask)
+
+	m.taskQueueEh.EXPECT().OnTaskQueued(longTask).Times(2)
+
+	//second task exceeds the limit and is released
+	m.taskProcessEh.EXPECT().OnTaskRelease(longTask, m.wc.LimitReleaseDelay)
+	m.taskProcessEh.EXPECT().OnTaskSuccess(longTask)
+
+	m.HandlePayload(longTask)
+
+	time.Sleep(time.Millisecond * 5)
+
+	m.HandlePayload(longTask)
+
+	time.Sleep(time.Millisecond * 600)
+}
+
+func TestUnknownTaskPool(t *testing.T) {
+	m := newMock(t)
+	m.wc.TaskPools = map[string]string{wmocks.Tasks[wmocks.Long]: "slow"}
+
+	assert.Equal(t, log.UnknownTaskPoolError(wmocks.Tasks[wmocks.Long], "slow"), m.worker.Init())
+}